@@ -0,0 +1,5 @@
+package constants
+
+const DirectoryVisibilityEveryone = "everyone"
+const DirectoryVisibilityOrganization = "organization"
+const DirectoryVisibilityHidden = "hidden"
@@ -0,0 +1,4 @@
+package constants
+
+const KeyAlgorithmX25519 = "x25519"
+const KeyAlgorithmEd25519 = "ed25519"
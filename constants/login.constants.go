@@ -0,0 +1,15 @@
+package constants
+
+const SignInMethodPassword = "password"
+const SignInMethodTotp = "totp"
+const SignInMethodStepUp = "step_up"
+const SignInMethodOIDC = "oidc"
+
+const SignInSucceeded = "success"
+const SignInInvalidCredentials = "invalid_credentials"
+const SignInLockedOut = "locked_out"
+const SignInAccountBlocked = "account_blocked"
+const SignInMfaRequired = "mfa_required"
+const SignInMfaFailed = "mfa_failed"
+const SignInStepUpRequired = "step_up_required"
+const SignInStepUpFailed = "step_up_failed"
@@ -0,0 +1,15 @@
+package constants
+
+const RoleUser = "user"
+const RoleAuditor = "auditor"
+const RoleAdmin = "admin"
+
+const PermissionUsersRead = "users:read"
+const PermissionUsersManage = "users:manage"
+const PermissionRolesManage = "roles:manage"
+const PermissionStatsRead = "stats:read"
+const PermissionAuditRead = "audit:read"
+
+const MemberRoleOwner = "owner"
+const MemberRoleAdmin = "admin"
+const MemberRoleMember = "member"
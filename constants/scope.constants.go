@@ -0,0 +1,11 @@
+package constants
+
+const ScopeFilesRead = "files:read"
+const ScopeFilesWrite = "files:write"
+const ScopeSecretsRead = "secrets:read"
+const ScopeSecretsWrite = "secrets:write"
+const ScopeSharingRead = "sharing:read"
+const ScopeSharingWrite = "sharing:write"
+
+// SessionScopes are granted to every access token issued at sign-in.
+var SessionScopes = []string{ScopeFilesRead, ScopeFilesWrite, ScopeSecretsRead, ScopeSecretsWrite, ScopeSharingRead, ScopeSharingWrite}
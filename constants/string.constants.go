@@ -12,3 +12,26 @@ const IdEmpty = "ID field is empty"
 const ShortTimeout = time.Second * 5
 const LongTimeout = time.Second * 7
 const NotFound = "Could not find requested object"
+const InvalidCredentials = "Could not match user credentials."
+const TotpAlreadyEnabled = "Two-factor authentication is already enabled"
+const InvalidTotpCode = "Invalid two-factor code"
+const Forbidden = "You do not have access to this resource"
+const EmailNotVerified = "Email address must be verified first"
+const InvalidVerificationToken = "Verification link is invalid or has expired"
+const PasswordResetRequested = "If an account exists for that email, a reset link has been sent"
+const InvalidResetToken = "Reset link is invalid or has expired"
+const TooManyAttempts = "Too many failed attempts, try again later"
+const InsufficientScope = "Access token does not grant the required scope"
+const AccountDisabled = "This account has been disabled"
+const PasswordChangeRequired = "A password reset is required before signing in"
+const InvalidKeyCertification = "Public key certification signature is invalid"
+const TooManyRequests = "Too many requests, try again later"
+const RecipientNotFound = "No recipient found for that email"
+const PasswordPolicyViolation = "Password does not meet the password policy"
+const StepUpRequired = "New device detected, confirm the sign-in with the link sent to your email"
+const InvalidStepUpCode = "Sign-in confirmation is invalid or has expired"
+const FileIntegrityError = "File content failed the integrity check"
+const FileContentMoved = "File content was moved while it was read, try again"
+const FileVersionNotFound = "File version not found"
+const IdentityLinkRequired = "An account with this email already exists, sign in and link the identity provider from your account"
+const IdentityLinkedElsewhere = "This identity is already linked to another account"
@@ -0,0 +1,22 @@
+package constants
+
+// Resumable uploads follow tus 1.0.0, see https://tus.io/protocols/resumable-upload.
+const (
+	TusVersion         = "1.0.0"
+	TusExtensions      = "creation,termination,expiration"
+	TusContentType     = "application/offset+octet-stream"
+	HeaderTusResumable = "Tus-Resumable"
+	HeaderUploadOffset = "Upload-Offset"
+	HeaderUploadLength = "Upload-Length"
+	HeaderUploadExpiry = "Upload-Expires"
+	HeaderUploadMeta   = "Upload-Metadata"
+	// HeaderUploadFileId names the file a finished upload became.
+	HeaderUploadFileId = "Upload-File-Id"
+	// HeaderUploadMinChunk is the smallest chunk accepted before the last.
+	HeaderUploadMinChunk = "Upload-Min-Chunk-Size"
+)
+
+const UploadNotFound = "Upload not found"
+const UploadExpired = "Upload has expired"
+const UploadOffsetMismatch = "Upload-Offset does not match the current offset"
+const UploadChunkTooSmall = "Upload chunks other than the last must be at least the minimum chunk size"
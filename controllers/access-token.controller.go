@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/db/orms"
+	"github.com/subashshakya/SFSS/models"
+	"github.com/subashshakya/SFSS/utils"
+)
+
+func CreateAccessToken(c *gin.Context) {
+	var request models.CreateAccessTokenRequest
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println(constants.Unauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		log.Println(constants.BadRequest, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+		return
+	}
+	if err := validate.Struct(&request); err != nil {
+		log.Println(constants.ValidationError, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.ValidationError})
+		return
+	}
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+		log.Println("Access token expiry is in the past")
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.ValidationError})
+		return
+	}
+	token, tokenHash, err := utils.GeneratePersonalAccessToken()
+	if err != nil {
+		log.Println("Could not generate access token:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	accessToken := models.PersonalAccessToken{
+		UserId:    principal.UserId,
+		Name:      request.Name,
+		TokenHash: tokenHash,
+		Scopes:    request.Scopes,
+		FileIds:   request.FileIds,
+		SecretIds: request.SecretIds,
+		ExpiresAt: request.ExpiresAt,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	if err := orms.CreatePersonalAccessToken(ctx, &accessToken); err != nil {
+		log.Println("Could not save access token:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"success": true, "message": "Access token created, it will not be shown again", "token": token, "data": accessToken})
+}
+
+func GetAccessTokens(c *gin.Context) {
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println(constants.Unauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	tokens, err := orms.GetPersonalAccessTokensOfAUser(ctx, principal.UserId)
+	if err != nil {
+		log.Println("Could not fetch access tokens:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Successfully fetched access tokens", "data": tokens})
+}
+
+func RevokeAccessToken(c *gin.Context) {
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println(constants.Unauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	tokenId, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil || tokenId == 0 {
+		log.Println("Could not parse id:", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	revoked, err := orms.RevokePersonalAccessToken(ctx, principal.UserId, uint(tokenId))
+	if err != nil {
+		log.Println("Could not revoke access token:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	if !revoked {
+		log.Println("Access token not found")
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": constants.NotFound})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Access token revoked"})
+}
@@ -0,0 +1,229 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/db/orms"
+	"github.com/subashshakya/SFSS/models"
+)
+
+const defaultPageSize = 50
+const maxPageSize = 200
+
+func adminUserView(user models.User) gin.H {
+	view := gin.H{
+		"id":                      user.Id,
+		"first_name":              user.FirstName,
+		"last_name":               user.LastName,
+		"email":                   user.Email,
+		"role":                    user.Role,
+		"email_verified":          user.EmailVerifiedAt.Valid,
+		"totp_enabled":            user.TotpEnabled,
+		"disabled":                user.DisabledAt.Valid,
+		"password_reset_required": user.PasswordResetRequired,
+	}
+	if user.DisabledAt.Valid {
+		view["disabled_at"] = user.DisabledAt.Time
+	}
+	return view
+}
+
+func pagination(c *gin.Context) (int, int) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultPageSize)))
+	if err != nil || limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+// adminTarget reads the user id path parameter and refuses actions an admin
+// would take on their own account, so that nobody can lock themselves out.
+func adminTarget(c *gin.Context) (*models.Principal, uint, bool) {
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println(constants.Unauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return nil, 0, false
+	}
+	userId, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil || userId == 0 {
+		log.Println("Could not parse user id:", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+		return nil, 0, false
+	}
+	if uint(userId) == principal.UserId {
+		log.Println("Admin tried to change their own account")
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "You cannot perform this action on your own account"})
+		return nil, 0, false
+	}
+	return principal, uint(userId), true
+}
+
+func respondAdminActionError(c *gin.Context, err error) {
+	if errors.Is(err, orms.ErrNotFound) {
+		log.Println("User not found")
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": constants.NotFound})
+		return
+	}
+	log.Println("Admin action failed:", err)
+	c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+}
+
+func AdminListUsers(c *gin.Context) {
+	limit, offset := pagination(c)
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	users, total, err := orms.SearchUsers(ctx, c.Query("q"), limit, offset)
+	if err != nil {
+		log.Println("Could not search users:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	data := make([]gin.H, 0, len(users))
+	for _, user := range users {
+		data = append(data, adminUserView(user))
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Successfully fetched users", "data": data, "total": total})
+}
+
+func AdminGetUser(c *gin.Context) {
+	userId, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil || userId == 0 {
+		log.Println("Could not parse user id:", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	user, err := orms.GetUser(ctx, uint(userId))
+	if errors.Is(err, orms.ErrNotFound) {
+		log.Println("User not found:", userId)
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": constants.NotFound})
+		return
+	}
+	if err != nil {
+		log.Println("Could not fetch user:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Successfully fetched user", "data": adminUserView(user)})
+}
+
+func AdminUpdateUserRole(c *gin.Context) {
+	var request models.UpdateRoleRequest
+	principal, userId, ok := adminTarget(c)
+	if !ok {
+		return
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		log.Println(constants.BadRequest, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+		return
+	}
+	if err := validate.Struct(&request); err != nil {
+		log.Println(constants.ValidationError, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.ValidationError})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	if err := orms.SetUserRole(ctx, &principal.UserId, userId, request.Role, c.ClientIP()); err != nil {
+		respondAdminActionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Role updated"})
+}
+
+func AdminDisableUser(c *gin.Context) {
+	setUserDisabled(c, true)
+}
+
+func AdminEnableUser(c *gin.Context) {
+	setUserDisabled(c, false)
+}
+
+func setUserDisabled(c *gin.Context, disabled bool) {
+	principal, userId, ok := adminTarget(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	if err := orms.SetUserDisabled(ctx, principal.UserId, userId, disabled, c.ClientIP()); err != nil {
+		respondAdminActionError(c, err)
+		return
+	}
+	message := "Account enabled"
+	if disabled {
+		message = "Account disabled"
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": message})
+}
+
+func AdminForcePasswordReset(c *gin.Context) {
+	principal, userId, ok := adminTarget(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	if err := orms.ForcePasswordReset(ctx, principal.UserId, userId, c.ClientIP()); err != nil {
+		respondAdminActionError(c, err)
+		return
+	}
+	user, err := orms.GetUser(ctx, userId)
+	if err != nil {
+		log.Println("Could not find user:", err)
+	} else {
+		queuePasswordResetEmail(user.Email)
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Password reset required, the user has been signed out"})
+}
+
+func AdminGetStorageStats(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), constants.LongTimeout)
+	defer cancel()
+	stats, err := orms.GetStorageStats(ctx)
+	if err != nil {
+		log.Println("Could not fetch storage stats:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Successfully fetched storage stats", "data": stats})
+}
+
+func AdminGetAuditLogs(c *gin.Context) {
+	limit, offset := pagination(c)
+	var targetUserId uint64
+	if raw := c.Query("user_id"); raw != "" {
+		var err error
+		targetUserId, err = strconv.ParseUint(raw, 10, 0)
+		if err != nil {
+			log.Println("Could not parse user id:", err)
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+			return
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	logs, err := orms.GetAuditLogs(ctx, uint(targetUserId), limit, offset)
+	if err != nil {
+		log.Println("Could not fetch audit logs:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Successfully fetched audit logs", "data": logs})
+}
@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/subashshakya/SFSS/db/dbtest"
+	"github.com/subashshakya/SFSS/db/orms"
+	"github.com/subashshakya/SFSS/mailer"
+	"github.com/subashshakya/SFSS/models"
+	"github.com/subashshakya/SFSS/utils"
+	"gorm.io/gorm"
+)
+
+// useMemoryMailer swaps in a mailer the test can read for the duration of
+// the test.
+func useMemoryMailer(t *testing.T) *mailer.MemoryMailer {
+	t.Helper()
+	memory := mailer.NewMemoryMailer("")
+	previous := mailer.Default
+	mailer.Default = memory
+	t.Cleanup(func() { mailer.Default = previous })
+	return memory
+}
+
+// useTestDatabase points the ORM at a fresh schema for the duration of the
+// test, or skips the test when there is no test database.
+func useTestDatabase(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := dbtest.Open(t,
+		&models.User{},
+		&models.UserIdentity{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.LoginAttempt{},
+		&models.SecureFile{},
+		&models.FileVersion{},
+		&models.FileUpload{},
+		&models.FileUploadPart{},
+		&models.BlobDeletion{},
+		&models.SuperSecret{},
+		&models.FileSharing{},
+		&models.SecretSharing{},
+		&models.TeamMember{},
+	)
+	previous := orms.DatabaseConnection
+	orms.DatabaseConnection = db
+	t.Cleanup(func() { orms.DatabaseConnection = previous })
+	return db
+}
+
+// asUser stands in for CheckInvalidToken.
+func asUser(userId uint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		utils.SetPrincipal(c, &models.Principal{UserId: userId, EmailVerified: true})
+		c.Next()
+	}
+}
+
+func serve(router *gin.Engine, request *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func createTestUser(t *testing.T, db *gorm.DB, email string, verified bool) models.User {
+	t.Helper()
+	user := models.User{FirstName: "Test", LastName: "User", Email: email, Password: "x", PhoneNumber: "0"}
+	if verified {
+		user.EmailVerifiedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/db/orms"
+	"github.com/subashshakya/SFSS/models"
+)
+
+const directorySearchLimit = 10
+const directoryNameMinLength = 2
+
+// SearchDirectory finds share recipients by exact email or by a name prefix.
+// Only users whose privacy settings let the caller see them are returned.
+func SearchDirectory(c *gin.Context) {
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println(constants.Unauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	email := strings.TrimSpace(c.Query("email"))
+	name := strings.TrimSpace(c.Query("name"))
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	switch {
+	case email != "":
+		if err := validate.Var(email, "email"); err != nil {
+			log.Println(constants.ValidationError, err)
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.ValidationError})
+			return
+		}
+		user, err := orms.FindDirectoryUserByEmail(ctx, principal.UserId, email)
+		if err != nil {
+			log.Println("Could not search directory:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+			return
+		}
+		entries := []models.DirectoryEntry{}
+		if user != nil {
+			entries = append(entries, models.DirectoryEntry{Id: user.Id, FirstName: user.FirstName, LastName: user.LastName, Email: user.Email})
+		}
+		c.JSON(http.StatusOK, gin.H{"success": true, "message": "Successfully searched the directory", "data": entries})
+	case len([]rune(name)) >= directoryNameMinLength:
+		entries, err := orms.SearchDirectoryByName(ctx, principal.UserId, name, directorySearchLimit)
+		if err != nil {
+			log.Println("Could not search directory:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"success": true, "message": "Successfully searched the directory", "data": entries})
+	default:
+		log.Println("Directory search needs an email or a name prefix")
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+	}
+}
+
+func UpdateDirectorySettings(c *gin.Context) {
+	var request models.DirectorySettingsRequest
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println(constants.Unauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		log.Println(constants.BadRequest, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+		return
+	}
+	if err := validate.Struct(&request); err != nil {
+		log.Println(constants.ValidationError, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.ValidationError})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	err := orms.SetDirectoryVisibility(ctx, principal.UserId, request.Visibility)
+	if errors.Is(err, orms.ErrNotFound) {
+		log.Println("User not found")
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": constants.NotFound})
+		return
+	}
+	if err != nil {
+		log.Println("Could not update directory settings:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Directory settings updated", "data": request})
+}
+
+// resolveRecipient fills in recipientId from recipientEmail when the client
+// shared by email. It writes the error response and returns false on failure.
+func resolveRecipient(ctx context.Context, c *gin.Context, callerId uint, recipientId *uint, recipientEmail string) bool {
+	if recipientEmail == "" {
+		if *recipientId == 0 {
+			log.Println("Share request without a recipient")
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.ValidationError})
+			return false
+		}
+		return true
+	}
+	recipient, err := orms.FindDirectoryUserByEmail(ctx, callerId, recipientEmail)
+	if err != nil {
+		log.Println("Could not resolve recipient:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return false
+	}
+	if recipient == nil {
+		log.Println("Recipient email not found in directory")
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": constants.RecipientNotFound})
+		return false
+	}
+	if *recipientId != 0 && *recipientId != recipient.Id {
+		log.Println("Recipient id and email do not match")
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.ValidationError})
+		return false
+	}
+	*recipientId = recipient.Id
+	return true
+}
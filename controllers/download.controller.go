@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/db/orms"
+	"github.com/subashshakya/SFSS/envelope"
+	"github.com/subashshakya/SFSS/models"
+	"github.com/subashshakya/SFSS/storage"
+	"github.com/subashshakya/SFSS/utils"
+)
+
+// DownloadSecureFile streams the decrypted content of a file. Ranges,
+// If-Range, If-None-Match and HEAD are handled by http.ServeContent against
+// an ETag of the content hash. Content is always sent as an attachment so a
+// browser never renders it in the page.
+func DownloadSecureFile(c *gin.Context) {
+	secureFile, ok := findAccessibleFile(c)
+	if !ok {
+		return
+	}
+	serveFileContent(c, secureFile)
+}
+
+// findAccessibleFile loads the file named in the path for the caller and
+// writes the response when there is none.
+func findAccessibleFile(c *gin.Context) (*models.SecureFile, bool) {
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println("Token is invalid")
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return nil, false
+	}
+	fileId := c.Param("id")
+	if !principal.CanAccessFile(fileId) {
+		log.Println("Access token is not allowed to use this file")
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.Forbidden})
+		return nil, false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	secureFile, err := orms.GetAccessibleSecureFile(ctx, fileId, principal.UserId)
+	if err != nil {
+		log.Println("Could not find the file:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return nil, false
+	}
+	if secureFile == nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "File not found"})
+		return nil, false
+	}
+	return secureFile, true
+}
+
+func serveFileContent(c *gin.Context, secureFile *models.SecureFile) {
+	var content io.ReadSeeker
+	if secureFile.StorageKey == "" {
+		inline, ok := openInlineContent(c, secureFile)
+		if !ok {
+			return
+		}
+		content = inline
+	} else {
+		stored, err := envelope.Default.OpenSeeker(c.Request.Context(), storage.Default, secureFile.StorageKey, secureFile.Encryption, secureFile.SizeBytes)
+		if err != nil {
+			respondContentError(c, err)
+			return
+		}
+		defer stored.Close()
+		content = stored
+	}
+	contentType := secureFile.ContentType
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": secureFile.FileName}))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Cache-Control", "private, no-cache")
+	if secureFile.Sha256 != "" {
+		c.Header("ETag", `"`+secureFile.Sha256+`"`)
+	}
+	// No modification time: content can change without CreatedAt changing,
+	// so validation relies on the ETag alone.
+	http.ServeContent(c.Writer, c.Request, "", time.Time{}, loggingReadSeeker{ReadSeeker: content, fileId: secureFile.Id})
+}
+
+// openInlineContent serves content that -migrate-file-data has not moved to
+// the blob store yet straight from the database.
+func openInlineContent(c *gin.Context, secureFile *models.SecureFile) (io.ReadSeeker, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), constants.LongTimeout)
+	defer cancel()
+	data, err := orms.GetInlineFileData(ctx, secureFile.Id)
+	if err != nil {
+		log.Println("Could not read file content from the database:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return nil, false
+	}
+	if data == nil {
+		log.Println("File content moved to the blob store while it was read:", secureFile.Id)
+		c.JSON(http.StatusConflict, gin.H{"success": false, "message": constants.FileContentMoved})
+		return nil, false
+	}
+	if secureFile.Sha256 == "" {
+		secureFile.Sha256 = utils.ContentSha256(data)
+	}
+	return bytes.NewReader(data), true
+}
+
+// loggingReadSeeker logs read failures, which http.ServeContent drops once
+// the headers are out. Tampered content then shows up as a cut off download
+// and an integrity error in the log.
+type loggingReadSeeker struct {
+	io.ReadSeeker
+	fileId string
+}
+
+func (r loggingReadSeeker) Read(p []byte) (int, error) {
+	n, err := r.ReadSeeker.Read(p)
+	if err != nil && err != io.EOF {
+		if errors.Is(err, envelope.ErrIntegrity) {
+			log.Println("Content of file", r.fileId, "failed the integrity check")
+		} else {
+			log.Println("Could not read content of file", r.fileId, ":", err)
+		}
+	}
+	return n, err
+}
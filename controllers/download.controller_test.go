@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/subashshakya/SFSS/envelope"
+	"github.com/subashshakya/SFSS/models"
+	"github.com/subashshakya/SFSS/storage"
+	"github.com/subashshakya/SFSS/utils"
+	"gorm.io/gorm/clause"
+)
+
+// storeTestFile encrypts content into the test store and returns the file
+// that points at it.
+func storeTestFile(t *testing.T, userId uint, content string) models.SecureFile {
+	t.Helper()
+	file := models.SecureFile{Id: "file-1", FileName: "greeting.txt", ContentType: "text/plain", StorageKey: "file-1-key",
+		SizeBytes: int64(len(content)), Sha256: utils.ContentSha256([]byte(content)), UserId: int(userId)}
+	encryption, err := envelope.Default.Put(context.Background(), storage.Default, file.StorageKey, strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Encryption = encryption
+	return file
+}
+
+func TestServeFileContentHonoursRangesAndValidators(t *testing.T) {
+	useTestStorage(t)
+	content := "hello, world"
+	file := storeTestFile(t, 1, content)
+	etag := `"` + file.Sha256 + `"`
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	serveFile := func(c *gin.Context) {
+		stored := file
+		serveFileContent(c, &stored)
+	}
+	router.GET("/download", serveFile)
+	router.HEAD("/download", serveFile)
+	download := func(method string, header map[string]string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, "/download", nil)
+		for name, value := range header {
+			request.Header.Set(name, value)
+		}
+		return serve(router, request)
+	}
+
+	full := download(http.MethodGet, nil)
+	if full.Code != http.StatusOK || full.Body.String() != content {
+		t.Fatalf("GET = %d %q", full.Code, full.Body.String())
+	}
+	if full.Header().Get("ETag") != etag || full.Header().Get("Accept-Ranges") != "bytes" {
+		t.Errorf("ETag %q, Accept-Ranges %q", full.Header().Get("ETag"), full.Header().Get("Accept-Ranges"))
+	}
+	if disposition := full.Header().Get("Content-Disposition"); !strings.HasPrefix(disposition, "attachment") {
+		t.Errorf("Content-Disposition = %q", disposition)
+	}
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		status int
+		body   string
+	}{
+		{"range", map[string]string{"Range": "bytes=7-11"}, http.StatusPartialContent, "world"},
+		{"suffix range", map[string]string{"Range": "bytes=-5"}, http.StatusPartialContent, "world"},
+		{"unsatisfiable range", map[string]string{"Range": "bytes=100-"}, http.StatusRequestedRangeNotSatisfiable, ""},
+		{"matching If-None-Match", map[string]string{"If-None-Match": etag}, http.StatusNotModified, ""},
+		{"other If-None-Match", map[string]string{"If-None-Match": `"stale"`}, http.StatusOK, content},
+		{"matching If-Range", map[string]string{"Range": "bytes=0-4", "If-Range": etag}, http.StatusPartialContent, "hello"},
+		{"stale If-Range", map[string]string{"Range": "bytes=0-4", "If-Range": `"stale"`}, http.StatusOK, content},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := download(http.MethodGet, test.header)
+			if response.Code != test.status {
+				t.Fatalf("status = %d, want %d", response.Code, test.status)
+			}
+			if test.body != "" && response.Body.String() != test.body {
+				t.Errorf("body = %q, want %q", response.Body.String(), test.body)
+			}
+		})
+	}
+	if ranged := download(http.MethodGet, map[string]string{"Range": "bytes=7-11"}); ranged.Header().Get("Content-Range") != "bytes 7-11/12" {
+		t.Errorf("Content-Range = %q", ranged.Header().Get("Content-Range"))
+	}
+
+	head := download(http.MethodHead, nil)
+	if head.Code != http.StatusOK || head.Body.Len() != 0 || head.Header().Get("Content-Length") != "12" {
+		t.Errorf("HEAD = %d, %d bytes, Content-Length %q", head.Code, head.Body.Len(), head.Header().Get("Content-Length"))
+	}
+}
+
+func TestDownloadSecureFileOnlyServesAccessibleFiles(t *testing.T) {
+	db := useTestDatabase(t)
+	useTestStorage(t)
+	owner := createTestUser(t, db, "ada@example.com", true)
+	other := createTestUser(t, db, "eve@example.com", true)
+	file := storeTestFile(t, owner.Id, "hello, world")
+	if err := db.Omit(clause.Associations).Create(&file).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/owner/:id/download", asUser(owner.Id), DownloadSecureFile)
+	router.GET("/other/:id/download", asUser(other.Id), DownloadSecureFile)
+	if response := serve(router, httptest.NewRequest(http.MethodGet, "/owner/file-1/download", nil)); response.Code != http.StatusOK || response.Body.String() != "hello, world" {
+		t.Errorf("owner download = %d %q", response.Code, response.Body.String())
+	}
+	if response := serve(router, httptest.NewRequest(http.MethodGet, "/other/file-1/download", nil)); response.Code != http.StatusNotFound {
+		t.Errorf("another user's download = %d, want 404", response.Code)
+	}
+}
@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/db/orms"
+	"github.com/subashshakya/SFSS/mailer"
+	"github.com/subashshakya/SFSS/models"
+	"github.com/subashshakya/SFSS/utils"
+)
+
+func sendVerificationEmail(ctx context.Context, user models.User) error {
+	token, err := utils.GenerateEmailVerificationToken(user.Id, user.Email)
+	if err != nil {
+		return err
+	}
+	link := fmt.Sprintf("%s/user/verify_email?token=%s", os.Getenv("APP_BASE_URL"), url.QueryEscape(token))
+	return mailer.Default.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your SFSS email address",
+		Body:    fmt.Sprintf("Hi %s,\n\nConfirm your email address by opening the link below. It expires in 24 hours.\n\n%s\n", user.FirstName, link),
+	})
+}
+
+func VerifyEmail(c *gin.Context) {
+	var request models.EmailVerificationRequest
+	request.Token = c.Query("token")
+	if request.Token == "" {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			log.Println(constants.BadRequest, err)
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+			return
+		}
+	}
+	if err := validate.Struct(&request); err != nil {
+		log.Println(constants.ValidationError, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.ValidationError})
+		return
+	}
+	userId, email, err := utils.ParseEmailVerificationToken(request.Token)
+	if err != nil {
+		log.Println("Verification token invalid:", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.InvalidVerificationToken})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	user, err := orms.GetUser(ctx, userId)
+	if err != nil || user.Email != email {
+		log.Println("Verification token does not match user:", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.InvalidVerificationToken})
+		return
+	}
+	if user.EmailVerifiedAt.Valid {
+		c.JSON(http.StatusOK, gin.H{"success": true, "message": "Email already verified"})
+		return
+	}
+	if _, err := orms.MarkEmailVerified(ctx, userId, email); err != nil {
+		log.Println("Could not mark email verified:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Email verified successfully"})
+}
+
+func ResendVerificationEmail(c *gin.Context) {
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println(constants.Unauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	if principal.EmailVerified {
+		c.JSON(http.StatusOK, gin.H{"success": true, "message": "Email already verified"})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.LongTimeout)
+	defer cancel()
+	user, err := orms.GetUser(ctx, principal.UserId)
+	if err != nil {
+		log.Println("Could not find user:", err)
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": constants.NotFound})
+		return
+	}
+	if err := sendVerificationEmail(ctx, user); err != nil {
+		log.Println("Could not send verification email:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Verification email sent"})
+}
@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/subashshakya/SFSS/models"
+	"github.com/subashshakya/SFSS/utils"
+)
+
+var verificationLink = regexp.MustCompile(`https://sfss\.example\.com/user/verify_email\?token=(\S+)`)
+
+func TestSendVerificationEmailLinksToASignedToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("APP_BASE_URL", "https://sfss.example.com")
+	memory := useMemoryMailer(t)
+	user := models.User{Id: 42, FirstName: "Ada", Email: "ada@example.com"}
+
+	if err := sendVerificationEmail(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	messages := memory.Messages()
+	if len(messages) != 1 || messages[0].To != user.Email {
+		t.Fatalf("messages = %v", messages)
+	}
+	link := verificationLink.FindStringSubmatch(messages[0].Body)
+	if link == nil {
+		t.Fatalf("no verification link in %q", messages[0].Body)
+	}
+	token, err := url.QueryUnescape(link[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	userId, email, err := utils.ParseEmailVerificationToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userId != user.Id || email != user.Email {
+		t.Errorf("token is for %d %q, want %d %q", userId, email, user.Id, user.Email)
+	}
+}
+
+func TestVerifyEmailRejectsOtherTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	resetToken, err := utils.GenerateChallengeToken(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, token := range map[string]string{
+		"garbage":       "not-a-token",
+		"other purpose": resetToken,
+	} {
+		t.Run(name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/user/verify_email", VerifyEmail)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/user/verify_email?token="+url.QueryEscape(token), nil))
+			if recorder.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", recorder.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
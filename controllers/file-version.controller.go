@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/db/orms"
+	"github.com/subashshakya/SFSS/models"
+	"github.com/subashshakya/SFSS/utils"
+)
+
+// GetFileVersions lists the versions of a file the caller can read, newest
+// first.
+func GetFileVersions(c *gin.Context) {
+	secureFile, ok := findAccessibleFile(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	versions, err := orms.GetFileVersions(ctx, secureFile)
+	if err != nil {
+		log.Println("Could not list the file versions:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	for i := range versions {
+		versions[i].Current = versions[i].Version == secureFile.Version
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Fetched the file versions", "data": versions})
+}
+
+// DownloadFileVersion streams the content of one version of a file the same
+// way DownloadSecureFile streams the current one.
+func DownloadFileVersion(c *gin.Context) {
+	version, ok := versionParam(c)
+	if !ok {
+		return
+	}
+	secureFile, ok := findAccessibleFile(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	fileVersion, err := orms.GetFileVersion(ctx, secureFile, version)
+	cancel()
+	if err != nil {
+		log.Println("Could not find the file version:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	if fileVersion == nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": constants.FileVersionNotFound})
+		return
+	}
+	serveFileContent(c, &models.SecureFile{
+		Id:          secureFile.Id,
+		FileName:    secureFile.FileName,
+		StorageKey:  fileVersion.StorageKey,
+		ContentType: fileVersion.ContentType,
+		SizeBytes:   fileVersion.SizeBytes,
+		Sha256:      fileVersion.Sha256,
+		Encryption:  fileVersion.Encryption,
+		Version:     fileVersion.Version,
+	})
+}
+
+// RestoreFileVersion makes an old version the current content of the file
+// by adding it again as the newest version.
+func RestoreFileVersion(c *gin.Context) {
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println("Token is invalid")
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	version, ok := versionParam(c)
+	if !ok {
+		return
+	}
+	fileId := c.Param("id")
+	if !principal.CanAccessFile(fileId) {
+		log.Println("Access token is not allowed to use this file")
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.Forbidden})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.LongTimeout)
+	defer cancel()
+	secureFile, err := orms.RestoreFileVersion(ctx, fileId, version, principal.UserId, utils.FileVersionRetention())
+	if errors.Is(err, orms.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": constants.FileVersionNotFound})
+		return
+	}
+	if err != nil {
+		log.Println("Could not restore the file version:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Restored the file version", "data": secureFile.Metadata()})
+}
+
+func versionParam(c *gin.Context) (int, bool) {
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+		return 0, false
+	}
+	return version, true
+}
@@ -1,15 +1,20 @@
 package controllers
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
 	"github.com/subashshakya/SFSS/constants"
 	"github.com/subashshakya/SFSS/db/orms"
+	"github.com/subashshakya/SFSS/envelope"
 	"github.com/subashshakya/SFSS/models"
+	"github.com/subashshakya/SFSS/storage"
 	"github.com/subashshakya/SFSS/utils"
 
 	"log"
@@ -23,17 +28,16 @@ func init() {
 	validate = validator.New()
 }
 
-func checkInvalidToken(c *gin.Context) bool {
-	if err := utils.TokenValid(c); err != nil {
-		return false
-	}
-	return true
+func getPrincipal(c *gin.Context) (*models.Principal, bool) {
+	return utils.GetPrincipal(c)
 }
 
 func GetUserFiles(c *gin.Context) {
 	var userFiles []models.SecureFile
-	tokenIsValid := checkInvalidToken(c)
-	if !tokenIsValid {
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println("Token is not valid")
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
 		return
 	}
 	userId, err := strconv.ParseUint(c.Param("id"), 10, 0)
@@ -47,120 +51,192 @@ func GetUserFiles(c *gin.Context) {
 		c.JSON(http.StatusBadGateway, gin.H{"success": false, "message": constants.BadRequest})
 		return
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	user, _ := orms.GetUser(ctx, uint(userId))
-	if user.Id == 0 {
-		log.Println("Could not find user")
-		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "Could not find user"})
+	if uint(userId) != principal.UserId {
+		log.Println("User tried to list files of another user")
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.Forbidden})
 		return
 	}
-	userFiles, isNilErr := orms.GetSecureFilesOfAUser(ctx, int(userId))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	userFiles, isNilErr := orms.GetSecureFilesOfAUser(ctx, principal.UserId)
 	if isNilErr != nil {
 		log.Println(isNilErr)
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"success": false, "message": "Successfully fetched user files", "data": userFiles})
+	userFiles = filterAccessibleFiles(principal, userFiles)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Successfully fetched user files", "data": filesMetadata(userFiles)})
+}
+
+// filesMetadata is what file listings return, leaving out the content
+// location and the owner row.
+func filesMetadata(files []models.SecureFile) []models.FileMetadata {
+	metadata := make([]models.FileMetadata, 0, len(files))
+	for i := range files {
+		metadata = append(metadata, files[i].Metadata())
+	}
+	return metadata
 }
 
 func UpdateSecureFile(c *gin.Context) {
-	var secureFile models.SecureFile
-	tokenIsValid := checkInvalidToken(c)
-	if !tokenIsValid {
+	var fileRequest models.SecureFileRequest
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println("Token is not valid")
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
 		return
 	}
-	if err := c.ShouldBindJSON(&secureFile); err != nil {
+	if err := c.ShouldBindJSON(&fileRequest); err != nil {
 		log.Println(err)
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
 		return
 	}
-	if err := validate.Struct(&secureFile); err != nil {
+	if err := validate.Struct(&fileRequest); err != nil {
 		log.Println("Validation Error: ", err)
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.ValidationError})
 		return
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	if !principal.CanAccessFile(fileRequest.Id) {
+		log.Println("Access token is not allowed to use this file")
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.Forbidden})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.LongTimeout)
 	defer cancel()
-	updatedFile, err := orms.UpdateFile(ctx, &secureFile)
+	secureFile := models.SecureFile{Id: fileRequest.Id, FileName: fileRequest.FileName}
+	if fileRequest.FileData != nil && !storeInlineContent(ctx, c, &secureFile, fileRequest.FileData) {
+		return
+	}
+	updatedFile, err := orms.UpdateFile(ctx, &secureFile, principal.UserId, utils.FileVersionRetention())
+	if err != nil {
+		discardStoredContent(&secureFile)
+	}
+	if errors.Is(err, orms.ErrNotFound) {
+		log.Println("File not found for owner")
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "File not found"})
+		return
+	}
 	if err != nil {
 		log.Println("Failed to update the file: ", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Updated the file successfully", "data": updatedFile})
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Updated the file successfully", "data": updatedFile.Metadata()})
 }
 
 func MakeSecureFile(c *gin.Context) {
-	var secureFile models.SecureFile
-	tokenIsValid := checkInvalidToken(c)
-	if !tokenIsValid {
+	var fileRequest models.SecureFileRequest
+	principal, ok := getPrincipal(c)
+	if !ok {
 		log.Println("Token is not valid")
 		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
 		return
 	}
-	if err := c.ShouldBindJSON(&secureFile); err != nil {
+	if err := c.ShouldBindJSON(&fileRequest); err != nil {
 		log.Println("JSON Binding Error: ", err)
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
 		return
 	}
-	if err := validate.Struct(&secureFile); err != nil {
+	if err := validate.Struct(&fileRequest); err != nil {
 		log.Println("Validation Error:", err)
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.ValidationError})
 		return
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	if !principal.CanCreateFiles() {
+		log.Println("Access token is restricted to existing files")
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.Forbidden})
+		return
+	}
+	secureFile := models.SecureFile{
+		Id:          uuid.New().String(),
+		FileName:    fileRequest.FileName,
+		ContentType: defaultContentType,
+		UserId:      int(principal.UserId),
+		TeamId:      fileRequest.TeamId,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.LongTimeout)
 	defer cancel()
+	if !canCreateTeamItem(ctx, c, secureFile.TeamId, principal.UserId) {
+		return
+	}
+	if !storeInlineContent(ctx, c, &secureFile, fileRequest.FileData) {
+		return
+	}
 	createSuccess, err := orms.CreateSecureFile(ctx, &secureFile)
 	if err != nil || !createSuccess {
 		log.Println("Could not save the file: ", err)
+		discardStoredContent(&secureFile)
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
 		return
 	}
-	c.JSON(http.StatusCreated, gin.H{"success": false, "message": "Created File Successfully"})
+	c.JSON(http.StatusCreated, gin.H{"success": true, "message": "Created File Successfully", "data": secureFile.Metadata()})
 }
 
 func DeleteFile(c *gin.Context) {
-	tokenIsValid := checkInvalidToken(c)
-	if !tokenIsValid {
+	principal, ok := getPrincipal(c)
+	if !ok {
 		log.Println("Token is invalid")
 		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
 		return
 	}
-	fileId := c.Param("id")
+	fileId := pathOrQueryId(c)
+	if !principal.CanAccessFile(fileId) {
+		log.Println("Access token is not allowed to use this file")
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.Forbidden})
+		return
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
-	_, err := orms.GetSecureFileById(ctx, fileId)
+	secureFile, err := orms.GetAccessibleSecureFile(ctx, fileId, principal.UserId)
 	if err != nil {
-		log.Println("File not found", err)
+		log.Println("Could not find the file:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	if secureFile == nil {
+		log.Println("File not found or not accessible")
 		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "File not found"})
 		return
 	}
-	deleteSuccess, err := orms.DeleteSecureFile(ctx, fileId)
+	deleteSuccess, err := orms.DeleteSecureFile(ctx, fileId, principal.UserId)
 	if err != nil && !deleteSuccess {
 		log.Println("Could not delete file:", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
 		return
 	}
 	if err == nil && !deleteSuccess {
-		log.Println("Delete not successful")
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Delete not successful"})
+		log.Println("User tried to delete a file they cannot modify")
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.Forbidden})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Successfully deleted file"})
 }
 
+// pathOrQueryId reads the id from the path, or from the id query parameter
+// on the older routes without it.
+func pathOrQueryId(c *gin.Context) string {
+	if id := c.Param("id"); id != "" {
+		return id
+	}
+	return c.Query("id")
+}
+
 func GetSecureFileByID(c *gin.Context) {
-	tokenIsValid := checkInvalidToken(c)
-	if !tokenIsValid {
+	principal, ok := getPrincipal(c)
+	if !ok {
 		log.Println("Token is invalid")
 		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
 		return
 	}
 	fileId := c.Param("id")
+	if !principal.CanAccessFile(fileId) {
+		log.Println("Access token is not allowed to use this file")
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.Forbidden})
+		return
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
-	secureFile, err := orms.GetSecureFileById(ctx, fileId)
+	secureFile, err := orms.GetAccessibleSecureFile(ctx, fileId, principal.UserId)
 	if err != nil {
 		log.Println("Could not find the file:", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
@@ -171,5 +247,62 @@ func GetSecureFileByID(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "File not found"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"success": false, "message": "Successfully fetched file", "data": secureFile})
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Successfully fetched file", "data": secureFile.Metadata()})
+}
+
+// storeInlineContent puts content sent in the JSON body into the blob store
+// under a new key and fills in the storage fields of secureFile.
+func storeInlineContent(ctx context.Context, c *gin.Context, secureFile *models.SecureFile, data []byte) bool {
+	if int64(len(data)) > utils.FileUploadMaxBytes() {
+		log.Println("Inline file content is too large")
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"success": false, "message": utils.ErrUploadTooLarge.Error()})
+		return false
+	}
+	storageKey := uuid.New().String()
+	encryption, err := envelope.Default.Put(ctx, storage.Default, storageKey, bytes.NewReader(data))
+	if err != nil {
+		log.Println("Could not store file content:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return false
+	}
+	secureFile.Encryption = encryption
+	secureFile.StorageKey = storageKey
+	secureFile.SizeBytes = int64(len(data))
+	secureFile.Sha256 = utils.ContentSha256(data)
+	return true
+}
+
+// respondContentError reports a failure to read stored content. Content
+// that does not decrypt has been tampered with and is reported as such.
+func respondContentError(c *gin.Context, err error) {
+	if errors.Is(err, envelope.ErrIntegrity) {
+		log.Println("Stored file content failed the integrity check")
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.FileIntegrityError})
+		return
+	}
+	log.Println("Could not read file content:", err)
+	c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+}
+
+// discardStoredContent removes content stored for a file that could not be
+// saved.
+func discardStoredContent(secureFile *models.SecureFile) {
+	if secureFile.StorageKey == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	if err := storage.Default.Delete(ctx, secureFile.StorageKey); err != nil {
+		log.Println("Could not remove stored content:", err)
+	}
+}
+
+func filterAccessibleFiles(principal *models.Principal, files []models.SecureFile) []models.SecureFile {
+	accessible := make([]models.SecureFile, 0, len(files))
+	for _, file := range files {
+		if principal.CanAccessFile(file.Id) {
+			accessible = append(accessible, file)
+		}
+	}
+	return accessible
 }
@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/subashshakya/SFSS/models"
+)
+
+func TestDeleteAnswersNotFoundForOtherUsersRows(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := useTestDatabase(t)
+	owner := models.User{FirstName: "Ada", LastName: "Owner", Email: "owner@example.com", Password: "x", PhoneNumber: "0"}
+	other := models.User{FirstName: "Eve", LastName: "Other", Email: "other@example.com", Password: "x", PhoneNumber: "0"}
+	for _, user := range []*models.User{&owner, &other} {
+		if err := db.Create(user).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	file := models.SecureFile{Id: uuid.New().String(), FileName: "a.txt", UserId: int(owner.Id)}
+	secret := models.SuperSecret{Id: uuid.New().String(), Secret: "s", UserId: owner.Id}
+	if err := db.Create(&file).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&secret).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.DELETE("/files/delete/:id", asUser(other.Id), DeleteFile)
+	router.DELETE("/files/delete", asUser(other.Id), DeleteFile)
+	router.DELETE("/secret/delete/:id", asUser(other.Id), DeleteSuperSecret)
+	router.DELETE("/secret/delete", asUser(other.Id), DeleteSuperSecret)
+
+	for _, target := range []string{
+		"/files/delete/" + file.Id,
+		"/files/delete?id=" + file.Id,
+		"/files/delete/" + uuid.New().String(),
+		"/secret/delete/" + secret.Id,
+		"/secret/delete?id=" + secret.Id,
+		"/secret/delete/" + uuid.New().String(),
+	} {
+		response := serve(router, httptest.NewRequest(http.MethodDelete, target, nil))
+		if response.Code != http.StatusNotFound {
+			t.Errorf("DELETE %s = %d, want 404", target, response.Code)
+		}
+	}
+
+	var files, secrets int64
+	db.Model(&models.SecureFile{}).Where("id = ?", file.Id).Count(&files)
+	db.Model(&models.SuperSecret{}).Where("id = ?", secret.Id).Count(&secrets)
+	if files != 1 || secrets != 1 {
+		t.Fatalf("files = %d, secrets = %d after deletes by another user", files, secrets)
+	}
+}
@@ -0,0 +1,21 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/utils"
+)
+
+func GetJWKS(c *gin.Context) {
+	keyring, err := utils.CurrentKeyring()
+	if err != nil {
+		log.Println("Could not load signing keys:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, keyring.JWKS())
+}
@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/db/orms"
+	"github.com/subashshakya/SFSS/mailer"
+	"github.com/subashshakya/SFSS/models"
+	"github.com/subashshakya/SFSS/notifier"
+	"github.com/subashshakya/SFSS/utils"
+)
+
+func GetLoginHistory(c *gin.Context) {
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println(constants.Unauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	limit, offset := pagination(c)
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	attempts, total, err := orms.GetLoginHistory(ctx, principal.UserId, limit, offset)
+	if err != nil {
+		log.Println("Could not fetch login history:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Successfully fetched login history", "data": attempts, "total": total})
+}
+
+// ConfirmSignInStepUp finishes a sign-in from a new device with the code that
+// was emailed to the user.
+func ConfirmSignInStepUp(c *gin.Context) {
+	var request models.StepUpRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		log.Println(constants.BadRequest, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+		return
+	}
+	if err := validate.Struct(&request); err != nil {
+		log.Println(constants.ValidationError, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.ValidationError})
+		return
+	}
+	userId, codeHash, err := utils.ParseStepUpToken(request.ChallengeToken, signInLocation(c))
+	if err != nil {
+		log.Println("Step-up token invalid:", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.InvalidStepUpCode})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	user, err := orms.GetUser(ctx, userId)
+	if err != nil {
+		log.Println("Step-up user not found:", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.InvalidStepUpCode})
+		return
+	}
+	if rejectIfLockedOut(ctx, c, user.Email) {
+		recordLoginAttempt(ctx, c, &user.Id, user.Email, constants.SignInMethodStepUp, constants.SignInLockedOut)
+		return
+	}
+	if rejectIfAccountBlocked(c, user) {
+		recordLoginAttempt(ctx, c, &user.Id, user.Email, constants.SignInMethodStepUp, constants.SignInAccountBlocked)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(utils.HashOpaqueToken(request.Code)), []byte(codeHash)) != 1 {
+		recordFailedSignIn(ctx, c, user.Email)
+		recordLoginAttempt(ctx, c, &user.Id, user.Email, constants.SignInMethodStepUp, constants.SignInStepUpFailed)
+		log.Println("Step-up code invalid")
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.InvalidStepUpCode})
+		return
+	}
+	used, err := orms.UseStepUpCode(ctx, codeHash, time.Now().Add(utils.StepUpTokenLifespan))
+	if err != nil {
+		log.Println("Could not use step-up code:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	if !used {
+		recordLoginAttempt(ctx, c, &user.Id, user.Email, constants.SignInMethodStepUp, constants.SignInStepUpFailed)
+		log.Println("Step-up code already used")
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.InvalidStepUpCode})
+		return
+	}
+	recordSuccessfulSignIn(ctx, user.Email)
+	// the user just confirmed this device by email, so it is not announced
+	// as a new one
+	recordLoginAttempt(ctx, c, &user.Id, user.Email, constants.SignInMethodStepUp, constants.SignInSucceeded)
+	token, refreshToken, err := issueTokenPair(ctx, c, user.Id)
+	if err != nil {
+		log.Println("Could not generate token:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Could not generate token"})
+		return
+	}
+	log.Println("Sign-In successful after step-up")
+	c.JSON(http.StatusAccepted, gin.H{"success": true, "message": "Sign-In Successful", "token": token, "refresh_token": refreshToken})
+}
+
+func signInLocation(c *gin.Context) string {
+	return c.ClientIP() + "\n" + c.Request.UserAgent()
+}
+
+func recordLoginAttempt(ctx context.Context, c *gin.Context, userId *uint, email string, method string, outcome string) {
+	attempt := models.LoginAttempt{
+		UserId:    userId,
+		Email:     email,
+		Method:    method,
+		Outcome:   outcome,
+		IpAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+	if err := orms.RecordLoginAttempt(ctx, &attempt); err != nil {
+		log.Println("Could not record login attempt:", err)
+	}
+}
+
+func isNewSignInLocation(ctx context.Context, c *gin.Context, userId uint) bool {
+	known, err := orms.IsKnownSignInLocation(ctx, userId, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		log.Println("Could not check sign-in location:", err)
+		return false
+	}
+	return !known
+}
+
+// noteSuccessfulSignIn records the sign-in and notifies the user when it came
+// from an IP address and user agent they have not signed in from before.
+func noteSuccessfulSignIn(ctx context.Context, c *gin.Context, user models.User, method string) {
+	isNew := isNewSignInLocation(ctx, c, user.Id)
+	recordLoginAttempt(ctx, c, &user.Id, user.Email, method, constants.SignInSucceeded)
+	if !isNew {
+		return
+	}
+	err := notifier.Default.Notify(ctx, notifier.Notification{
+		Kind:       notifier.KindNewSignIn,
+		UserId:     user.Id,
+		Email:      user.Email,
+		FirstName:  user.FirstName,
+		IpAddress:  c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+		OccurredAt: time.Now(),
+	})
+	if err != nil {
+		log.Println("Could not send sign-in notification:", err)
+	}
+}
+
+// requireStepUpForNewDevice holds back the tokens of a password sign-in from
+// a new device when SIGN_IN_STEP_UP is on, and emails a confirmation code
+// instead. It returns true if the response was written.
+func requireStepUpForNewDevice(ctx context.Context, c *gin.Context, user models.User) bool {
+	if !utils.SignInStepUpEnabled() || !isNewSignInLocation(ctx, c, user.Id) {
+		return false
+	}
+	code, codeHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		log.Println("Could not generate step-up code:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return true
+	}
+	challengeToken, err := utils.GenerateStepUpToken(user.Id, codeHash, signInLocation(c))
+	if err != nil {
+		log.Println("Could not generate step-up token:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Could not generate token"})
+		return true
+	}
+	link := fmt.Sprintf("%s/confirm_sign_in?code=%s", os.Getenv("APP_BASE_URL"), url.QueryEscape(code))
+	err = mailer.Default.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your SFSS sign-in",
+		Body:    fmt.Sprintf("Hi %s,\n\nSomeone signed in to your account from a new device (IP address %s). If it was you, open the link below on that device within 15 minutes to finish signing in.\n\n%s\n\nIf it was not you, change your password now.\n", user.FirstName, c.ClientIP(), link),
+	})
+	if err != nil {
+		log.Println("Could not send step-up email:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return true
+	}
+	recordLoginAttempt(ctx, c, &user.Id, user.Email, constants.SignInMethodPassword, constants.SignInStepUpRequired)
+	log.Println("Password step successful, step-up required for new device")
+	c.JSON(http.StatusAccepted, gin.H{"success": true, "message": constants.StepUpRequired, "step_up_required": true, "challenge_token": challengeToken})
+	return true
+}
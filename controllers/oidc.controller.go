@@ -0,0 +1,235 @@
+package controllers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/db/orms"
+	"github.com/subashshakya/SFSS/models"
+	"github.com/subashshakya/SFSS/oidc"
+	"github.com/subashshakya/SFSS/utils"
+)
+
+const oidcStateCookie = "sfss_oidc"
+const oidcStateCookiePath = "/user/oidc"
+
+func OIDCLogin(c *gin.Context) {
+	authorizationURL, ok := startOIDCLogin(c, 0)
+	if !ok {
+		return
+	}
+	c.Redirect(http.StatusFound, authorizationURL)
+}
+
+// LinkOIDCIdentity starts a login at the identity provider whose callback
+// links the identity to the signed-in user. The client navigates to the
+// returned URL in the browser that received the state cookie.
+func LinkOIDCIdentity(c *gin.Context) {
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println(constants.Unauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	authorizationURL, ok := startOIDCLogin(c, principal.UserId)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Continue at the identity provider", "data": gin.H{"authorization_url": authorizationURL}})
+}
+
+// startOIDCLogin sets the state cookie and returns the authorization URL, or
+// writes the response when the login cannot start.
+func startOIDCLogin(c *gin.Context, linkUserId uint) (string, bool) {
+	provider := oidc.Default
+	if provider == nil {
+		log.Println(oidc.ErrNotConfigured)
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": constants.NotFound})
+		return "", false
+	}
+	state, stateErr := oidc.RandomString()
+	nonce, nonceErr := oidc.RandomString()
+	codeVerifier, verifierErr := oidc.RandomString()
+	if err := errors.Join(stateErr, nonceErr, verifierErr); err != nil {
+		log.Println("Could not generate OIDC state:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return "", false
+	}
+	stateToken, err := utils.GenerateOIDCStateToken(utils.OIDCState{State: state, Nonce: nonce, CodeVerifier: codeVerifier, LinkUserId: linkUserId})
+	if err != nil {
+		log.Println("Could not sign OIDC state:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return "", false
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, stateToken, 600, oidcStateCookiePath, "", c.Request.TLS != nil, true)
+	return provider.AuthCodeURL(state, nonce, oidc.CodeChallengeS256(codeVerifier)), true
+}
+
+func OIDCCallback(c *gin.Context) {
+	provider := oidc.Default
+	if provider == nil {
+		log.Println(oidc.ErrNotConfigured)
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": constants.NotFound})
+		return
+	}
+	stateToken, err := c.Cookie(oidcStateCookie)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, "", -1, oidcStateCookiePath, "", c.Request.TLS != nil, true)
+	if err != nil {
+		log.Println("OIDC state cookie missing:", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+		return
+	}
+	if errorCode := c.Query("error"); errorCode != "" {
+		log.Println("Identity provider returned an error:", errorCode, c.Query("error_description"))
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	oidcState, err := utils.ParseOIDCStateToken(stateToken)
+	if err != nil || subtle.ConstantTimeCompare([]byte(oidcState.State), []byte(c.Query("state"))) != 1 {
+		log.Println("OIDC state mismatch:", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+		return
+	}
+	code := c.Query("code")
+	if code == "" {
+		log.Println("OIDC callback without code")
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.LongTimeout)
+	defer cancel()
+	tokens, err := provider.Exchange(ctx, code, oidcState.CodeVerifier)
+	if err != nil {
+		log.Println("Could not exchange authorization code:", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	claims, err := provider.VerifyIDToken(ctx, tokens.IDToken, oidcState.Nonce)
+	if err != nil {
+		log.Println("ID token rejected:", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	if claims.Email == "" {
+		log.Println("ID token has no email claim")
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	identity := models.UserIdentity{Issuer: claims.Issuer, Subject: claims.Subject, Email: claims.Email}
+	if oidcState.LinkUserId != 0 {
+		linkIdentity(ctx, c, &identity, oidcState.LinkUserId)
+		return
+	}
+	newUser, err := newUserFromIDToken(claims)
+	if err != nil {
+		log.Println("Could not prepare user:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	user, err := orms.ResolveExternalIdentity(ctx, &identity, claims.EmailVerified, newUser)
+	if errors.Is(err, orms.ErrIdentityLinkRequired) {
+		log.Println(err)
+		c.JSON(http.StatusConflict, gin.H{"success": false, "message": constants.IdentityLinkRequired})
+		return
+	}
+	if err != nil {
+		log.Println("Could not link identity:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	if rejectIfAccountBlocked(c, user) {
+		recordLoginAttempt(ctx, c, &user.Id, user.Email, constants.SignInMethodOIDC, constants.SignInAccountBlocked)
+		return
+	}
+	if user.TotpEnabled {
+		challengeToken, err := utils.GenerateChallengeToken(user.Id)
+		if err != nil {
+			log.Println("Could not generate token:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Could not generate token"})
+			return
+		}
+		recordLoginAttempt(ctx, c, &user.Id, user.Email, constants.SignInMethodOIDC, constants.SignInMfaRequired)
+		c.JSON(http.StatusAccepted, gin.H{"success": true, "message": "Two-factor code required", "mfa_required": true, "challenge_token": challengeToken})
+		return
+	}
+	noteSuccessfulSignIn(ctx, c, user, constants.SignInMethodOIDC)
+	token, refreshToken, err := issueTokenPair(ctx, c, user.Id)
+	if err != nil {
+		log.Println("Could not generate token:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Could not generate token"})
+		return
+	}
+	log.Println("Sign-In successful")
+	c.JSON(http.StatusAccepted, gin.H{"success": true, "message": "Sign-In Successful", "token": token, "refresh_token": refreshToken})
+}
+
+// linkIdentity finishes a login started by LinkOIDCIdentity. The user still
+// has to be allowed to sign in, since the link outlives the session that
+// asked for it.
+func linkIdentity(ctx context.Context, c *gin.Context, identity *models.UserIdentity, userId uint) {
+	user, err := orms.GetUser(ctx, userId)
+	if err != nil {
+		log.Println("Could not find the user linking an identity:", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	if user.DisabledAt.Valid {
+		log.Println("Disabled user tried to link an identity", user.Id)
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.AccountDisabled})
+		return
+	}
+	err = orms.LinkExternalIdentity(ctx, identity, user.Id)
+	if errors.Is(err, orms.ErrIdentityLinkedElsewhere) {
+		log.Println(err)
+		c.JSON(http.StatusConflict, gin.H{"success": false, "message": constants.IdentityLinkedElsewhere})
+		return
+	}
+	if err != nil {
+		log.Println("Could not link identity:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	log.Println("Identity linked for user", user.Id)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Identity provider linked to your account"})
+}
+
+// newUserFromIDToken builds the account created on first SSO login. It gets
+// an unguessable password so only the provider can sign it in until the user
+// resets it.
+func newUserFromIDToken(claims *oidc.IDTokenClaims) (*models.User, error) {
+	randomPassword, err := oidc.RandomString()
+	if err != nil {
+		return nil, err
+	}
+	passwordHash, err := utils.HashPassword(randomPassword)
+	if err != nil {
+		return nil, err
+	}
+	firstName, lastName := claims.GivenName, claims.FamilyName
+	if firstName == "" && lastName == "" {
+		firstName, lastName, _ = strings.Cut(claims.Name, " ")
+	}
+	if firstName == "" {
+		firstName, _, _ = strings.Cut(claims.Email, "@")
+	}
+	user := &models.User{
+		FirstName: firstName,
+		LastName:  lastName,
+		Email:     claims.Email,
+		Password:  passwordHash,
+	}
+	if claims.EmailVerified {
+		user.EmailVerifiedAt.Time = time.Now()
+		user.EmailVerifiedAt.Valid = true
+	}
+	return user, nil
+}
@@ -0,0 +1,219 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/models"
+	"github.com/subashshakya/SFSS/oidc"
+	"github.com/subashshakya/SFSS/oidc/oidctest"
+)
+
+const oidcTestRedirectURL = "http://sfss.test/user/oidc/callback"
+
+var grace = oidctest.User{Subject: "grace-1", Email: "grace@example.com", EmailVerified: true, GivenName: "Grace", FamilyName: "Hopper"}
+
+// useOIDCProvider makes an in-process identity provider the configured one.
+func useOIDCProvider(t *testing.T, user oidctest.User) *oidctest.Server {
+	t.Helper()
+	server, err := oidctest.NewServer("sfss", user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	provider, err := oidc.Discover(context.Background(), oidc.Config{IssuerURL: server.URL, ClientID: "sfss", RedirectURL: oidcTestRedirectURL}, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := oidc.Default
+	oidc.Default = provider
+	t.Cleanup(func() { oidc.Default = previous })
+	return server
+}
+
+func oidcRouter(linkUserId uint) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/user/oidc/login", OIDCLogin)
+	router.GET("/user/oidc/callback", OIDCCallback)
+	router.POST("/user/oidc/link", asUser(linkUserId), LinkOIDCIdentity)
+	return router
+}
+
+// completeOIDCLogin takes the authorization URL and state cookie a login
+// started with through the provider and back to the callback.
+func completeOIDCLogin(t *testing.T, router *gin.Engine, server *oidctest.Server, authorizationURL string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+	client := server.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	response, err := client.Get(authorizationURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	callback, err := url.Parse(response.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := httptest.NewRequest(http.MethodGet, callback.RequestURI(), nil)
+	request.AddCookie(cookie)
+	return serve(router, request)
+}
+
+func startOIDCSignIn(t *testing.T, router *gin.Engine) (string, *http.Cookie) {
+	t.Helper()
+	recorder := serve(router, httptest.NewRequest(http.MethodGet, "/user/oidc/login", nil))
+	if recorder.Code != http.StatusFound {
+		t.Fatalf("login status = %d", recorder.Code)
+	}
+	return recorder.Header().Get("Location"), stateCookie(t, recorder)
+}
+
+func stateCookie(t *testing.T, recorder *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+	for _, cookie := range recorder.Result().Cookies() {
+		if cookie.Name == oidcStateCookie {
+			return cookie
+		}
+	}
+	t.Fatal("no OIDC state cookie was set")
+	return nil
+}
+
+func responseMessage(t *testing.T, recorder *httptest.ResponseRecorder) string {
+	t.Helper()
+	var body struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response %q: %v", recorder.Body.String(), err)
+	}
+	return body.Message
+}
+
+func TestOIDCCallbackRejectsMissingOrForeignState(t *testing.T) {
+	server := useOIDCProvider(t, grace)
+	router := oidcRouter(0)
+	authorizationURL, _ := startOIDCSignIn(t, router)
+
+	recorder := completeOIDCLogin(t, router, server, authorizationURL, &http.Cookie{Name: "unrelated", Value: "x"})
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("without the state cookie: status = %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+
+	_, otherCookie := startOIDCSignIn(t, router)
+	recorder = completeOIDCLogin(t, router, server, authorizationURL, otherCookie)
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("with another login's cookie: status = %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+}
+
+func TestLinkOIDCIdentityNeedsProvider(t *testing.T) {
+	previous := oidc.Default
+	oidc.Default = nil
+	t.Cleanup(func() { oidc.Default = previous })
+	recorder := serve(oidcRouter(1), httptest.NewRequest(http.MethodPost, "/user/oidc/link", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", recorder.Code, http.StatusNotFound)
+	}
+}
+
+func TestOIDCCallbackCreatesAndReusesAccount(t *testing.T) {
+	db := useTestDatabase(t)
+	server := useOIDCProvider(t, grace)
+	router := oidcRouter(0)
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		authorizationURL, cookie := startOIDCSignIn(t, router)
+		recorder := completeOIDCLogin(t, router, server, authorizationURL, cookie)
+		if recorder.Code != http.StatusAccepted {
+			t.Fatalf("sign-in %d: status = %d, body %s", attempt, recorder.Code, recorder.Body.String())
+		}
+	}
+	var users []models.User
+	db.Find(&users)
+	if len(users) != 1 || users[0].Email != grace.Email || !users[0].EmailVerifiedAt.Valid {
+		t.Fatalf("users = %+v", users)
+	}
+	var identities []models.UserIdentity
+	db.Find(&identities)
+	if len(identities) != 1 || identities[0].UserId != users[0].Id || identities[0].Subject != grace.Subject {
+		t.Fatalf("identities = %+v", identities)
+	}
+}
+
+func TestOIDCCallbackLinksOnlyThroughExplicitLink(t *testing.T) {
+	db := useTestDatabase(t)
+	server := useOIDCProvider(t, grace)
+	existing := createTestUser(t, db, grace.Email, false)
+
+	signIn := oidcRouter(0)
+	authorizationURL, cookie := startOIDCSignIn(t, signIn)
+	recorder := completeOIDCLogin(t, signIn, server, authorizationURL, cookie)
+	if recorder.Code != http.StatusConflict || responseMessage(t, recorder) != constants.IdentityLinkRequired {
+		t.Fatalf("sign-in onto an unverified account: status = %d, body %s", recorder.Code, recorder.Body.String())
+	}
+
+	link := oidcRouter(existing.Id)
+	recorder = serve(link, httptest.NewRequest(http.MethodPost, "/user/oidc/link", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("link status = %d", recorder.Code)
+	}
+	var body struct {
+		Data struct {
+			AuthorizationURL string `json:"authorization_url"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	recorder = completeOIDCLogin(t, link, server, body.Data.AuthorizationURL, stateCookie(t, recorder))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("link callback status = %d, body %s", recorder.Code, recorder.Body.String())
+	}
+
+	authorizationURL, cookie = startOIDCSignIn(t, signIn)
+	recorder = completeOIDCLogin(t, signIn, server, authorizationURL, cookie)
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("sign-in after linking: status = %d, body %s", recorder.Code, recorder.Body.String())
+	}
+	var identity models.UserIdentity
+	if err := db.Where("subject = ?", grace.Subject).First(&identity).Error; err != nil {
+		t.Fatal(err)
+	}
+	if identity.UserId != existing.Id {
+		t.Errorf("identity linked to user %d, want %d", identity.UserId, existing.Id)
+	}
+}
+
+func TestOIDCLinkRejectsIdentityOfAnotherAccount(t *testing.T) {
+	db := useTestDatabase(t)
+	server := useOIDCProvider(t, grace)
+	signIn := oidcRouter(0)
+	authorizationURL, cookie := startOIDCSignIn(t, signIn)
+	if recorder := completeOIDCLogin(t, signIn, server, authorizationURL, cookie); recorder.Code != http.StatusAccepted {
+		t.Fatalf("sign-in status = %d", recorder.Code)
+	}
+
+	other := createTestUser(t, db, "other@example.com", true)
+	link := oidcRouter(other.Id)
+	recorder := serve(link, httptest.NewRequest(http.MethodPost, "/user/oidc/link", nil))
+	var body struct {
+		Data struct {
+			AuthorizationURL string `json:"authorization_url"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	recorder = completeOIDCLogin(t, link, server, body.Data.AuthorizationURL, stateCookie(t, recorder))
+	if recorder.Code != http.StatusConflict || responseMessage(t, recorder) != constants.IdentityLinkedElsewhere {
+		t.Fatalf("status = %d, body %s", recorder.Code, recorder.Body.String())
+	}
+}
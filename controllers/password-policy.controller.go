@@ -0,0 +1,28 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/passwordpolicy"
+)
+
+// rejectWeakPassword writes a 400 listing every failed rule when password
+// does not meet the policy. userInputs are the account's email and names. It
+// returns true if the request was rejected.
+func rejectWeakPassword(c *gin.Context, password string, userInputs ...string) bool {
+	violations, err := passwordpolicy.Default.Check(password, userInputs...)
+	if err != nil {
+		log.Println("Could not check password policy:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return true
+	}
+	if len(violations) == 0 {
+		return false
+	}
+	log.Println("Password rejected by policy:", len(violations), "rules failed")
+	c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.PasswordPolicyViolation, "errors": violations})
+	return true
+}
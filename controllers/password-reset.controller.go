@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/db/orms"
+	"github.com/subashshakya/SFSS/mailer"
+	"github.com/subashshakya/SFSS/models"
+	"github.com/subashshakya/SFSS/throttle"
+	"github.com/subashshakya/SFSS/utils"
+)
+
+const passwordResetTokenLifespan = time.Minute * 30
+
+func ForgotPassword(c *gin.Context) {
+	var request models.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		log.Println(constants.BadRequest, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+		return
+	}
+	if err := validate.Struct(&request); err != nil {
+		log.Println(constants.ValidationError, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.ValidationError})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	if rejectIfLockedOut(ctx, c, request.Email) ||
+		rejectIfRateLimited(ctx, c, "password_reset:ip:"+c.ClientIP(), throttle.PasswordResetIPPolicy) ||
+		rejectIfRateLimited(ctx, c, "password_reset:email:"+strings.ToLower(request.Email), throttle.PasswordResetEmailPolicy) {
+		return
+	}
+	// the lookup runs on the mail queue so that the response time does not
+	// reveal whether the account exists
+	queuePasswordResetEmail(request.Email)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": constants.PasswordResetRequested})
+}
+
+func queuePasswordResetEmail(email string) {
+	mailer.Background.Enqueue(func(ctx context.Context) {
+		sendPasswordResetEmail(ctx, email)
+	})
+}
+
+func sendPasswordResetEmail(ctx context.Context, email string) {
+	ctx, cancel := context.WithTimeout(ctx, constants.LongTimeout)
+	defer cancel()
+	user, err := orms.GetUserByEmail(ctx, email)
+	if err != nil {
+		log.Println("Could not look up user for password reset:", err)
+		return
+	}
+	if user == nil {
+		return
+	}
+	token, tokenHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		log.Println("Could not generate reset token:", err)
+		return
+	}
+	resetToken := models.PasswordResetToken{
+		UserId:    user.Id,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(passwordResetTokenLifespan),
+	}
+	if err := orms.CreatePasswordResetToken(ctx, &resetToken); err != nil {
+		log.Println("Could not save reset token:", err)
+		return
+	}
+	link := fmt.Sprintf("%s/reset_password?token=%s", os.Getenv("APP_BASE_URL"), url.QueryEscape(token))
+	err = mailer.Default.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your SFSS password",
+		Body:    fmt.Sprintf("Hi %s,\n\nA password reset was requested for your account. Open the link below within 30 minutes to choose a new password.\n\n%s\n\nIf you did not ask for this you can ignore this email.\n", user.FirstName, link),
+	})
+	if err != nil {
+		log.Println("Could not send reset email:", err)
+	}
+}
+
+func ResetPassword(c *gin.Context) {
+	var request models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		log.Println(constants.BadRequest, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+		return
+	}
+	if err := validate.Struct(&request); err != nil {
+		log.Println(constants.ValidationError, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.ValidationError})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	tokenHash := utils.HashOpaqueToken(request.Token)
+	user, err := orms.GetPasswordResetUser(ctx, tokenHash)
+	if err != nil {
+		log.Println("Could not look up reset token:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	if user == nil {
+		log.Println("Reset token rejected")
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.InvalidResetToken})
+		return
+	}
+	if rejectWeakPassword(c, request.NewPassword, user.Email, user.FirstName, user.LastName) {
+		return
+	}
+	passwordHash, err := utils.HashPassword(request.NewPassword)
+	if err != nil {
+		log.Println("Could not hash password:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	userId, err := orms.ResetPassword(ctx, tokenHash, passwordHash)
+	if errors.Is(err, orms.ErrResetTokenInvalid) {
+		log.Println("Reset token rejected")
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.InvalidResetToken})
+		return
+	}
+	if err != nil {
+		log.Println("Could not reset password:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	log.Println("Password reset for user", userId)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Password has been reset, please sign in again"})
+}
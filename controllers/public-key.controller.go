@@ -0,0 +1,202 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/db/orms"
+	"github.com/subashshakya/SFSS/models"
+	"github.com/subashshakya/SFSS/utils"
+)
+
+func RegisterPublicKey(c *gin.Context) {
+	var request models.RegisterPublicKeyRequest
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println(constants.Unauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		log.Println(constants.BadRequest, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+		return
+	}
+	if err := validate.Struct(&request); err != nil {
+		log.Println(constants.ValidationError, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.ValidationError})
+		return
+	}
+	raw, err := utils.DecodePublicKey(request.Algorithm, request.PublicKey)
+	if err != nil {
+		log.Println("Invalid public key:", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.ValidationError})
+		return
+	}
+	fingerprint := utils.KeyFingerprint(raw)
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	signingKey := raw
+	var signedById *uint
+	if request.Algorithm == constants.KeyAlgorithmX25519 {
+		signer, err := orms.GetActiveUserPublicKey(ctx, principal.UserId, *request.SignedById)
+		if err != nil {
+			log.Println("Could not fetch signing key:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+			return
+		}
+		if signer == nil || signer.Algorithm != constants.KeyAlgorithmEd25519 {
+			log.Println("Signing key is not an active Ed25519 key of the user")
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.InvalidKeyCertification})
+			return
+		}
+		signingKey, err = utils.DecodePublicKey(signer.Algorithm, signer.PublicKey)
+		if err != nil {
+			log.Println("Stored signing key is invalid:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+			return
+		}
+		signedById = &signer.Id
+	}
+	message := utils.KeyCertificationMessage(principal.UserId, request.Algorithm, fingerprint)
+	if !utils.VerifyKeyCertification(signingKey, message, request.Signature) {
+		log.Println("Key certification signature did not verify")
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.InvalidKeyCertification})
+		return
+	}
+	publicKey := models.UserPublicKey{
+		UserId:      principal.UserId,
+		Algorithm:   request.Algorithm,
+		PublicKey:   request.PublicKey,
+		Fingerprint: fingerprint,
+		Signature:   request.Signature,
+		SignedById:  signedById,
+	}
+	err = orms.CreateUserPublicKey(ctx, &publicKey)
+	if errors.Is(err, orms.ErrPublicKeyExists) {
+		log.Println("Public key already registered")
+		c.JSON(http.StatusConflict, gin.H{"success": false, "message": "Public key is already registered"})
+		return
+	}
+	if errors.Is(err, orms.ErrTooManyPublicKeys) {
+		log.Println("Too many active public keys")
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"success": false, "message": "Retire an existing key before adding another"})
+		return
+	}
+	if err != nil {
+		log.Println("Could not save public key:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"success": true, "message": "Public key registered", "data": publicKey})
+}
+
+func GetPublicKeys(c *gin.Context) {
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println(constants.Unauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	includeRetired := c.Query("include_retired") == "true"
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	keys, err := orms.GetPublicKeysOfAUser(ctx, principal.UserId, includeRetired)
+	if err != nil {
+		log.Println("Could not fetch public keys:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Successfully fetched public keys", "data": keys})
+}
+
+func RetirePublicKey(c *gin.Context) {
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println(constants.Unauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	keyId, ok := parseIdParam(c, "id")
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	retired, err := orms.RetireUserPublicKey(ctx, principal.UserId, keyId)
+	if err != nil {
+		log.Println("Could not retire public key:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	if !retired {
+		log.Println("Public key not found")
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": constants.NotFound})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Public key retired"})
+}
+
+// LookupRecipientKeys returns the active keys of a recipient, looked up by
+// user_id or email, so the caller can encrypt to them before sharing.
+func LookupRecipientKeys(c *gin.Context) {
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println(constants.Unauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	var recipient *models.User
+	switch {
+	case c.Query("user_id") != "":
+		userId, err := strconv.ParseUint(c.Query("user_id"), 10, 0)
+		if err != nil || userId == 0 {
+			log.Println("Could not parse user id:", err)
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+			return
+		}
+		user, err := orms.FindDirectoryUserById(ctx, principal.UserId, uint(userId))
+		if err != nil {
+			log.Println("Could not look up recipient:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+			return
+		}
+		recipient = user
+	case c.Query("email") != "":
+		if err := validate.Var(c.Query("email"), "email"); err != nil {
+			log.Println(constants.ValidationError, err)
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.ValidationError})
+			return
+		}
+		user, err := orms.FindDirectoryUserByEmail(ctx, principal.UserId, c.Query("email"))
+		if err != nil {
+			log.Println("Could not look up recipient:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+			return
+		}
+		recipient = user
+	default:
+		log.Println("Lookup without user_id or email")
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+		return
+	}
+	if recipient == nil || recipient.DisabledAt.Valid {
+		log.Println("Recipient not found")
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": constants.NotFound})
+		return
+	}
+	keys, err := orms.GetPublicKeysOfAUser(ctx, recipient.Id, false)
+	if err != nil {
+		log.Println("Could not fetch public keys:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Successfully fetched recipient keys", "data": models.RecipientKeys{UserId: recipient.Id, Keys: keys}})
+}
@@ -0,0 +1,311 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/db/orms"
+	"github.com/subashshakya/SFSS/envelope"
+	"github.com/subashshakya/SFSS/jobs"
+	"github.com/subashshakya/SFSS/models"
+	"github.com/subashshakya/SFSS/storage"
+	"github.com/subashshakya/SFSS/utils"
+)
+
+// GetUploadOptions answers tus discovery requests.
+func GetUploadOptions(c *gin.Context) {
+	c.Header("Tus-Version", constants.TusVersion)
+	c.Header("Tus-Extension", constants.TusExtensions)
+	c.Header("Tus-Max-Size", strconv.FormatInt(utils.FileUploadMaxBytes(), 10))
+	c.Header(constants.HeaderUploadMinChunk, strconv.FormatInt(utils.FileUploadMinChunkBytes(), 10))
+	c.Status(http.StatusNoContent)
+}
+
+// CreateUpload starts a resumable upload. The file name, content type and
+// team come from the filename, filetype and team_id metadata.
+func CreateUpload(c *gin.Context) {
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println(constants.Unauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	if !principal.CanCreateFiles() {
+		log.Println("Access token is restricted to existing files")
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.Forbidden})
+		return
+	}
+	length, err := strconv.ParseInt(c.GetHeader(constants.HeaderUploadLength), 10, 64)
+	if err != nil || length < 0 {
+		log.Println("Upload-Length is missing or invalid")
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+		return
+	}
+	if length > utils.FileUploadMaxBytes() {
+		log.Println("Upload-Length exceeds the maximum size")
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"success": false, "message": utils.ErrUploadTooLarge.Error()})
+		return
+	}
+	metadata, err := parseUploadMetadata(c.GetHeader(constants.HeaderUploadMeta))
+	if err != nil {
+		log.Println("Upload-Metadata is invalid:", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+		return
+	}
+	upload := models.FileUpload{
+		Id:          uuid.New().String(),
+		UserId:      principal.UserId,
+		FileName:    cleanFileName(firstNonEmpty(metadata["filename"], metadata["name"])),
+		ContentType: firstNonEmpty(metadata["filetype"], metadata["type"], defaultContentType),
+		Length:      length,
+		ExpiresAt:   time.Now().Add(utils.FileUploadExpiry()),
+	}
+	if upload.FileName == "" {
+		log.Println("Upload without a file name")
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "A file name is required"})
+		return
+	}
+	if teamId := metadata["team_id"]; teamId != "" {
+		var secureFile models.SecureFile
+		if !setUploadTeam(c, &secureFile, teamId) {
+			return
+		}
+		upload.TeamId = secureFile.TeamId
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	if !canCreateTeamItem(ctx, c, upload.TeamId, principal.UserId) {
+		return
+	}
+	if err := orms.CreateFileUpload(ctx, &upload); err != nil {
+		log.Println("Could not create upload:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	c.Header("Location", "/files/uploads/"+upload.Id)
+	c.Header(constants.HeaderUploadExpiry, upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusCreated)
+}
+
+// GetUploadOffset tells the client where to resume. Once all chunks have
+// arrived and the upload was assembled, Upload-File-Id names the new file.
+func GetUploadOffset(c *gin.Context) {
+	upload, ok := findUpload(c)
+	if !ok {
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	setUploadHeaders(c, upload)
+	c.Header(constants.HeaderUploadLength, strconv.FormatInt(upload.Length, 10))
+	c.Status(http.StatusOK)
+}
+
+// PatchUpload appends a chunk at Upload-Offset. Every chunk but the last must
+// be at least FileUploadMinChunkBytes long. Once the upload is complete a
+// background job turns it into a SecureFile.
+func PatchUpload(c *gin.Context) {
+	if c.ContentType() != constants.TusContentType {
+		log.Println("PATCH with content type", c.ContentType())
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"success": false, "message": constants.BadRequest})
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader(constants.HeaderUploadOffset), 10, 64)
+	if err != nil || offset < 0 {
+		log.Println("Upload-Offset is missing or invalid")
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+		return
+	}
+	upload, ok := findUpload(c)
+	if !ok {
+		return
+	}
+	if offset != upload.Offset {
+		log.Println("Upload-Offset", offset, "does not match", upload.Offset)
+		c.JSON(http.StatusConflict, gin.H{"success": false, "message": constants.UploadOffsetMismatch})
+		return
+	}
+	if upload.Offset < upload.Length {
+		principal, _ := getPrincipal(c)
+		ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+		allowed := canCreateTeamItem(ctx, c, upload.TeamId, principal.UserId)
+		cancel()
+		if !allowed || !appendUploadChunk(c, upload) {
+			return
+		}
+	}
+	if upload.Offset == upload.Length && upload.FileId == nil {
+		jobs.WakeUploadAssembly()
+	}
+	setUploadHeaders(c, upload)
+	c.Status(http.StatusNoContent)
+}
+
+// DeleteUpload terminates an upload and discards what was received.
+func DeleteUpload(c *gin.Context) {
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println(constants.Unauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	deleted, err := orms.DeleteFileUpload(ctx, c.Param("uploadId"), principal.UserId)
+	if err != nil {
+		log.Println("Could not delete upload:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": constants.UploadNotFound})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// appendUploadChunk stores the request body as the next part of the upload
+// and advances upload to the new offset.
+func appendUploadChunk(c *gin.Context, upload *models.FileUpload) bool {
+	remaining := upload.Length - upload.Offset
+	if c.Request.ContentLength > remaining {
+		log.Println("Chunk runs past Upload-Length")
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"success": false, "message": utils.ErrUploadTooLarge.Error()})
+		return false
+	}
+	minChunk := min(utils.FileUploadMinChunkBytes(), remaining)
+	if c.Request.ContentLength >= 0 && c.Request.ContentLength < minChunk {
+		log.Println("Chunk of", c.Request.ContentLength, "bytes is below the minimum chunk size")
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.UploadChunkTooSmall})
+		return false
+	}
+	hashingReader, err := utils.ResumeHashingReader(c.Request.Body, remaining, upload.HashState)
+	if err != nil {
+		log.Println("Could not resume upload hash:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return false
+	}
+	part := models.FileUploadPart{UploadId: upload.Id, Offset: upload.Offset, StorageKey: uuid.New().String()}
+	part.Encryption, err = envelope.Default.Put(c.Request.Context(), storage.Default, part.StorageKey, hashingReader)
+	if errors.Is(err, utils.ErrUploadTooLarge) {
+		log.Println("Chunk runs past Upload-Length")
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"success": false, "message": utils.ErrUploadTooLarge.Error()})
+		return false
+	}
+	if err != nil {
+		log.Println("Could not store upload chunk:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return false
+	}
+	part.SizeBytes = hashingReader.Size()
+	if part.SizeBytes < minChunk {
+		log.Println("Chunk of", part.SizeBytes, "bytes is below the minimum chunk size")
+		discardStoredContent(&models.SecureFile{StorageKey: part.StorageKey})
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.UploadChunkTooSmall})
+		return false
+	}
+	fromOffset := upload.Offset
+	upload.Offset += part.SizeBytes
+	upload.ExpiresAt = time.Now().Add(utils.FileUploadExpiry())
+	if upload.HashState, err = hashingReader.State(); err != nil {
+		log.Println("Could not save upload hash:", err)
+		discardStoredContent(&models.SecureFile{StorageKey: part.StorageKey})
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	added, err := orms.AddFileUploadPart(ctx, upload, fromOffset, &part)
+	if err != nil || !added {
+		discardStoredContent(&models.SecureFile{StorageKey: part.StorageKey})
+	}
+	if err != nil {
+		log.Println("Could not save upload chunk:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return false
+	}
+	if !added {
+		log.Println("Upload moved on while the chunk was stored")
+		c.JSON(http.StatusConflict, gin.H{"success": false, "message": constants.UploadOffsetMismatch})
+		return false
+	}
+	return true
+}
+
+// findUpload loads the upload named in the path for the caller and writes
+// the response when there is none.
+func findUpload(c *gin.Context) (*models.FileUpload, bool) {
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println(constants.Unauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return nil, false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	upload, err := orms.GetFileUpload(ctx, c.Param("uploadId"), principal.UserId)
+	if err != nil {
+		log.Println("Could not load upload:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return nil, false
+	}
+	if upload == nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": constants.UploadNotFound})
+		return nil, false
+	}
+	if !upload.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusGone, gin.H{"success": false, "message": constants.UploadExpired})
+		return nil, false
+	}
+	return upload, true
+}
+
+func setUploadHeaders(c *gin.Context, upload *models.FileUpload) {
+	c.Header(constants.HeaderUploadOffset, strconv.FormatInt(upload.Offset, 10))
+	c.Header(constants.HeaderUploadExpiry, upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	if upload.FileId != nil {
+		c.Header(constants.HeaderUploadFileId, *upload.FileId)
+	}
+}
+
+// parseUploadMetadata decodes Upload-Metadata, comma separated pairs of a
+// key and a base64 value. The value may be left out.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, errors.New("malformed pair")
+		}
+		value := ""
+		if len(fields) == 2 {
+			decoded, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				return nil, err
+			}
+			value = string(decoded)
+		}
+		metadata[fields[0]] = value
+	}
+	return metadata, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/envelope"
+	"github.com/subashshakya/SFSS/jobs"
+	"github.com/subashshakya/SFSS/models"
+	"github.com/subashshakya/SFSS/storage"
+)
+
+func TestParseUploadMetadata(t *testing.T) {
+	encode := func(value string) string { return base64.StdEncoding.EncodeToString([]byte(value)) }
+	metadata, err := parseUploadMetadata("filename " + encode("report.pdf") + ", filetype " + encode("application/pdf") + ",is_confidential")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"filename": "report.pdf", "filetype": "application/pdf", "is_confidential": ""}
+	if len(metadata) != len(want) {
+		t.Fatalf("metadata = %v", metadata)
+	}
+	for key, value := range want {
+		if metadata[key] != value {
+			t.Errorf("metadata[%q] = %q, want %q", key, metadata[key], value)
+		}
+	}
+	for _, header := range []string{"filename not-base64!", "a b c", "filename " + encode("x") + ",,"} {
+		if _, err := parseUploadMetadata(header); err == nil {
+			t.Errorf("parseUploadMetadata(%q) succeeded", header)
+		}
+	}
+}
+
+// useTestStorage stores blobs in a temporary directory, encrypted, for the
+// duration of the test.
+func useTestStorage(t *testing.T) {
+	t.Helper()
+	previousStore, previousKeyring := storage.Default, envelope.Default
+	storage.Default = &storage.LocalStore{Dir: t.TempDir()}
+	key := make([]byte, 32)
+	rand.Read(key)
+	envelope.Default = &envelope.Keyring{Active: "test", Keys: map[string][]byte{"test": key}}
+	t.Cleanup(func() { storage.Default, envelope.Default = previousStore, previousKeyring })
+}
+
+func uploadRouter(userId uint) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	uploads := router.Group("/files/uploads", asUser(userId))
+	uploads.POST("", CreateUpload)
+	uploads.HEAD("/:uploadId", GetUploadOffset)
+	uploads.PATCH("/:uploadId", PatchUpload)
+	uploads.DELETE("/:uploadId", DeleteUpload)
+	return router
+}
+
+func patchChunk(router *gin.Engine, location string, offset int, chunk []byte) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPatch, location, bytes.NewReader(chunk))
+	request.Header.Set("Content-Type", constants.TusContentType)
+	request.Header.Set(constants.HeaderUploadOffset, strconv.Itoa(offset))
+	return serve(router, request)
+}
+
+// assembleUploadsInBackground runs the upload assembly job until the test
+// ends.
+func assembleUploadsInBackground(t *testing.T) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		jobs.RunUploadAssembly(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestResumableUploadFlow(t *testing.T) {
+	db := useTestDatabase(t)
+	useTestStorage(t)
+	t.Setenv("FILE_UPLOAD_MIN_CHUNK_BYTES", "300")
+	assembleUploadsInBackground(t)
+	user := createTestUser(t, db, "ada@example.com", true)
+	router := uploadRouter(user.Id)
+	content := make([]byte, 1000)
+	rand.Read(content)
+
+	create := httptest.NewRequest(http.MethodPost, "/files/uploads", nil)
+	create.Header.Set(constants.HeaderUploadLength, strconv.Itoa(len(content)))
+	create.Header.Set(constants.HeaderUploadMeta, "filename "+base64.StdEncoding.EncodeToString([]byte("notes.txt")))
+	recorder := serve(router, create)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("create status = %d, body %s", recorder.Code, recorder.Body.String())
+	}
+	location := recorder.Header().Get("Location")
+
+	offset := func() string {
+		recorder := serve(router, httptest.NewRequest(http.MethodHead, location, nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("HEAD status = %d", recorder.Code)
+		}
+		return recorder.Header().Get(constants.HeaderUploadOffset)
+	}
+	if got := offset(); got != "0" {
+		t.Fatalf("initial offset = %s", got)
+	}
+	if recorder := patchChunk(router, location, 0, content[:100]); recorder.Code != http.StatusBadRequest {
+		t.Errorf("chunk below the minimum size: status = %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+	if recorder := patchChunk(router, location, 0, content[:400]); recorder.Code != http.StatusNoContent {
+		t.Fatalf("first chunk status = %d, body %s", recorder.Code, recorder.Body.String())
+	}
+	if got := offset(); got != "400" {
+		t.Fatalf("offset after first chunk = %s", got)
+	}
+	if recorder := patchChunk(router, location, 0, content[:400]); recorder.Code != http.StatusConflict {
+		t.Errorf("chunk at a stale offset: status = %d, want %d", recorder.Code, http.StatusConflict)
+	}
+	recorder = patchChunk(router, location, 400, content[400:])
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("last chunk status = %d, body %s", recorder.Code, recorder.Body.String())
+	}
+	var fileId string
+	for deadline := time.Now().Add(5 * time.Second); fileId == "" && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		fileId = serve(router, httptest.NewRequest(http.MethodHead, location, nil)).Header().Get(constants.HeaderUploadFileId)
+	}
+	if fileId == "" {
+		t.Fatal("completed upload was not assembled into a file")
+	}
+
+	var secureFile models.SecureFile
+	if err := db.First(&secureFile, "id = ?", fileId).Error; err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(content)
+	if secureFile.FileName != "notes.txt" || secureFile.SizeBytes != int64(len(content)) || secureFile.Sha256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("file = %+v", secureFile.Metadata())
+	}
+	stored, err := envelope.Default.Open(context.Background(), storage.Default, secureFile.StorageKey, secureFile.Encryption)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stored.Close()
+	if read, _ := io.ReadAll(stored); !bytes.Equal(read, content) {
+		t.Error("stored content differs from the upload")
+	}
+
+	if recorder := patchChunk(router, location, len(content), nil); recorder.Code != http.StatusNoContent || recorder.Header().Get(constants.HeaderUploadFileId) != fileId {
+		t.Errorf("PATCH after completion: status = %d, file %q", recorder.Code, recorder.Header().Get(constants.HeaderUploadFileId))
+	}
+}
+
+func TestResumableUploadTermination(t *testing.T) {
+	db := useTestDatabase(t)
+	useTestStorage(t)
+	user := createTestUser(t, db, "ada@example.com", true)
+	router := uploadRouter(user.Id)
+	create := httptest.NewRequest(http.MethodPost, "/files/uploads", nil)
+	create.Header.Set(constants.HeaderUploadLength, "10")
+	create.Header.Set(constants.HeaderUploadMeta, "filename "+base64.StdEncoding.EncodeToString([]byte("a.txt")))
+	location := serve(router, create).Header().Get("Location")
+
+	if recorder := serve(uploadRouter(user.Id+1), httptest.NewRequest(http.MethodDelete, location, nil)); recorder.Code != http.StatusNotFound {
+		t.Errorf("deleting another user's upload: status = %d", recorder.Code)
+	}
+	if recorder := serve(router, httptest.NewRequest(http.MethodDelete, location, nil)); recorder.Code != http.StatusNoContent {
+		t.Fatalf("delete status = %d", recorder.Code)
+	}
+	if recorder := serve(router, httptest.NewRequest(http.MethodHead, location, nil)); recorder.Code != http.StatusNotFound {
+		t.Errorf("HEAD after delete: status = %d", recorder.Code)
+	}
+}
@@ -26,7 +26,8 @@ func isValidUUID(s string) bool {
 
 func CreateSuperSecret(c *gin.Context) {
 	var superSecret models.SuperSecret
-	if isTokenValid := checkInvalidToken(c); !isTokenValid {
+	principal, ok := getPrincipal(c)
+	if !ok {
 		log.Println("Token not valid")
 		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
 		return
@@ -41,20 +42,31 @@ func CreateSuperSecret(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.ValidationError})
 		return
 	}
+	if !principal.CanCreateSecrets() {
+		log.Println("Access token is restricted to existing secrets")
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.Forbidden})
+		return
+	}
+	superSecret.Id = uuid.New().String()
+	superSecret.UserId = principal.UserId
 	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
 	defer cancel()
+	if !canCreateTeamItem(ctx, c, superSecret.TeamId, principal.UserId) {
+		return
+	}
 	success, err := orms.CreateSuperSecret(ctx, &superSecret)
 	if err != nil || !success {
 		log.Println(constants.InternalServerError, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
 		return
 	}
-	c.JSON(http.StatusCreated, gin.H{"success": true, "message": "Successfully created secret"})
+	c.JSON(http.StatusCreated, gin.H{"success": true, "message": "Successfully created secret", "data": gin.H{"id": superSecret.Id}})
 }
 
 func ReadSuperSecret(c *gin.Context) {
 	var superSecret *models.SuperSecret
-	if isValidToken := checkInvalidToken(c); !isValidToken {
+	principal, ok := getPrincipal(c)
+	if !ok {
 		log.Println(constants.Unauthorized)
 		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
 		return
@@ -70,15 +82,14 @@ func ReadSuperSecret(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.UUIDInvalid})
 		return
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
-	defer cancel()
-	secretAvailable := orms.IsSecretAvailable(ctx, secretId)
-	if !secretAvailable {
-		log.Println("Secret Not Available")
-		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": constants.NotFound})
+	if !principal.CanAccessSecret(secretId) {
+		log.Println("Access token is not allowed to use this secret")
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.Forbidden})
 		return
 	}
-	superSecret, err := orms.GetSecrect(ctx, secretId)
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	superSecret, err := orms.GetAccessibleSecret(ctx, secretId, principal.UserId)
 	if err != nil {
 		log.Println(constants.InternalServerError, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
@@ -94,7 +105,8 @@ func ReadSuperSecret(c *gin.Context) {
 
 func UpdatedSuperSecret(c *gin.Context) {
 	var updatedSuperSecret models.SuperSecret
-	if isTokenValid := checkInvalidToken(c); !isTokenValid {
+	principal, ok := getPrincipal(c)
+	if !ok {
 		log.Println("Token Invalid")
 		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
 		return
@@ -109,10 +121,20 @@ func UpdatedSuperSecret(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.ValidationError})
 		return
 	}
+	if !principal.CanAccessSecret(updatedSuperSecret.Id) {
+		log.Println("Access token is not allowed to use this secret")
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.Forbidden})
+		return
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
 	defer cancel()
-	updateSuccess, err := orms.UpdateSuperSecret(ctx, &updatedSuperSecret)
-	if err != nil || !updateSuccess {
+	updateSuccess, err := orms.UpdateSuperSecret(ctx, &updatedSuperSecret, principal.UserId)
+	if err == nil && !updateSuccess {
+		log.Println("Secret not found for owner")
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": constants.NotFound})
+		return
+	}
+	if err != nil {
 		log.Println(constants.InternalServerError, ":", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
 		return
@@ -121,12 +143,13 @@ func UpdatedSuperSecret(c *gin.Context) {
 }
 
 func DeleteSuperSecret(c *gin.Context) {
-	if tokenValid := checkInvalidToken(c); !tokenValid {
+	principal, ok := getPrincipal(c)
+	if !ok {
 		log.Println("Token is not valid")
 		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
 		return
 	}
-	secretId := c.Param("id")
+	secretId := pathOrQueryId(c)
 	if secretId == "" {
 		log.Println("Id empty")
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.IdEmpty})
@@ -137,28 +160,33 @@ func DeleteSuperSecret(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.UUIDInvalid})
 		return
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
-	defer cancel()
-	availableSecret, err := orms.GetSecrect(ctx, secretId)
-	if availableSecret == nil {
-		log.Println("Secret Not Found")
-		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": constants.NotFound})
+	if !principal.CanAccessSecret(secretId) {
+		log.Println("Access token is not allowed to use this secret")
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.Forbidden})
 		return
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	availableSecret, err := orms.GetAccessibleSecret(ctx, secretId, principal.UserId)
 	if err != nil {
 		log.Println("Error while fetching secret")
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
 		return
 	}
-	deleteSuccess, err := orms.DeleteSuperSecret(ctx, availableSecret)
+	if availableSecret == nil {
+		log.Println("Secret Not Found")
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": constants.NotFound})
+		return
+	}
+	deleteSuccess, err := orms.DeleteSuperSecret(ctx, availableSecret, principal.UserId)
 	if err != nil && !deleteSuccess {
 		log.Println("Error occured while deleting secret:", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
 		return
 	}
 	if !deleteSuccess && err == nil {
-		log.Println("Rows not effected")
-		c.JSON(http.StatusNotModified, gin.H{"success": false, "message": "Could not delete secret"})
+		log.Println("User tried to delete a secret they cannot modify")
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.Forbidden})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Delete action successful"})
@@ -166,8 +194,8 @@ func DeleteSuperSecret(c *gin.Context) {
 
 func GetSuperSecretsForUser(c *gin.Context) {
 	var secrets []models.SuperSecret
-	tokenValid := checkInvalidToken(c)
-	if !tokenValid {
+	principal, ok := getPrincipal(c)
+	if !ok {
 		log.Println("Token is invalid")
 		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
 		return
@@ -183,6 +211,11 @@ func GetSuperSecretsForUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Id is invalid"})
 		return
 	}
+	if uint(userId) != principal.UserId {
+		log.Println("User tried to list secrets of another user")
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.Forbidden})
+		return
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
 	defer cancel()
 	secrets, err = orms.GetSecretsOfAUser(ctx, uint(userId))
@@ -191,5 +224,16 @@ func GetSuperSecretsForUser(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
 		return
 	}
+	secrets = filterAccessibleSecrets(principal, secrets)
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Successfully fetched secrets", "data": secrets})
 }
+
+func filterAccessibleSecrets(principal *models.Principal, secrets []models.SuperSecret) []models.SuperSecret {
+	accessible := make([]models.SuperSecret, 0, len(secrets))
+	for _, secret := range secrets {
+		if principal.CanAccessSecret(secret.Id) {
+			accessible = append(accessible, secret)
+		}
+	}
+	return accessible
+}
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/db/orms"
+)
+
+func GetUserSessions(c *gin.Context) {
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println(constants.Unauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	sessions, err := orms.GetActiveSessionsOfAUser(ctx, principal.UserId)
+	if err != nil {
+		log.Println("Could not fetch sessions:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	data := make([]gin.H, 0, len(sessions))
+	for _, session := range sessions {
+		data = append(data, gin.H{
+			"id":           session.Id,
+			"device_name":  session.DeviceName,
+			"user_agent":   session.UserAgent,
+			"ip_address":   session.IpAddress,
+			"created_at":   session.CreatedAt,
+			"last_seen_at": session.LastSeenAt,
+			"current":      session.Id == principal.SessionId,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Successfully fetched sessions", "data": data})
+}
+
+func RevokeUserSession(c *gin.Context) {
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println(constants.Unauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	sessionId := c.Param("id")
+	if !isValidUUID(sessionId) {
+		log.Println(constants.UUIDInvalid)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.UUIDInvalid})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	revoked, err := orms.RevokeSession(ctx, principal.UserId, sessionId)
+	if err != nil {
+		log.Println("Could not revoke session:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	if !revoked {
+		log.Println("Session not found")
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": constants.NotFound})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Session revoked"})
+}
+
+func RevokeOtherUserSessions(c *gin.Context) {
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println(constants.Unauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	revokedCount, err := orms.RevokeSessionsOfAUser(ctx, principal.UserId, principal.SessionId)
+	if err != nil {
+		log.Println("Could not revoke sessions:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Other sessions revoked", "data": gin.H{"revoked": revokedCount}})
+}
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
@@ -21,6 +22,12 @@ func init() {
 
 func ShareSecureFile(c *gin.Context) {
 	var shareFile models.FileSharing
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println(constants.Unauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
 	if err := c.ShouldBindJSON(&shareFile); err != nil {
 		log.Println(constants.BadRequest, err)
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
@@ -31,9 +38,24 @@ func ShareSecureFile(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.ValidationError})
 		return
 	}
+	if !principal.CanAccessFile(shareFile.FileId) {
+		log.Println("Access token is not allowed to use this file")
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.Forbidden})
+		return
+	}
+	shareFile.Id = 0
+	shareFile.SenderId = principal.UserId
 	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
 	defer cancel()
+	if !resolveRecipient(ctx, c, principal.UserId, &shareFile.RecipientId, shareFile.RecipientEmail) {
+		return
+	}
 	err := orms.ShareFile(ctx, &shareFile)
+	if errors.Is(err, orms.ErrForbidden) {
+		log.Println("Sender does not own the shared item")
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.Forbidden})
+		return
+	}
 	if err != nil {
 		log.Println("Transaction not successful: ", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
@@ -44,6 +66,12 @@ func ShareSecureFile(c *gin.Context) {
 
 func ShareSuperSecret(c *gin.Context) {
 	var superSecret models.SecretSharing
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println(constants.Unauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
 	if err := c.ShouldBindJSON(&superSecret); err != nil {
 		log.Println(constants.BadRequest, err)
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
@@ -54,9 +82,24 @@ func ShareSuperSecret(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.ValidationError})
 		return
 	}
+	if !principal.CanAccessSecret(superSecret.SecretId) {
+		log.Println("Access token is not allowed to use this secret")
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.Forbidden})
+		return
+	}
+	superSecret.Id = 0
+	superSecret.SenderId = principal.UserId
 	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
 	defer cancel()
+	if !resolveRecipient(ctx, c, principal.UserId, &superSecret.RecipientId, superSecret.RecipientEmail) {
+		return
+	}
 	err := orms.ShareSecret(ctx, &superSecret)
+	if errors.Is(err, orms.ErrForbidden) {
+		log.Println("Sender does not own the shared item")
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.Forbidden})
+		return
+	}
 	if err != nil {
 		log.Println("Could not save in the db:", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
@@ -67,6 +110,12 @@ func ShareSuperSecret(c *gin.Context) {
 
 func GetFileSharedOfAUser(c *gin.Context) {
 	var userSecrets []*models.FileSharing
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println(constants.Unauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
 	senderId, err := strconv.ParseInt(c.Param("id"), 10, 0)
 	if err != nil {
 		log.Println("ID parsing error: ", err)
@@ -78,6 +127,11 @@ func GetFileSharedOfAUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
 		return
 	}
+	if uint(senderId) != principal.UserId {
+		log.Println("User tried to list shares of another user")
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.Forbidden})
+		return
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
 	defer cancel()
 	userSecrets, err = orms.GetFileSharesOfAUser(ctx, uint(senderId))
@@ -86,11 +140,24 @@ func GetFileSharedOfAUser(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
 		return
 	}
+	accessibleShares := make([]*models.FileSharing, 0, len(userSecrets))
+	for _, share := range userSecrets {
+		if principal.CanAccessFile(share.FileId) {
+			accessibleShares = append(accessibleShares, share)
+		}
+	}
+	userSecrets = accessibleShares
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Successfully fetched user files", "data": userSecrets})
 }
 
 func GetSecretSharedOfAUser(c *gin.Context) {
 	var userSecrets []*models.SecretSharing
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println(constants.Unauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
 	senderId, err := strconv.ParseInt(c.Param("id"), 10, 0)
 	if err != nil {
 		log.Println("ID parsing error: ", err)
@@ -102,6 +169,11 @@ func GetSecretSharedOfAUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
 		return
 	}
+	if uint(senderId) != principal.UserId {
+		log.Println("User tried to list shares of another user")
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.Forbidden})
+		return
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
 	defer cancel()
 	userSecrets, err = orms.GetSecretSharesOfAUser(ctx, uint(senderId))
@@ -110,5 +182,12 @@ func GetSecretSharedOfAUser(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
 		return
 	}
+	accessibleShares := make([]*models.SecretSharing, 0, len(userSecrets))
+	for _, share := range userSecrets {
+		if principal.CanAccessSecret(share.SecretId) {
+			accessibleShares = append(accessibleShares, share)
+		}
+	}
+	userSecrets = accessibleShares
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Successfully fetched user files", "data": userSecrets})
 }
@@ -0,0 +1,491 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/db/orms"
+	"github.com/subashshakya/SFSS/models"
+)
+
+func parseIdParam(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 0)
+	if err != nil || id == 0 {
+		log.Println("Could not parse id:", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func isManagerRole(role string) bool {
+	return role == constants.MemberRoleOwner || role == constants.MemberRoleAdmin
+}
+
+// canCreateTeamItem checks that the caller may add a file or secret to the
+// team. A nil team means a personal item, which anyone can create.
+func canCreateTeamItem(ctx context.Context, c *gin.Context, teamId *uint, userId uint) bool {
+	if teamId == nil {
+		return true
+	}
+	role, err := orms.GetTeamRole(ctx, *teamId, userId)
+	if err != nil {
+		log.Println("Could not fetch team role:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return false
+	}
+	if !orms.CanWriteTeamItems(role) {
+		log.Println("User cannot add items to team", *teamId)
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.Forbidden})
+		return false
+	}
+	return true
+}
+
+func CreateOrganization(c *gin.Context) {
+	var organization models.Organization
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println(constants.Unauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	if err := c.ShouldBindJSON(&organization); err != nil {
+		log.Println(constants.BadRequest, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+		return
+	}
+	if err := validate.Struct(&organization); err != nil {
+		log.Println(constants.ValidationError, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.ValidationError})
+		return
+	}
+	organization.Id = 0
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	if err := orms.CreateOrganization(ctx, &organization, principal.UserId); err != nil {
+		log.Println("Could not create organization:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"success": true, "message": "Organization created", "data": organization})
+}
+
+func GetOrganizations(c *gin.Context) {
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println(constants.Unauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	organizations, err := orms.GetOrganizationsOfAUser(ctx, principal.UserId)
+	if err != nil {
+		log.Println("Could not fetch organizations:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Successfully fetched organizations", "data": organizations})
+}
+
+// resolveOrganizationRole resolves the caller's role in the organization from the
+// path and rejects non-members.
+func resolveOrganizationRole(ctx context.Context, c *gin.Context) (*models.Principal, uint, string, bool) {
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println(constants.Unauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return nil, 0, "", false
+	}
+	organizationId, ok := parseIdParam(c, "id")
+	if !ok {
+		return nil, 0, "", false
+	}
+	role, err := orms.GetOrganizationRole(ctx, organizationId, principal.UserId)
+	if err != nil {
+		log.Println("Could not fetch organization role:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return nil, 0, "", false
+	}
+	if role == "" {
+		log.Println("User is not a member of organization", organizationId)
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": constants.NotFound})
+		return nil, 0, "", false
+	}
+	return principal, organizationId, role, true
+}
+
+func GetOrganizationMembers(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	_, organizationId, _, ok := resolveOrganizationRole(ctx, c)
+	if !ok {
+		return
+	}
+	members, err := orms.GetOrganizationMembers(ctx, organizationId)
+	if err != nil {
+		log.Println("Could not fetch members:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Successfully fetched members", "data": members})
+}
+
+func SetOrganizationMember(c *gin.Context) {
+	var request models.MemberRequest
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	_, organizationId, callerRole, ok := resolveOrganizationRole(ctx, c)
+	if !ok {
+		return
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		log.Println(constants.BadRequest, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+		return
+	}
+	if err := validate.Struct(&request); err != nil {
+		log.Println(constants.ValidationError, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.ValidationError})
+		return
+	}
+	user, err := orms.GetUserByEmail(ctx, request.Email)
+	if err != nil {
+		log.Println("Could not look up user:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	if user == nil {
+		log.Println("User to add not found")
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": constants.NotFound})
+		return
+	}
+	currentRole, err := orms.GetOrganizationRole(ctx, organizationId, user.Id)
+	if err != nil {
+		log.Println("Could not fetch organization role:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	ownerChange := request.Role == constants.MemberRoleOwner || currentRole == constants.MemberRoleOwner
+	if !isManagerRole(callerRole) || (ownerChange && callerRole != constants.MemberRoleOwner) {
+		log.Println("Caller cannot manage organization members")
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.Forbidden})
+		return
+	}
+	err = orms.SetOrganizationMember(ctx, organizationId, user.Id, request.Role)
+	if errors.Is(err, orms.ErrLastOwner) {
+		log.Println(err)
+		c.JSON(http.StatusConflict, gin.H{"success": false, "message": "An organization must keep at least one owner"})
+		return
+	}
+	if err != nil {
+		log.Println("Could not save member:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Member saved"})
+}
+
+func RemoveOrganizationMember(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	principal, organizationId, callerRole, ok := resolveOrganizationRole(ctx, c)
+	if !ok {
+		return
+	}
+	userId, ok := parseIdParam(c, "user_id")
+	if !ok {
+		return
+	}
+	targetRole, err := orms.GetOrganizationRole(ctx, organizationId, userId)
+	if err != nil {
+		log.Println("Could not fetch organization role:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	leaving := userId == principal.UserId
+	if !leaving && (!isManagerRole(callerRole) || (targetRole == constants.MemberRoleOwner && callerRole != constants.MemberRoleOwner)) {
+		log.Println("Caller cannot remove organization members")
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.Forbidden})
+		return
+	}
+	removed, err := orms.RemoveOrganizationMember(ctx, organizationId, userId)
+	if errors.Is(err, orms.ErrLastOwner) {
+		log.Println(err)
+		c.JSON(http.StatusConflict, gin.H{"success": false, "message": "An organization must keep at least one owner"})
+		return
+	}
+	if err != nil {
+		log.Println("Could not remove member:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	if !removed {
+		log.Println("Member not found")
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": constants.NotFound})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Member removed"})
+}
+
+func CreateTeam(c *gin.Context) {
+	var team models.Team
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	principal, organizationId, callerRole, ok := resolveOrganizationRole(ctx, c)
+	if !ok {
+		return
+	}
+	if !isManagerRole(callerRole) {
+		log.Println("Caller cannot create teams")
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.Forbidden})
+		return
+	}
+	if err := c.ShouldBindJSON(&team); err != nil {
+		log.Println(constants.BadRequest, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+		return
+	}
+	if err := validate.Struct(&team); err != nil {
+		log.Println(constants.ValidationError, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.ValidationError})
+		return
+	}
+	team.Id = 0
+	team.OrganizationId = organizationId
+	if err := orms.CreateTeam(ctx, &team, principal.UserId); err != nil {
+		log.Println("Could not create team:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"success": true, "message": "Team created", "data": team})
+}
+
+func GetOrganizationTeams(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	_, organizationId, _, ok := resolveOrganizationRole(ctx, c)
+	if !ok {
+		return
+	}
+	teams, err := orms.GetTeamsOfOrganization(ctx, organizationId)
+	if err != nil {
+		log.Println("Could not fetch teams:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Successfully fetched teams", "data": teams})
+}
+
+// teamRoles resolves the team from the path along with the caller's role in
+// it and in its organization. Callers with neither get a 404.
+func teamRoles(ctx context.Context, c *gin.Context) (*models.Principal, *models.Team, string, string, bool) {
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println(constants.Unauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return nil, nil, "", "", false
+	}
+	teamId, ok := parseIdParam(c, "id")
+	if !ok {
+		return nil, nil, "", "", false
+	}
+	team, err := orms.GetTeam(ctx, teamId)
+	if err != nil {
+		log.Println("Could not fetch team:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return nil, nil, "", "", false
+	}
+	if team == nil {
+		log.Println("Team not found")
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": constants.NotFound})
+		return nil, nil, "", "", false
+	}
+	teamRole, err := orms.GetTeamRole(ctx, team.Id, principal.UserId)
+	if err != nil {
+		log.Println("Could not fetch team role:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return nil, nil, "", "", false
+	}
+	organizationRole, err := orms.GetOrganizationRole(ctx, team.OrganizationId, principal.UserId)
+	if err != nil {
+		log.Println("Could not fetch organization role:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return nil, nil, "", "", false
+	}
+	if teamRole == "" && !isManagerRole(organizationRole) {
+		log.Println("User is not a member of team", team.Id)
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": constants.NotFound})
+		return nil, nil, "", "", false
+	}
+	return principal, team, teamRole, organizationRole, true
+}
+
+func GetTeamMembers(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	_, team, _, _, ok := teamRoles(ctx, c)
+	if !ok {
+		return
+	}
+	members, err := orms.GetTeamMembers(ctx, team.Id)
+	if err != nil {
+		log.Println("Could not fetch members:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Successfully fetched members", "data": members})
+}
+
+func SetTeamMember(c *gin.Context) {
+	var request models.MemberRequest
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	_, team, teamRole, organizationRole, ok := teamRoles(ctx, c)
+	if !ok {
+		return
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		log.Println(constants.BadRequest, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+		return
+	}
+	if err := validate.Struct(&request); err != nil {
+		log.Println(constants.ValidationError, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.ValidationError})
+		return
+	}
+	user, err := orms.GetUserByEmail(ctx, request.Email)
+	if err != nil {
+		log.Println("Could not look up user:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	if user == nil {
+		log.Println("User to add not found")
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": constants.NotFound})
+		return
+	}
+	currentRole, err := orms.GetTeamRole(ctx, team.Id, user.Id)
+	if err != nil {
+		log.Println("Could not fetch team role:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	if !canManageTeamMember(teamRole, organizationRole, request.Role, currentRole) {
+		log.Println("Caller cannot manage team members")
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.Forbidden})
+		return
+	}
+	err = orms.SetTeamMember(ctx, team, user.Id, request.Role)
+	if errors.Is(err, orms.ErrNotOrganizationMember) {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "User must join the organization first"})
+		return
+	}
+	if err != nil {
+		log.Println("Could not save member:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Member saved"})
+}
+
+func RemoveTeamMember(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	principal, team, teamRole, organizationRole, ok := teamRoles(ctx, c)
+	if !ok {
+		return
+	}
+	userId, ok := parseIdParam(c, "user_id")
+	if !ok {
+		return
+	}
+	targetRole, err := orms.GetTeamRole(ctx, team.Id, userId)
+	if err != nil {
+		log.Println("Could not fetch team role:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	if userId != principal.UserId && !canManageTeamMember(teamRole, organizationRole, targetRole, targetRole) {
+		log.Println("Caller cannot remove team members")
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.Forbidden})
+		return
+	}
+	removed, err := orms.RemoveTeamMember(ctx, team.Id, userId)
+	if err != nil {
+		log.Println("Could not remove member:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	if !removed {
+		log.Println("Member not found")
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": constants.NotFound})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Member removed"})
+}
+
+// canManageTeamMember lets organization owners and admins manage any team.
+// Inside the team, admins manage members and admins while only owners can
+// hand out or take away the owner role.
+func canManageTeamMember(callerTeamRole string, callerOrganizationRole string, newRole string, currentRole string) bool {
+	if isManagerRole(callerOrganizationRole) || callerTeamRole == constants.MemberRoleOwner {
+		return true
+	}
+	if callerTeamRole != constants.MemberRoleAdmin {
+		return false
+	}
+	return newRole != constants.MemberRoleOwner && currentRole != constants.MemberRoleOwner
+}
+
+func GetTeamFiles(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	principal, team, teamRole, _, ok := teamRoles(ctx, c)
+	if !ok {
+		return
+	}
+	if teamRole == "" {
+		log.Println("Only team members can list team files")
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.Forbidden})
+		return
+	}
+	files, err := orms.GetSecureFilesOfATeam(ctx, team.Id)
+	if err != nil {
+		log.Println("Could not fetch team files:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	files = filterAccessibleFiles(principal, files)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Successfully fetched team files", "data": filesMetadata(files)})
+}
+
+func GetTeamSecrets(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	principal, team, teamRole, _, ok := teamRoles(ctx, c)
+	if !ok {
+		return
+	}
+	if teamRole == "" {
+		log.Println("Only team members can list team secrets")
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.Forbidden})
+		return
+	}
+	secrets, err := orms.GetSecretsOfATeam(ctx, team.Id)
+	if err != nil {
+		log.Println("Could not fetch team secrets:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	secrets = filterAccessibleSecrets(principal, secrets)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Successfully fetched team secrets", "data": secrets})
+}
@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/db/orms"
+	"github.com/subashshakya/SFSS/models"
+	"github.com/subashshakya/SFSS/throttle"
+)
+
+// rejectIfLockedOut writes a 429 with Retry-After and records the attempt when
+// the account or client IP is locked. It returns true if the request was
+// rejected.
+func rejectIfLockedOut(ctx context.Context, c *gin.Context, email string) bool {
+	lockout, err := throttle.Default.Check(ctx, email, c.ClientIP())
+	if err != nil {
+		log.Println("Could not check sign-in throttle:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return true
+	}
+	if lockout == nil {
+		return false
+	}
+	event := models.LoginLockoutEvent{Email: email, IpAddress: c.ClientIP(), Scope: lockout.Scope, LockedUntil: lockout.Until}
+	if err := orms.RecordLoginLockout(ctx, &event); err != nil {
+		log.Println("Could not record lockout event:", err)
+	}
+	log.Println("Sign-in locked out by", lockout.Scope)
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(lockout.RetryAfter.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, gin.H{"success": false, "message": constants.TooManyAttempts})
+	return true
+}
+
+func recordFailedSignIn(ctx context.Context, c *gin.Context, email string) {
+	if err := throttle.Default.Fail(ctx, email, c.ClientIP()); err != nil {
+		log.Println("Could not record failed sign-in:", err)
+	}
+}
+
+func recordSuccessfulSignIn(ctx context.Context, email string) {
+	if err := throttle.Default.Succeed(ctx, email); err != nil {
+		log.Println("Could not reset sign-in throttle:", err)
+	}
+}
+
+// rejectIfRateLimited writes a 429 with Retry-After when key has used up the
+// policy. It returns true if the request was rejected.
+func rejectIfRateLimited(ctx context.Context, c *gin.Context, key string, policy throttle.RatePolicy) bool {
+	retryAfter, err := throttle.Default.Allow(ctx, key, policy)
+	if err != nil {
+		log.Println("Could not check rate limit:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return true
+	}
+	if retryAfter <= 0 {
+		return false
+	}
+	log.Println("Rate limit hit for", key)
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, gin.H{"success": false, "message": constants.TooManyRequests})
+	return true
+}
@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/db/orms"
+	"github.com/subashshakya/SFSS/models"
+	"github.com/subashshakya/SFSS/utils"
+)
+
+// issueTokenPair starts a new session for the user and returns its first
+// access and refresh token. The refresh token family id is the session id.
+func issueTokenPair(ctx context.Context, c *gin.Context, userId uint) (string, string, error) {
+	deviceName := c.GetHeader("X-Device-Name")
+	if deviceName == "" {
+		deviceName = c.Request.UserAgent()
+	}
+	session := models.Session{
+		UserId:     userId,
+		DeviceName: deviceName,
+		UserAgent:  c.Request.UserAgent(),
+		IpAddress:  c.ClientIP(),
+	}
+	if err := orms.CreateSession(ctx, &session); err != nil {
+		return "", "", err
+	}
+	accessToken, err := utils.GenerateToken(userId, session.Id)
+	if err != nil {
+		return "", "", err
+	}
+	refreshToken, refreshTokenHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	storedToken := models.RefreshToken{
+		UserId:    userId,
+		FamilyId:  session.Id,
+		TokenHash: refreshTokenHash,
+		ExpiresAt: time.Now().Add(utils.RefreshTokenLifespan()),
+	}
+	if err := orms.CreateRefreshToken(ctx, &storedToken); err != nil {
+		return "", "", err
+	}
+	return accessToken, refreshToken, nil
+}
+
+func RefreshAccessToken(c *gin.Context) {
+	var request models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		log.Println(constants.BadRequest, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+		return
+	}
+	if err := validate.Struct(&request); err != nil {
+		log.Println(constants.ValidationError, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.ValidationError})
+		return
+	}
+	refreshToken, refreshTokenHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		log.Println("Could not generate refresh token:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	next := models.RefreshToken{
+		TokenHash: refreshTokenHash,
+		ExpiresAt: time.Now().Add(utils.RefreshTokenLifespan()),
+	}
+	previous, err := orms.RotateRefreshToken(ctx, utils.HashOpaqueToken(request.RefreshToken), &next)
+	if errors.Is(err, orms.ErrRefreshTokenReused) {
+		log.Println("Refresh token reuse detected, family revoked")
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	if errors.Is(err, orms.ErrRefreshTokenNotFound) || errors.Is(err, orms.ErrRefreshTokenExpired) {
+		log.Println("Refresh token rejected:", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	if err != nil {
+		log.Println("Could not rotate refresh token:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	if err := orms.TouchSession(ctx, previous.FamilyId, c.ClientIP()); err != nil {
+		log.Println("Could not update session activity:", err)
+	}
+	accessToken, err := utils.GenerateToken(previous.UserId, previous.FamilyId)
+	if err != nil {
+		log.Println("Could not generate token:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Token refreshed", "token": accessToken, "refresh_token": refreshToken})
+}
+
+func UserSignOut(c *gin.Context) {
+	var request models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		log.Println(constants.BadRequest, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+		return
+	}
+	if err := validate.Struct(&request); err != nil {
+		log.Println(constants.ValidationError, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.ValidationError})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	revokedToken, err := orms.RevokeRefreshToken(ctx, utils.HashOpaqueToken(request.RefreshToken))
+	if err != nil && !errors.Is(err, orms.ErrRefreshTokenNotFound) {
+		log.Println("Could not revoke refresh token:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	if revokedToken != nil {
+		if _, err := orms.RevokeSession(ctx, revokedToken.UserId, revokedToken.FamilyId); err != nil {
+			log.Println("Could not revoke session:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+			return
+		}
+	}
+	if claims, err := utils.ExtractTokenClaims(c); err == nil {
+		// the token stays usable until exp plus the allowed clock skew
+		if err := orms.RevokeAccessToken(ctx, claims.ID, claims.ExpiresAt.Add(utils.TokenClockSkew())); err != nil {
+			log.Println("Could not revoke access token:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Signed out successfully"})
+}
@@ -0,0 +1,201 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/db/orms"
+	"github.com/subashshakya/SFSS/models"
+	"github.com/subashshakya/SFSS/utils"
+)
+
+func EnrollTotp(c *gin.Context) {
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println(constants.Unauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	userId := principal.UserId
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	user, err := orms.GetUser(ctx, userId)
+	if err != nil {
+		log.Println("Could not find user:", err)
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": constants.NotFound})
+		return
+	}
+	if user.TotpEnabled {
+		log.Println("TOTP already enabled")
+		c.JSON(http.StatusConflict, gin.H{"success": false, "message": constants.TotpAlreadyEnabled})
+		return
+	}
+	secret, err := utils.GenerateTotpSecret()
+	if err != nil {
+		log.Println("Could not generate TOTP secret:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	sealedSecret, err := utils.SealTotpSecret(userId, secret)
+	if err != nil {
+		log.Println("Could not encrypt TOTP secret:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	if err := orms.SetPendingTotpSecret(ctx, userId, sealedSecret); err != nil {
+		log.Println("Could not save TOTP secret:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Scan the URI and confirm with a code", "data": gin.H{"secret": secret, "otpauth_uri": utils.TotpURI(secret, user.Email)}})
+}
+
+func ConfirmTotp(c *gin.Context) {
+	var request models.TotpCodeRequest
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println(constants.Unauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	userId := principal.UserId
+	if err := c.ShouldBindJSON(&request); err != nil {
+		log.Println(constants.BadRequest, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+		return
+	}
+	if err := validate.Struct(&request); err != nil {
+		log.Println(constants.ValidationError, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.ValidationError})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	user, err := orms.GetUser(ctx, userId)
+	if err != nil {
+		log.Println("Could not find user:", err)
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": constants.NotFound})
+		return
+	}
+	if user.TotpEnabled {
+		log.Println("TOTP already enabled")
+		c.JSON(http.StatusConflict, gin.H{"success": false, "message": constants.TotpAlreadyEnabled})
+		return
+	}
+	if !user.TotpSecret.Valid {
+		log.Println("TOTP enrollment not started")
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "TOTP enrollment has not been started"})
+		return
+	}
+	secret, err := utils.OpenTotpSecret(userId, user.TotpSecret.String)
+	if err != nil {
+		log.Println("Could not decrypt TOTP secret:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	step, ok := utils.VerifyTotp(secret, request.Code, time.Now())
+	if !ok {
+		log.Println("TOTP code invalid")
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.InvalidTotpCode})
+		return
+	}
+	recoveryCodes, recoveryCodeHashes, err := utils.GenerateRecoveryCodes()
+	if err != nil {
+		log.Println("Could not generate recovery codes:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	if err := orms.EnableTotp(ctx, userId, step, recoveryCodeHashes); err != nil {
+		log.Println("Could not enable TOTP:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Two-factor authentication enabled", "data": gin.H{"recovery_codes": recoveryCodes}})
+}
+
+func UserSignInTotp(c *gin.Context) {
+	var request models.TotpSignInRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		log.Println(constants.BadRequest, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+		return
+	}
+	if err := validate.Struct(&request); err != nil {
+		log.Println(constants.ValidationError, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.ValidationError})
+		return
+	}
+	userId, err := utils.ParseChallengeToken(request.ChallengeToken)
+	if err != nil {
+		log.Println("Challenge token invalid:", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	user, err := orms.GetUser(ctx, userId)
+	if err != nil || !user.TotpEnabled || !user.TotpSecret.Valid {
+		log.Println("TOTP not enabled for user:", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	if rejectIfLockedOut(ctx, c, user.Email) {
+		recordLoginAttempt(ctx, c, &user.Id, user.Email, constants.SignInMethodTotp, constants.SignInLockedOut)
+		return
+	}
+	if rejectIfAccountBlocked(c, user) {
+		recordLoginAttempt(ctx, c, &user.Id, user.Email, constants.SignInMethodTotp, constants.SignInAccountBlocked)
+		return
+	}
+	if request.Code != "" {
+		secret, err := utils.OpenTotpSecret(userId, user.TotpSecret.String)
+		if err != nil {
+			log.Println("Could not decrypt TOTP secret:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+			return
+		}
+		step, ok := utils.VerifyTotp(secret, request.Code, time.Now())
+		if !ok {
+			recordFailedSignIn(ctx, c, user.Email)
+			recordLoginAttempt(ctx, c, &user.Id, user.Email, constants.SignInMethodTotp, constants.SignInMfaFailed)
+			log.Println("TOTP code invalid")
+			c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.InvalidTotpCode})
+			return
+		}
+		if err := orms.MarkTotpStepUsed(ctx, userId, step); err != nil {
+			recordFailedSignIn(ctx, c, user.Email)
+			recordLoginAttempt(ctx, c, &user.Id, user.Email, constants.SignInMethodTotp, constants.SignInMfaFailed)
+			log.Println("TOTP code rejected:", err)
+			c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.InvalidTotpCode})
+			return
+		}
+	} else {
+		consumed, err := orms.ConsumeRecoveryCode(ctx, userId, utils.HashRecoveryCode(request.RecoveryCode))
+		if err != nil {
+			log.Println("Could not check recovery code:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+			return
+		}
+		if !consumed {
+			recordFailedSignIn(ctx, c, user.Email)
+			recordLoginAttempt(ctx, c, &user.Id, user.Email, constants.SignInMethodTotp, constants.SignInMfaFailed)
+			log.Println("Recovery code invalid")
+			c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.InvalidTotpCode})
+			return
+		}
+	}
+	recordSuccessfulSignIn(ctx, user.Email)
+	noteSuccessfulSignIn(ctx, c, user, constants.SignInMethodTotp)
+	token, refreshToken, err := issueTokenPair(ctx, c, userId)
+	if err != nil {
+		log.Println("Could not generate token:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Could not generate token"})
+		return
+	}
+	log.Println("Sign-In successful")
+	c.JSON(http.StatusAccepted, gin.H{"success": true, "message": "Sign-In Successful", "token": token, "refresh_token": refreshToken})
+}
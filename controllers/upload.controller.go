@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/db/orms"
+	"github.com/subashshakya/SFSS/envelope"
+	"github.com/subashshakya/SFSS/models"
+	"github.com/subashshakya/SFSS/storage"
+	"github.com/subashshakya/SFSS/utils"
+)
+
+const defaultContentType = "application/octet-stream"
+const maxFileNameLength = 255
+
+// UploadSecureFile streams a new file to storage. The body is either
+// multipart/form-data with a "file" part, where an optional "team_id" field
+// has to come before the file, or the raw content with the name in the
+// file_name query parameter or X-File-Name header.
+func UploadSecureFile(c *gin.Context) {
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println(constants.Unauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	secureFile := models.SecureFile{Id: uuid.New().String(), UserId: int(principal.UserId)}
+	if !principal.CanCreateFiles() {
+		log.Println("Access token is restricted to existing files")
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.Forbidden})
+		return
+	}
+	maxBytes := utils.FileUploadMaxBytes()
+	if c.Request.ContentLength > 0 && c.Request.ContentLength > maxBytes+multipartOverhead(c) {
+		log.Println("Upload rejected by Content-Length:", c.Request.ContentLength)
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"success": false, "message": utils.ErrUploadTooLarge.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+	var content io.Reader
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		part, ok := nextFilePart(c, &secureFile)
+		if !ok {
+			return
+		}
+		defer part.Close()
+		content = part
+	} else {
+		secureFile.FileName = c.Query("file_name")
+		if secureFile.FileName == "" {
+			secureFile.FileName = c.GetHeader("X-File-Name")
+		}
+		secureFile.ContentType = c.GetHeader("Content-Type")
+		if teamId := c.Query("team_id"); teamId != "" {
+			if !setUploadTeam(c, &secureFile, teamId) {
+				return
+			}
+		}
+		content = c.Request.Body
+	}
+	secureFile.FileName = cleanFileName(secureFile.FileName)
+	if secureFile.FileName == "" {
+		log.Println("Upload without a file name")
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "A file name is required"})
+		return
+	}
+	if secureFile.ContentType == "" {
+		secureFile.ContentType = defaultContentType
+	}
+	checkCtx, cancel := context.WithTimeout(ctx, constants.ShortTimeout)
+	allowed := canCreateTeamItem(checkCtx, c, secureFile.TeamId, principal.UserId)
+	cancel()
+	if !allowed {
+		return
+	}
+	hashingReader := utils.NewHashingReader(content, maxBytes)
+	encryption, err := envelope.Default.Put(ctx, storage.Default, secureFile.Id, hashingReader)
+	if err != nil {
+		if errors.Is(err, utils.ErrUploadTooLarge) {
+			log.Println("Upload exceeded the maximum size")
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"success": false, "message": utils.ErrUploadTooLarge.Error()})
+			return
+		}
+		log.Println("Could not store upload:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	secureFile.StorageKey = secureFile.Id
+	secureFile.Encryption = encryption
+	secureFile.SizeBytes = hashingReader.Size()
+	secureFile.Sha256 = hashingReader.Sum()
+	saveCtx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	created, err := orms.CreateSecureFile(saveCtx, &secureFile)
+	if err != nil || !created {
+		log.Println("Could not save the file: ", err)
+		discardStoredContent(&secureFile)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"success": true, "message": "Uploaded file successfully", "data": secureFile.Metadata()})
+}
+
+// nextFilePart reads form fields up to the "file" part without buffering the
+// file itself.
+func nextFilePart(c *gin.Context, secureFile *models.SecureFile) (*multipart.Part, bool) {
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		log.Println("Could not read multipart body:", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+		return nil, false
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			log.Println("Multipart body has no file part")
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "A file part is required"})
+			return nil, false
+		}
+		if err != nil {
+			log.Println("Could not read multipart body:", err)
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+			return nil, false
+		}
+		switch part.FormName() {
+		case "file":
+			secureFile.FileName = part.FileName()
+			secureFile.ContentType = part.Header.Get("Content-Type")
+			return part, true
+		case "team_id":
+			value, err := io.ReadAll(io.LimitReader(part, 32))
+			part.Close()
+			if err != nil || !setUploadTeam(c, secureFile, strings.TrimSpace(string(value))) {
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+				}
+				return nil, false
+			}
+		default:
+			part.Close()
+		}
+	}
+}
+
+func setUploadTeam(c *gin.Context, secureFile *models.SecureFile, value string) bool {
+	teamId, err := strconv.ParseUint(value, 10, 0)
+	if err != nil || teamId == 0 {
+		log.Println("Could not parse team id:", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.BadRequest})
+		return false
+	}
+	id := uint(teamId)
+	secureFile.TeamId = &id
+	return true
+}
+
+// multipartOverhead allows for the boundaries and part headers around the
+// file when comparing Content-Length with the size limit.
+func multipartOverhead(c *gin.Context) int64 {
+	if strings.HasPrefix(c.GetHeader("Content-Type"), "multipart/") {
+		return 64 << 10
+	}
+	return 0
+}
+
+func cleanFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(strings.TrimSpace(name), `\`, "/"))
+	if name == "." || name == "/" {
+		return ""
+	}
+	if len(name) > maxFileNameLength {
+		name = name[:maxFileNameLength]
+	}
+	return name
+}
@@ -2,13 +2,17 @@ package controllers
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/subashshakya/SFSS/constants"
 	"github.com/subashshakya/SFSS/db/orms"
+	"github.com/subashshakya/SFSS/mailer"
 	"github.com/subashshakya/SFSS/models"
 	"github.com/subashshakya/SFSS/utils"
 )
@@ -36,12 +40,27 @@ func UserSignUp(c *gin.Context) {
 		return
 	}
 
+	if rejectWeakPassword(c, newUser.Password, newUser.Email, newUser.FirstName, newUser.LastName) {
+		return
+	}
+	passwordHash, err := utils.HashPassword(newUser.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Could not save user data"})
+		log.Printf("\nError ====> %v\n", err)
+		return
+	}
+	newUser.Password = passwordHash
+
 	if _, err := orms.CreateUser(ctx, &newUser); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Could not save user data"})
 		log.Printf("\nError ====> %v\n", err)
 		return
 	}
+	if err := sendVerificationEmail(ctx, newUser); err != nil {
+		log.Printf("\nError ====> %v\n", err)
+	}
 	log.Println("Successfully signup")
+	newUser.Password = ""
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "User sign up successful", "data": newUser})
 }
 
@@ -52,30 +71,107 @@ func UserSignIn(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": invalidInput})
 		return
 	}
+	if user.Email == "" || user.Password == "" {
+		log.Println("Email or password missing")
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalidInput})
+		return
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	isPresent, err := orms.CheckUserInDB(ctx, &user)
+	if rejectIfLockedOut(ctx, c, user.Email) {
+		recordLoginAttempt(ctx, c, nil, user.Email, constants.SignInMethodPassword, constants.SignInLockedOut)
+		return
+	}
+	dbUser, err := orms.GetUserByEmail(ctx, user.Email)
 	if err != nil {
 		log.Printf("\nError ====> %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": internalServerError})
 		return
 	}
-	if !isPresent {
+	if dbUser == nil {
+		utils.DummyPasswordVerify(user.Password)
+		recordFailedSignIn(ctx, c, user.Email)
+		recordLoginAttempt(ctx, c, nil, user.Email, constants.SignInMethodPassword, constants.SignInInvalidCredentials)
 		log.Println("User not found")
-		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "Could not match user credentials."})
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": constants.InvalidCredentials})
+		return
+	}
+	passwordMatch, needsRehash, err := utils.VerifyPassword(user.Password, dbUser.Password)
+	if err != nil {
+		log.Printf("\nError ====> %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": internalServerError})
+		return
+	}
+	if !passwordMatch {
+		recordFailedSignIn(ctx, c, user.Email)
+		recordLoginAttempt(ctx, c, &dbUser.Id, user.Email, constants.SignInMethodPassword, constants.SignInInvalidCredentials)
+		log.Println("Password did not match")
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": constants.InvalidCredentials})
+		return
+	}
+	if needsRehash {
+		if passwordHash, err := utils.HashPassword(user.Password); err != nil {
+			log.Printf("\nError ====> %v\n", err)
+		} else if err := orms.UpdateUserPassword(ctx, dbUser.Id, passwordHash); err != nil {
+			log.Printf("\nError ====> %v\n", err)
+		}
+	}
+	user = *dbUser
+	if rejectIfAccountBlocked(c, user) {
+		recordLoginAttempt(ctx, c, &user.Id, user.Email, constants.SignInMethodPassword, constants.SignInAccountBlocked)
 		return
 	}
-	token, tokenError := utils.GenerateToken(user.Id)
+	if user.TotpEnabled {
+		challengeToken, err := utils.GenerateChallengeToken(user.Id)
+		if err != nil {
+			log.Printf("\nError ====> %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Could not generate token"})
+			return
+		}
+		recordLoginAttempt(ctx, c, &user.Id, user.Email, constants.SignInMethodPassword, constants.SignInMfaRequired)
+		log.Println("Password step successful, TOTP required")
+		c.JSON(http.StatusAccepted, gin.H{"success": true, "message": "Two-factor code required", "mfa_required": true, "challenge_token": challengeToken})
+		return
+	}
+	if requireStepUpForNewDevice(ctx, c, user) {
+		return
+	}
+	recordSuccessfulSignIn(ctx, user.Email)
+	noteSuccessfulSignIn(ctx, c, user, constants.SignInMethodPassword)
+	token, refreshToken, tokenError := issueTokenPair(ctx, c, user.Id)
 	if tokenError != nil || token == "" {
 		log.Printf("\nError ====> %v\n", tokenError)
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Could not generate token", "error": tokenError})
 		return
 	}
 	log.Println("Sign-In successful")
-	c.JSON(http.StatusAccepted, gin.H{"success": true, "message": "Sign-In Successful", "token": token})
+	c.JSON(http.StatusAccepted, gin.H{"success": true, "message": "Sign-In Successful", "token": token, "refresh_token": refreshToken})
+}
+
+// rejectIfAccountBlocked stops sign-in for accounts an admin disabled or sent
+// through a forced password reset. It runs after the credentials were checked
+// so that it does not reveal the account state to anyone else.
+func rejectIfAccountBlocked(c *gin.Context, user models.User) bool {
+	if user.DisabledAt.Valid {
+		log.Println("Sign-in attempt on disabled account", user.Id)
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.AccountDisabled})
+		return true
+	}
+	if user.PasswordResetRequired {
+		log.Println("Sign-in attempt on account pending password reset", user.Id)
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.PasswordChangeRequired})
+		return true
+	}
+	return false
 }
 
 func GetUser(c *gin.Context) {
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println("Principal missing")
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
 	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
 	if id == 0 {
 		log.Println("ID is zero")
@@ -87,6 +183,11 @@ func GetUser(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Could not parse user id"})
 		return
 	}
+	if uint(id) != principal.UserId {
+		log.Println("User tried to fetch another user")
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.Forbidden})
+		return
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	dbUser, dbErr := orms.GetUser(ctx, uint(id))
@@ -96,25 +197,37 @@ func GetUser(c *gin.Context) {
 		return
 	}
 	log.Println("User request successful")
+	dbUser.Password = ""
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "The requested user is fetched successfully", "data": dbUser})
 }
 
 func UpdateUser(c *gin.Context) {
-	var user models.User
-	if err := c.ShouldBindJSON(&user); err != nil {
+	var profile models.UpdateUserRequest
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println("Principal missing")
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	if err := c.ShouldBindJSON(&profile); err != nil {
 		log.Printf("\nError ====> %v\n", err)
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": invalidInput})
 		return
 	}
+	if err := validate.Struct(&profile); err != nil {
+		log.Printf("\nError ====> %v\n", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.ValidationError})
+		return
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	isUserInDB, _ := orms.CheckUserInDB(ctx, &user)
-	if !isUserInDB {
+	existingUser, err := orms.GetUser(ctx, principal.UserId)
+	if err != nil {
 		log.Println("User not found")
 		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "User not found for modification"})
 		return
 	}
-	isUpdated, error := orms.UpdateUser(ctx, &user)
+	isUpdated, error := orms.UpdateUser(ctx, existingUser.Id, &profile)
 	if error != nil {
 		log.Printf("\nError ====> %v\n", error)
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": internalServerError})
@@ -125,36 +238,140 @@ func UpdateUser(c *gin.Context) {
 		c.JSON(http.StatusNotModified, gin.H{"success": false, "message": "Data not modified"})
 		return
 	}
+	if profile.Email != "" && profile.Email != existingUser.Email {
+		existingUser.Email = profile.Email
+		if err := sendVerificationEmail(ctx, existingUser); err != nil {
+			log.Printf("\nError ====> %v\n", err)
+		}
+	}
 	log.Println("User updated successfully")
 	c.JSON(http.StatusAccepted, gin.H{"success": true, "message": "User updated successfully"})
 }
 
+// ChangePassword sets a new password after checking the current one and
+// signs out every other session of the user.
+func ChangePassword(c *gin.Context) {
+	var request models.ChangePasswordRequest
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println("Principal missing")
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		log.Printf("\nError ====> %v\n", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": invalidInput})
+		return
+	}
+	if err := validate.Struct(&request); err != nil {
+		log.Printf("\nError ====> %v\n", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": constants.ValidationError})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	user, err := orms.GetUser(ctx, principal.UserId)
+	if err != nil {
+		log.Printf("\nError ====> %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": internalServerError})
+		return
+	}
+	passwordMatch, _, err := utils.VerifyPassword(request.CurrentPassword, user.Password)
+	if err != nil {
+		log.Printf("\nError ====> %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": internalServerError})
+		return
+	}
+	if !passwordMatch {
+		log.Println("Current password did not match")
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.InvalidCredentials})
+		return
+	}
+	if rejectWeakPassword(c, request.NewPassword, user.Email, user.FirstName, user.LastName) {
+		return
+	}
+	passwordHash, err := utils.HashPassword(request.NewPassword)
+	if err != nil {
+		log.Printf("\nError ====> %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": internalServerError})
+		return
+	}
+	if err := orms.ChangeUserPassword(ctx, user.Id, passwordHash, principal.SessionId); err != nil {
+		log.Printf("\nError ====> %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": internalServerError})
+		return
+	}
+	log.Println("Password changed for user", user.Id)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Password changed, other sessions have been signed out"})
+}
+
 func DeleteUser(c *gin.Context) {
-	var user models.User
-	if err := c.ShouldBindJSON(&user); err != nil {
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println("Principal missing")
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil || id == 0 {
 		log.Printf("\nError ====> %v\n", err)
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": invalidInput})
 		return
 	}
+	if uint(id) != principal.UserId {
+		log.Println("User tried to delete another user")
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.Forbidden})
+		return
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	isUserInDB, _ := orms.CheckUserInDB(ctx, &user)
-	if !isUserInDB {
+	user, err := orms.GetUser(ctx, uint(id))
+	if err != nil {
 		log.Println("User not found")
 		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "User not found for modification"})
 		return
 	}
-	deleteSuccess, error := orms.DeleteUser(ctx, &user)
-	if error != nil {
-		log.Printf("\nError ====> %v\n", error)
+	purgeAt, err := orms.ScheduleUserDeletion(ctx, user.Id, time.Now().Add(utils.AccountDeletionGracePeriod()))
+	if err != nil {
+		log.Printf("\nError ====> %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": internalServerError})
 		return
 	}
-	if !deleteSuccess {
-		log.Println("Could not delete user")
-		c.JSON(http.StatusUnprocessableEntity, gin.H{"success": false, "message": "Could not process the requested process"})
+	if err := sendDeletionScheduledEmail(ctx, user, purgeAt); err != nil {
+		log.Printf("\nError ====> %v\n", err)
+	}
+	log.Println("User deletion scheduled")
+	c.JSON(http.StatusAccepted, gin.H{"success": true, "message": "Account deletion scheduled, sign in and cancel before it runs to keep the account", "data": gin.H{"deletion_scheduled_at": purgeAt}})
+}
+
+func CancelUserDeletion(c *gin.Context) {
+	principal, ok := getPrincipal(c)
+	if !ok {
+		log.Println("Principal missing")
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
 		return
 	}
-	log.Println("User deleted successfully")
-	c.JSON(http.StatusAccepted, gin.H{"success": true, "message": "Successfully deleted the user"})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := orms.CancelUserDeletion(ctx, principal.UserId)
+	if errors.Is(err, orms.ErrDeletionNotPending) {
+		log.Println("No pending deletion to cancel")
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "No account deletion is pending"})
+		return
+	}
+	if err != nil {
+		log.Printf("\nError ====> %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": internalServerError})
+		return
+	}
+	log.Println("User deletion cancelled")
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Account deletion cancelled"})
+}
+
+func sendDeletionScheduledEmail(ctx context.Context, user models.User, purgeAt time.Time) error {
+	return mailer.Default.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your SFSS account is scheduled for deletion",
+		Body:    fmt.Sprintf("Hi %s,\n\nYour account and all files and secrets you own will be deleted on %s.\n\nIf you did not ask for this, sign in and cancel the deletion before then.\n", user.FirstName, purgeAt.UTC().Format(time.RFC1123)),
+	})
 }
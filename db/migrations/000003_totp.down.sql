@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS recovery_codes;
+
+ALTER TABLE "User" DROP COLUMN IF EXISTS totp_last_step;
+ALTER TABLE "User" DROP COLUMN IF EXISTS totp_enabled;
+ALTER TABLE "User" DROP COLUMN IF EXISTS totp_secret;
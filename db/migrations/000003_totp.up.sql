@@ -0,0 +1,17 @@
+ALTER TABLE "User" ADD COLUMN totp_secret TEXT;
+ALTER TABLE "User" ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE "User" ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+
+CREATE TABLE recovery_codes (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    CONSTRAINT fk_user
+        FOREIGN KEY(user_id)
+        REFERENCES "User"(id)
+);
+
+CREATE INDEX idx_recovery_codes_user_id ON recovery_codes(user_id);
@@ -0,0 +1,4 @@
+ALTER TABLE "User" ADD COLUMN email_verified_at TIMESTAMPTZ;
+
+-- accounts created before verification existed are treated as verified
+UPDATE "User" SET email_verified_at = NOW();
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS password_reset_tokens;
+
+ALTER TABLE "User" DROP COLUMN IF EXISTS tokens_revoked_at;
@@ -0,0 +1,16 @@
+ALTER TABLE "User" ADD COLUMN tokens_revoked_at TIMESTAMPTZ;
+
+
+CREATE TABLE password_reset_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    CONSTRAINT fk_user
+        FOREIGN KEY(user_id)
+        REFERENCES "User"(id)
+);
+
+CREATE INDEX idx_password_reset_tokens_user_id ON password_reset_tokens(user_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS login_lockout_events;
+DROP TABLE IF EXISTS login_attempt_counters;
@@ -0,0 +1,18 @@
+CREATE TABLE login_attempt_counters (
+    key TEXT PRIMARY KEY,
+    failures INT NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMPTZ NOT NULL,
+    locked_until TIMESTAMPTZ NOT NULL
+);
+
+
+CREATE TABLE login_lockout_events (
+    id SERIAL PRIMARY KEY,
+    email TEXT NOT NULL,
+    ip_address TEXT NOT NULL,
+    scope TEXT NOT NULL,
+    locked_until TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX idx_login_lockout_events_email ON login_lockout_events(email);
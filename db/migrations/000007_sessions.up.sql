@@ -0,0 +1,22 @@
+CREATE TABLE sessions (
+    id TEXT PRIMARY KEY,
+    user_id INT NOT NULL,
+    device_name TEXT,
+    user_agent TEXT,
+    ip_address TEXT,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    last_seen_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ,
+    CONSTRAINT fk_user
+        FOREIGN KEY(user_id)
+        REFERENCES "User"(id)
+);
+
+CREATE INDEX idx_sessions_user_id ON sessions(user_id);
+
+-- every existing refresh token family becomes a session
+INSERT INTO sessions (id, user_id, device_name, created_at, last_seen_at, revoked_at)
+SELECT family_id, MIN(user_id), 'Unknown device', MIN(created_at), MAX(created_at),
+       CASE WHEN BOOL_AND(revoked_at IS NOT NULL) THEN MAX(revoked_at) END
+FROM refresh_tokens
+GROUP BY family_id;
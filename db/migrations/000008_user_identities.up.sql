@@ -0,0 +1,14 @@
+CREATE TABLE user_identities (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    issuer TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    email TEXT,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    CONSTRAINT fk_user
+        FOREIGN KEY(user_id)
+        REFERENCES "User"(id)
+);
+
+CREATE UNIQUE INDEX idx_user_identities_issuer_subject ON user_identities(issuer, subject);
+CREATE INDEX idx_user_identities_user_id ON user_identities(user_id);
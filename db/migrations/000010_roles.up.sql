@@ -0,0 +1,23 @@
+ALTER TABLE "User" ADD COLUMN role TEXT NOT NULL DEFAULT 'user';
+ALTER TABLE "User" ADD COLUMN disabled_at TIMESTAMPTZ;
+ALTER TABLE "User" ADD COLUMN password_reset_required BOOLEAN NOT NULL DEFAULT FALSE;
+
+
+CREATE TABLE audit_logs (
+    id SERIAL PRIMARY KEY,
+    actor_id INT,
+    action TEXT NOT NULL,
+    target_user_id INT,
+    details TEXT,
+    ip_address TEXT,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    CONSTRAINT fk_actor
+        FOREIGN KEY(actor_id)
+        REFERENCES "User"(id),
+    CONSTRAINT fk_target_user
+        FOREIGN KEY(target_user_id)
+        REFERENCES "User"(id)
+);
+
+CREATE INDEX idx_audit_logs_target_user_id ON audit_logs(target_user_id);
+CREATE INDEX idx_audit_logs_created_at ON audit_logs(created_at);
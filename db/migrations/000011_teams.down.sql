@@ -0,0 +1,7 @@
+ALTER TABLE SuperSecret DROP COLUMN IF EXISTS team_id;
+ALTER TABLE SecureFile DROP COLUMN IF EXISTS team_id;
+
+DROP TABLE IF EXISTS team_members;
+DROP TABLE IF EXISTS teams;
+DROP TABLE IF EXISTS organization_members;
+DROP TABLE IF EXISTS organizations;
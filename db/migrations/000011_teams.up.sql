@@ -0,0 +1,56 @@
+CREATE TABLE organizations (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE TABLE organization_members (
+    id SERIAL PRIMARY KEY,
+    organization_id INT NOT NULL,
+    user_id INT NOT NULL,
+    role TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    CONSTRAINT fk_organization
+        FOREIGN KEY(organization_id)
+        REFERENCES organizations(id),
+    CONSTRAINT fk_user
+        FOREIGN KEY(user_id)
+        REFERENCES "User"(id)
+);
+
+CREATE UNIQUE INDEX idx_organization_members_org_user ON organization_members(organization_id, user_id);
+
+CREATE TABLE teams (
+    id SERIAL PRIMARY KEY,
+    organization_id INT NOT NULL,
+    name TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    CONSTRAINT fk_organization
+        FOREIGN KEY(organization_id)
+        REFERENCES organizations(id)
+);
+
+CREATE INDEX idx_teams_organization_id ON teams(organization_id);
+
+CREATE TABLE team_members (
+    id SERIAL PRIMARY KEY,
+    team_id INT NOT NULL,
+    user_id INT NOT NULL,
+    role TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    CONSTRAINT fk_team
+        FOREIGN KEY(team_id)
+        REFERENCES teams(id),
+    CONSTRAINT fk_user
+        FOREIGN KEY(user_id)
+        REFERENCES "User"(id)
+);
+
+CREATE UNIQUE INDEX idx_team_members_team_user ON team_members(team_id, user_id);
+CREATE INDEX idx_team_members_user_id ON team_members(user_id);
+
+
+ALTER TABLE SecureFile ADD COLUMN team_id INT REFERENCES teams(id);
+ALTER TABLE SuperSecret ADD COLUMN team_id INT REFERENCES teams(id);
+CREATE INDEX idx_secure_file_team_id ON SecureFile(team_id);
+CREATE INDEX idx_super_secret_team_id ON SuperSecret(team_id);
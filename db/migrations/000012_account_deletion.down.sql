@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS account_tombstones;
+
+DROP INDEX IF EXISTS idx_user_deletion_scheduled_at;
+ALTER TABLE "User" DROP COLUMN IF EXISTS deletion_scheduled_at;
+ALTER TABLE "User" DROP COLUMN IF EXISTS deletion_requested_at;
@@ -0,0 +1,19 @@
+ALTER TABLE "User" ADD COLUMN deletion_requested_at TIMESTAMPTZ;
+ALTER TABLE "User" ADD COLUMN deletion_scheduled_at TIMESTAMPTZ;
+CREATE INDEX idx_user_deletion_scheduled_at ON "User"(deletion_scheduled_at) WHERE deletion_scheduled_at IS NOT NULL;
+
+-- audit entries must outlive the accounts they mention
+ALTER TABLE audit_logs DROP CONSTRAINT IF EXISTS fk_actor;
+ALTER TABLE audit_logs DROP CONSTRAINT IF EXISTS fk_target_user;
+
+
+CREATE TABLE account_tombstones (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL UNIQUE,
+    email_hash TEXT NOT NULL,
+    deletion_requested_at TIMESTAMPTZ NOT NULL,
+    purged_at TIMESTAMPTZ NOT NULL,
+    files_deleted BIGINT NOT NULL DEFAULT 0,
+    secrets_deleted BIGINT NOT NULL DEFAULT 0,
+    shares_deleted BIGINT NOT NULL DEFAULT 0
+);
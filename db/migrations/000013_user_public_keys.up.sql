@@ -0,0 +1,19 @@
+CREATE TABLE user_public_keys (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    algorithm TEXT NOT NULL,
+    public_key TEXT NOT NULL,
+    fingerprint TEXT NOT NULL UNIQUE,
+    signature TEXT NOT NULL,
+    signed_by_id INT,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    retired_at TIMESTAMPTZ,
+    CONSTRAINT fk_user
+        FOREIGN KEY(user_id)
+        REFERENCES "User"(id),
+    CONSTRAINT fk_signed_by
+        FOREIGN KEY(signed_by_id)
+        REFERENCES user_public_keys(id)
+);
+
+CREATE INDEX idx_user_public_keys_user_id ON user_public_keys(user_id);
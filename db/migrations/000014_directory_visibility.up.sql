@@ -0,0 +1 @@
+ALTER TABLE "User" ADD COLUMN directory_visibility TEXT NOT NULL DEFAULT 'everyone';
@@ -0,0 +1,16 @@
+CREATE TABLE login_attempts (
+    id SERIAL PRIMARY KEY,
+    user_id INT,
+    email TEXT NOT NULL,
+    method TEXT NOT NULL,
+    outcome TEXT NOT NULL,
+    ip_address TEXT,
+    user_agent TEXT,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    CONSTRAINT fk_user
+        FOREIGN KEY(user_id)
+        REFERENCES "User"(id)
+);
+
+CREATE INDEX idx_login_attempts_user_id ON login_attempts(user_id, created_at);
+CREATE INDEX idx_login_attempts_location ON login_attempts(user_id, ip_address, user_agent) WHERE outcome = 'success';
@@ -0,0 +1,5 @@
+ALTER TABLE SecureFile DROP COLUMN IF EXISTS sha256;
+ALTER TABLE SecureFile DROP COLUMN IF EXISTS size_bytes;
+ALTER TABLE SecureFile DROP COLUMN IF EXISTS content_type;
+ALTER TABLE SecureFile DROP COLUMN IF EXISTS storage_key;
+ALTER TABLE SecureFile ALTER COLUMN file_data SET NOT NULL;
@@ -0,0 +1,7 @@
+ALTER TABLE SecureFile ALTER COLUMN file_data DROP NOT NULL;
+ALTER TABLE SecureFile ADD COLUMN storage_key TEXT;
+ALTER TABLE SecureFile ADD COLUMN content_type TEXT;
+ALTER TABLE SecureFile ADD COLUMN size_bytes BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE SecureFile ADD COLUMN sha256 TEXT;
+
+UPDATE SecureFile SET size_bytes = octet_length(file_data) WHERE file_data IS NOT NULL;
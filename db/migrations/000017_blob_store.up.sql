@@ -0,0 +1,5 @@
+CREATE TABLE blob_deletions (
+    id SERIAL PRIMARY KEY,
+    storage_key TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
@@ -0,0 +1,4 @@
+ALTER TABLE SecureFile DROP COLUMN IF EXISTS encryption_wrapped_key;
+ALTER TABLE SecureFile DROP COLUMN IF EXISTS encryption_key_id;
+ALTER TABLE SecureFile DROP COLUMN IF EXISTS encryption_key_algorithm;
+ALTER TABLE SecureFile DROP COLUMN IF EXISTS encryption_algorithm;
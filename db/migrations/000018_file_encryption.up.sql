@@ -0,0 +1,4 @@
+ALTER TABLE SecureFile ADD COLUMN encryption_algorithm TEXT;
+ALTER TABLE SecureFile ADD COLUMN encryption_key_algorithm TEXT;
+ALTER TABLE SecureFile ADD COLUMN encryption_key_id TEXT;
+ALTER TABLE SecureFile ADD COLUMN encryption_wrapped_key TEXT;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS file_upload_parts;
+DROP TABLE IF EXISTS file_uploads;
@@ -0,0 +1,36 @@
+CREATE TABLE file_uploads (
+    id TEXT PRIMARY KEY,
+    user_id INT NOT NULL,
+    team_id INT,
+    file_name TEXT NOT NULL,
+    content_type TEXT,
+    upload_length BIGINT NOT NULL,
+    upload_offset BIGINT NOT NULL DEFAULT 0,
+    hash_state BYTEA,
+    file_id TEXT,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    CONSTRAINT fk_user
+        FOREIGN KEY(user_id)
+        REFERENCES "User"(id)
+);
+
+CREATE INDEX idx_file_uploads_user_id ON file_uploads(user_id);
+CREATE INDEX idx_file_uploads_expires_at ON file_uploads(expires_at);
+
+CREATE TABLE file_upload_parts (
+    id SERIAL PRIMARY KEY,
+    upload_id TEXT NOT NULL,
+    start_offset BIGINT NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    storage_key TEXT NOT NULL,
+    encryption_algorithm TEXT,
+    encryption_key_algorithm TEXT,
+    encryption_key_id TEXT,
+    encryption_wrapped_key TEXT,
+    CONSTRAINT fk_upload
+        FOREIGN KEY(upload_id)
+        REFERENCES file_uploads(id)
+);
+
+CREATE UNIQUE INDEX idx_file_upload_parts_offset ON file_upload_parts(upload_id, start_offset);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS file_versions;
+ALTER TABLE SecureFile DROP COLUMN IF EXISTS version;
@@ -0,0 +1,26 @@
+ALTER TABLE SecureFile ADD COLUMN version INT NOT NULL DEFAULT 1;
+
+CREATE TABLE file_versions (
+    id SERIAL PRIMARY KEY,
+    file_id TEXT NOT NULL,
+    version INT NOT NULL,
+    storage_key TEXT NOT NULL,
+    content_type TEXT,
+    size_bytes BIGINT NOT NULL,
+    sha256 TEXT,
+    encryption_algorithm TEXT,
+    encryption_key_algorithm TEXT,
+    encryption_key_id TEXT,
+    encryption_wrapped_key TEXT,
+    restored_from INT,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_file_versions_file_version ON file_versions(file_id, version);
+
+INSERT INTO file_versions (file_id, version, storage_key, content_type, size_bytes, sha256,
+    encryption_algorithm, encryption_key_algorithm, encryption_key_id, encryption_wrapped_key, created_at)
+SELECT id, 1, storage_key, content_type, size_bytes, sha256,
+    encryption_algorithm, encryption_key_algorithm, encryption_key_id, encryption_wrapped_key, created_at
+FROM SecureFile
+WHERE storage_key IS NOT NULL AND storage_key <> '';
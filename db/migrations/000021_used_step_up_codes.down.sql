@@ -0,0 +1 @@
+DROP TABLE IF EXISTS used_step_up_codes;
@@ -0,0 +1,7 @@
+CREATE TABLE used_step_up_codes (
+    code_hash TEXT PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX idx_used_step_up_codes_expires_at ON used_step_up_codes(expires_at);
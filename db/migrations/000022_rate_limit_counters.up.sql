@@ -0,0 +1,9 @@
+CREATE TABLE rate_limit_counters (
+    key TEXT PRIMARY KEY,
+    count INT NOT NULL DEFAULT 0,
+    window_ends_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_rate_limit_counters_window_ends_at ON rate_limit_counters(window_ends_at);
+
+DELETE FROM login_attempt_counters WHERE key LIKE 'rate:%';
@@ -0,0 +1 @@
+ALTER TABLE SecureFile ADD COLUMN IF NOT EXISTS original_id BIGINT NOT NULL DEFAULT 0;
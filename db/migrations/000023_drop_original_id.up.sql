@@ -0,0 +1 @@
+ALTER TABLE SecureFile DROP COLUMN IF EXISTS original_id;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_file_uploads_finished;
+ALTER TABLE file_uploads DROP COLUMN IF EXISTS assembling_until;
@@ -0,0 +1,3 @@
+ALTER TABLE file_uploads ADD COLUMN assembling_until TIMESTAMPTZ;
+
+CREATE INDEX idx_file_uploads_finished ON file_uploads(created_at) WHERE file_id IS NULL AND upload_offset = upload_length;
@@ -0,0 +1 @@
+CREATE INDEX idx_login_attempts_created_at ON login_attempts(created_at);
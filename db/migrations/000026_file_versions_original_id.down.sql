@@ -0,0 +1,5 @@
+ALTER INDEX IF EXISTS idx_file_versions_original_version RENAME TO idx_file_versions_file_version;
+ALTER TABLE file_versions RENAME COLUMN original_id TO file_id;
+
+DROP INDEX IF EXISTS idx_secure_files_original_id;
+ALTER TABLE SecureFile DROP COLUMN IF EXISTS original_id;
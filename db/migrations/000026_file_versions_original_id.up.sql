@@ -0,0 +1,10 @@
+-- Versions hang off the id of the file their history started from. The
+-- BIGINT original_id from the first schema could not hold a file id and was
+-- dropped in 000023; it comes back as TEXT, set to the file's own id.
+ALTER TABLE SecureFile ADD COLUMN original_id TEXT;
+UPDATE SecureFile SET original_id = id;
+ALTER TABLE SecureFile ALTER COLUMN original_id SET NOT NULL;
+CREATE INDEX idx_secure_files_original_id ON SecureFile(original_id);
+
+ALTER TABLE file_versions RENAME COLUMN file_id TO original_id;
+ALTER INDEX idx_file_versions_file_version RENAME TO idx_file_versions_original_version;
@@ -0,0 +1,64 @@
+package orms
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/subashshakya/SFSS/models"
+)
+
+const accessTokenTouchInterval = time.Minute
+
+func CreatePersonalAccessToken(ctx context.Context, token *models.PersonalAccessToken) error {
+	if token.UserId == 0 {
+		return errors.New("UserID cannot be zero")
+	}
+	return DatabaseConnection.WithContext(ctx).Omit("User").Create(token).Error
+}
+
+// GetActivePersonalAccessToken returns the unrevoked, unexpired token with the
+// given hash, or nil when there is none.
+func GetActivePersonalAccessToken(ctx context.Context, tokenHash string) (*models.PersonalAccessToken, error) {
+	var token models.PersonalAccessToken
+	result := DatabaseConnection.WithContext(ctx).
+		Where("token_hash = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", tokenHash, time.Now()).
+		Limit(1).
+		Find(&token)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &token, nil
+}
+
+func TouchPersonalAccessToken(ctx context.Context, tokenId uint) error {
+	now := time.Now()
+	return DatabaseConnection.WithContext(ctx).Model(&models.PersonalAccessToken{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", tokenId, now.Add(-accessTokenTouchInterval)).
+		Update("last_used_at", now).Error
+}
+
+func GetPersonalAccessTokensOfAUser(ctx context.Context, userId uint) ([]models.PersonalAccessToken, error) {
+	var tokens []models.PersonalAccessToken
+	result := DatabaseConnection.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL", userId).
+		Order("created_at DESC").
+		Find(&tokens)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return tokens, nil
+}
+
+func RevokePersonalAccessToken(ctx context.Context, userId uint, tokenId uint) (bool, error) {
+	result := DatabaseConnection.WithContext(ctx).Model(&models.PersonalAccessToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", tokenId, userId).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
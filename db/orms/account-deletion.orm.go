@@ -0,0 +1,215 @@
+package orms
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrDeletionNotPending = errors.New("account deletion is not pending")
+
+// ScheduleUserDeletion marks the account for deletion at purgeAt. Asking again
+// while a deletion is pending keeps the original schedule.
+func ScheduleUserDeletion(ctx context.Context, userId uint, purgeAt time.Time) (time.Time, error) {
+	var user models.User
+	err := DatabaseConnection.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		user, err = lockUser(tx, userId)
+		if err != nil {
+			return err
+		}
+		if user.DeletionScheduledAt.Valid {
+			return nil
+		}
+		user.DeletionScheduledAt.Time, user.DeletionScheduledAt.Valid = purgeAt, true
+		return tx.Model(&models.User{}).Where("id = ?", userId).
+			Updates(map[string]interface{}{"deletion_requested_at": time.Now(), "deletion_scheduled_at": purgeAt}).Error
+	})
+	return user.DeletionScheduledAt.Time, err
+}
+
+func CancelUserDeletion(ctx context.Context, userId uint) error {
+	result := DatabaseConnection.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND deletion_scheduled_at > ?", userId, time.Now()).
+		Updates(map[string]interface{}{"deletion_requested_at": nil, "deletion_scheduled_at": nil})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrDeletionNotPending
+	}
+	return nil
+}
+
+func GetUsersDueForDeletion(ctx context.Context, now time.Time, limit int) ([]uint, error) {
+	var userIds []uint
+	result := DatabaseConnection.WithContext(ctx).Model(&models.User{}).
+		Where("deletion_scheduled_at <= ?", now).
+		Order("deletion_scheduled_at").
+		Limit(limit).
+		Pluck("id", &userIds)
+	return userIds, result.Error
+}
+
+// PurgeUser deletes an account whose grace period is over together with its
+// personal files, secrets, shares and credentials, and leaves a tombstone.
+// Team items the user created stay with the team and are handed to an owner
+// of the organization. It returns nil when the account is not due, which
+// happens when another worker already purged it or the user cancelled.
+func PurgeUser(ctx context.Context, userId uint, now time.Time) (*models.AccountTombstone, error) {
+	var tombstone *models.AccountTombstone
+	err := DatabaseConnection.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND deletion_scheduled_at <= ?", userId, now).
+			Limit(1).Find(&user)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		if err := releaseOrganizations(tx, userId); err != nil {
+			return err
+		}
+		personalFiles := tx.Model(&models.SecureFile{}).Select("id").Where("user_id = ? AND team_id IS NULL", userId)
+		personalSecrets := tx.Model(&models.SuperSecret{}).Select("id").Where("user_id = ? AND team_id IS NULL", userId)
+		fileShares := tx.Where("sender_id = ? OR recipient_id = ? OR file_id IN (?)", userId, userId, personalFiles).Delete(&models.FileSharing{})
+		if fileShares.Error != nil {
+			return fileShares.Error
+		}
+		secretShares := tx.Where("sender_id = ? OR recipient_id = ? OR secret_id IN (?)", userId, userId, personalSecrets).Delete(&models.SecretSharing{})
+		if secretShares.Error != nil {
+			return secretShares.Error
+		}
+		if err := queueBlobDeletions(tx, personalFiles); err != nil {
+			return err
+		}
+		files := tx.Where("user_id = ? AND team_id IS NULL", userId).Delete(&models.SecureFile{})
+		if files.Error != nil {
+			return files.Error
+		}
+		secrets := tx.Where("user_id = ? AND team_id IS NULL", userId).Delete(&models.SuperSecret{})
+		if secrets.Error != nil {
+			return secrets.Error
+		}
+		uploads := tx.Model(&models.FileUpload{}).Select("id").Where("user_id = ?", userId)
+		if err := deleteFileUploadParts(tx, uploads); err != nil {
+			return err
+		}
+		for _, model := range userOwnedRecords {
+			if err := tx.Where("user_id = ?", userId).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		emailHash := sha256.Sum256([]byte(strings.ToLower(user.Email)))
+		tombstone = &models.AccountTombstone{
+			UserId:              user.Id,
+			EmailHash:           hex.EncodeToString(emailHash[:]),
+			DeletionRequestedAt: user.DeletionRequestedAt.Time,
+			PurgedAt:            now,
+			FilesDeleted:        files.RowsAffected,
+			SecretsDeleted:      secrets.RowsAffected,
+			SharesDeleted:       fileShares.RowsAffected + secretShares.RowsAffected,
+		}
+		if err := tx.Create(tombstone).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.User{}, userId).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tombstone, nil
+}
+
+// userOwnedRecords are the per-user rows removed with the account. Anything
+// new that references the user must be added here or the purge will fail on
+// its foreign key.
+var userOwnedRecords = []interface{}{
+	&models.RefreshToken{},
+	&models.Session{},
+	&models.RecoveryCode{},
+	&models.PasswordResetToken{},
+	&models.UserIdentity{},
+	&models.PersonalAccessToken{},
+	&models.UserPublicKey{},
+	&models.LoginAttempt{},
+	&models.FileUpload{},
+	&models.SecretFileCount{},
+	&models.SecretPasswordCount{},
+	&models.TeamMember{},
+	&models.OrganizationMember{},
+}
+
+// releaseOrganizations deletes organizations the user is the only member of,
+// with their teams and team items, and makes sure every other organization
+// keeps an owner. Team items the user created are reassigned to that owner.
+func releaseOrganizations(tx *gorm.DB, userId uint) error {
+	var organizationIds []uint
+	if err := tx.Model(&models.OrganizationMember{}).Where("user_id = ?", userId).Pluck("organization_id", &organizationIds).Error; err != nil {
+		return err
+	}
+	for _, organizationId := range organizationIds {
+		var otherMembers []models.OrganizationMember
+		if err := tx.Where("organization_id = ? AND user_id <> ?", organizationId, userId).Order("id").Find(&otherMembers).Error; err != nil {
+			return err
+		}
+		teams := tx.Model(&models.Team{}).Select("id").Where("organization_id = ?", organizationId)
+		if len(otherMembers) == 0 {
+			if err := deleteOrganization(tx, organizationId); err != nil {
+				return err
+			}
+			continue
+		}
+		successor := otherMembers[0]
+		for _, member := range otherMembers {
+			if member.Role == constants.MemberRoleOwner {
+				successor = member
+				break
+			}
+		}
+		if successor.Role != constants.MemberRoleOwner {
+			if err := tx.Model(&successor).Update("role", constants.MemberRoleOwner).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&models.SecureFile{}).Where("user_id = ? AND team_id IN (?)", userId, teams).Update("user_id", successor.UserId).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.SuperSecret{}).Where("user_id = ? AND team_id IN (?)", userId, teams).Update("user_id", successor.UserId).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteOrganization(tx *gorm.DB, organizationId uint) error {
+	teams := tx.Model(&models.Team{}).Select("id").Where("organization_id = ?", organizationId)
+	teamFiles := tx.Model(&models.SecureFile{}).Select("id").Where("team_id IN (?)", teams)
+	teamSecrets := tx.Model(&models.SuperSecret{}).Select("id").Where("team_id IN (?)", teams)
+	if err := queueBlobDeletions(tx, teamFiles); err != nil {
+		return err
+	}
+	steps := []*gorm.DB{
+		tx.Where("file_id IN (?)", teamFiles).Delete(&models.FileSharing{}),
+		tx.Where("secret_id IN (?)", teamSecrets).Delete(&models.SecretSharing{}),
+		tx.Where("team_id IN (?)", teams).Delete(&models.SecureFile{}),
+		tx.Where("team_id IN (?)", teams).Delete(&models.SuperSecret{}),
+		tx.Where("team_id IN (?)", teams).Delete(&models.TeamMember{}),
+		tx.Where("organization_id = ?", organizationId).Delete(&models.Team{}),
+		tx.Where("organization_id = ?", organizationId).Delete(&models.OrganizationMember{}),
+		tx.Where("id = ?", organizationId).Delete(&models.Organization{}),
+	}
+	for _, step := range steps {
+		if step.Error != nil {
+			return step.Error
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package orms
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/models"
+	"gorm.io/gorm/clause"
+)
+
+func TestScheduleAndCancelUserDeletion(t *testing.T) {
+	db := useTestDatabase(t)
+	ctx := context.Background()
+	user := models.User{FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com", Password: "x", PhoneNumber: "0"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	purgeAt := time.Now().Add(time.Hour).Truncate(time.Microsecond)
+	scheduled, err := ScheduleUserDeletion(ctx, user.Id, purgeAt)
+	if err != nil || !scheduled.Equal(purgeAt) {
+		t.Fatalf("ScheduleUserDeletion = %s, %v", scheduled, err)
+	}
+	if again, _ := ScheduleUserDeletion(ctx, user.Id, purgeAt.Add(time.Hour)); !again.Equal(purgeAt) {
+		t.Errorf("asking again moved the schedule to %s", again)
+	}
+	if due, _ := GetUsersDueForDeletion(ctx, time.Now(), 10); len(due) != 0 {
+		t.Errorf("due during the grace period: %v", due)
+	}
+	if due, _ := GetUsersDueForDeletion(ctx, purgeAt, 10); len(due) != 1 || due[0] != user.Id {
+		t.Errorf("due after the grace period = %v", due)
+	}
+
+	if err := CancelUserDeletion(ctx, user.Id); err != nil {
+		t.Fatal(err)
+	}
+	if err := CancelUserDeletion(ctx, user.Id); !errors.Is(err, ErrDeletionNotPending) {
+		t.Errorf("second cancel err = %v", err)
+	}
+	if due, _ := GetUsersDueForDeletion(ctx, purgeAt, 10); len(due) != 0 {
+		t.Errorf("cancelled account still due: %v", due)
+	}
+	if _, err := ScheduleUserDeletion(ctx, 9999, purgeAt); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown user err = %v", err)
+	}
+}
+
+func TestPurgeUser(t *testing.T) {
+	db := useTestDatabase(t, &models.SecureFile{}, &models.FileVersion{}, &models.SuperSecret{},
+		&models.FileSharing{}, &models.SecretSharing{}, &models.BlobDeletion{}, &models.AccountTombstone{},
+		&models.Organization{}, &models.OrganizationMember{}, &models.Team{}, &models.TeamMember{},
+		&models.FileUpload{}, &models.FileUploadPart{}, &models.RefreshToken{}, &models.Session{},
+		&models.RecoveryCode{}, &models.PasswordResetToken{}, &models.UserIdentity{}, &models.PersonalAccessToken{},
+		&models.UserPublicKey{}, &models.LoginAttempt{}, &models.SecretFileCount{}, &models.SecretPasswordCount{})
+	ctx := context.Background()
+	users := []models.User{
+		{FirstName: "Ada", LastName: "Leaving", Email: "Ada@Example.com", Password: "x", PhoneNumber: "0"},
+		{FirstName: "Bob", LastName: "Staying", Email: "bob@example.com", Password: "x", PhoneNumber: "0"},
+	}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	leaving, staying := users[0], users[1]
+	organization := models.Organization{Name: "Acme"}
+	if err := CreateOrganization(ctx, &organization, leaving.Id); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetOrganizationMember(ctx, organization.Id, staying.Id, constants.MemberRoleMember); err != nil {
+		t.Fatal(err)
+	}
+	team := models.Team{OrganizationId: organization.Id, Name: "Ops"}
+	if err := CreateTeam(ctx, &team, leaving.Id); err != nil {
+		t.Fatal(err)
+	}
+	personal := models.SecureFile{Id: "personal", FileName: "diary.txt", StorageKey: "personal-key", UserId: int(leaving.Id)}
+	teamFile := models.SecureFile{Id: "team", FileName: "runbook.md", StorageKey: "team-key", UserId: int(leaving.Id), TeamId: &team.Id}
+	secret := models.SuperSecret{Id: "secret", Secret: "s", UserId: leaving.Id}
+	received := models.FileSharing{FileId: "team", SenderId: staying.Id, RecipientId: leaving.Id}
+	for _, row := range []interface{}{&personal, &teamFile, &secret, &received} {
+		if err := db.Omit(clause.Associations).Create(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	startSessions(t, leaving.Id, 1)
+	purgeAt := time.Now().Add(time.Hour)
+	if _, err := ScheduleUserDeletion(ctx, leaving.Id, purgeAt); err != nil {
+		t.Fatal(err)
+	}
+
+	if tombstone, err := PurgeUser(ctx, leaving.Id, time.Now()); err != nil || tombstone != nil {
+		t.Fatalf("purged during the grace period: %+v, %v", tombstone, err)
+	}
+	tombstone, err := PurgeUser(ctx, leaving.Id, purgeAt)
+	if err != nil || tombstone == nil {
+		t.Fatalf("PurgeUser = %+v, %v", tombstone, err)
+	}
+	if tombstone.FilesDeleted != 1 || tombstone.SecretsDeleted != 1 || tombstone.SharesDeleted != 1 {
+		t.Errorf("tombstone = %+v", tombstone)
+	}
+	if tombstone.EmailHash == "" || tombstone.EmailHash == leaving.Email {
+		t.Errorf("tombstone keeps the email as %q", tombstone.EmailHash)
+	}
+	if again, err := PurgeUser(ctx, leaving.Id, purgeAt); err != nil || again != nil {
+		t.Errorf("second purge = %+v, %v", again, err)
+	}
+
+	var count int64
+	db.Model(&models.User{}).Where("id = ?", leaving.Id).Count(&count)
+	if count != 0 {
+		t.Error("the user row is still there")
+	}
+	db.Model(&models.Session{}).Where("user_id = ?", leaving.Id).Count(&count)
+	if count != 0 {
+		t.Error("sessions of the purged user are still there")
+	}
+	var storageKeys []string
+	db.Model(&models.BlobDeletion{}).Pluck("storage_key", &storageKeys)
+	if len(storageKeys) != 1 || storageKeys[0] != "personal-key" {
+		t.Errorf("queued blobs %v, want only the personal file", storageKeys)
+	}
+	var kept models.SecureFile
+	if err := db.First(&kept, "id = ?", "team").Error; err != nil || kept.UserId != int(staying.Id) {
+		t.Errorf("team file = %+v, %v, want it handed to the remaining member", kept, err)
+	}
+	var member models.OrganizationMember
+	db.First(&member, "organization_id = ? AND user_id = ?", organization.Id, staying.Id)
+	if member.Role != constants.MemberRoleOwner {
+		t.Errorf("remaining member role = %s, want owner", member.Role)
+	}
+}
@@ -0,0 +1,163 @@
+package orms
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/subashshakya/SFSS/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const AuditActionRoleChange = "user.role_change"
+const AuditActionDisable = "user.disable"
+const AuditActionEnable = "user.enable"
+const AuditActionForcePasswordReset = "user.force_password_reset"
+
+// SearchUsers matches query as a prefix of the email, first or last name. An
+// empty query lists every user.
+func SearchUsers(ctx context.Context, query string, limit int, offset int) ([]models.User, int64, error) {
+	var users []models.User
+	var total int64
+	db := DatabaseConnection.WithContext(ctx).Model(&models.User{})
+	if query != "" {
+		pattern := escapeLike(query) + "%"
+		db = db.Where("email ILIKE ? OR first_name ILIKE ? OR last_name ILIKE ?", pattern, pattern, pattern)
+	}
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := db.Order("id").Limit(limit).Offset(offset).Find(&users).Error; err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// SetUserRole changes the role of a user and records who did it. A nil actor
+// means the change was made from the command line.
+func SetUserRole(ctx context.Context, actorId *uint, userId uint, role string, ipAddress string) error {
+	return DatabaseConnection.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		user, err := lockUser(tx, userId)
+		if err != nil {
+			return err
+		}
+		if user.Role == role {
+			return nil
+		}
+		if err := tx.Model(&models.User{}).Where("id = ?", userId).Update("role", role).Error; err != nil {
+			return err
+		}
+		return createAuditLog(tx, actorId, AuditActionRoleChange, userId, fmt.Sprintf("%s -> %s", user.Role, role), ipAddress)
+	})
+}
+
+// SetUserDisabled disables or re-enables an account. Disabling also ends every
+// session and invalidates issued access tokens.
+func SetUserDisabled(ctx context.Context, actorId uint, userId uint, disabled bool, ipAddress string) error {
+	return DatabaseConnection.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if _, err := lockUser(tx, userId); err != nil {
+			return err
+		}
+		if !disabled {
+			if err := tx.Model(&models.User{}).Where("id = ?", userId).Update("disabled_at", nil).Error; err != nil {
+				return err
+			}
+			return createAuditLog(tx, &actorId, AuditActionEnable, userId, "", ipAddress)
+		}
+		now := time.Now()
+		if err := tx.Model(&models.User{}).Where("id = ?", userId).
+			Updates(map[string]interface{}{"disabled_at": now, "tokens_revoked_at": now}).Error; err != nil {
+			return err
+		}
+		if _, err := revokeSessionsOfAUser(tx, userId, "", now); err != nil {
+			return err
+		}
+		return createAuditLog(tx, &actorId, AuditActionDisable, userId, "", ipAddress)
+	})
+}
+
+// ForcePasswordReset signs the user out everywhere and blocks sign-in until
+// the password has been reset.
+func ForcePasswordReset(ctx context.Context, actorId uint, userId uint, ipAddress string) error {
+	return DatabaseConnection.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if _, err := lockUser(tx, userId); err != nil {
+			return err
+		}
+		now := time.Now()
+		if err := tx.Model(&models.User{}).Where("id = ?", userId).
+			Updates(map[string]interface{}{"password_reset_required": true, "tokens_revoked_at": now}).Error; err != nil {
+			return err
+		}
+		if _, err := revokeSessionsOfAUser(tx, userId, "", now); err != nil {
+			return err
+		}
+		return createAuditLog(tx, &actorId, AuditActionForcePasswordReset, userId, "", ipAddress)
+	})
+}
+
+func GetStorageStats(ctx context.Context) (models.StorageStats, error) {
+	var stats models.StorageStats
+	db := DatabaseConnection.WithContext(ctx)
+	if err := db.Model(&models.User{}).Count(&stats.Users).Error; err != nil {
+		return stats, err
+	}
+	if err := db.Model(&models.User{}).Where("disabled_at IS NOT NULL").Count(&stats.DisabledUsers).Error; err != nil {
+		return stats, err
+	}
+	if err := db.Model(&models.SecureFile{}).Count(&stats.Files).Error; err != nil {
+		return stats, err
+	}
+	if err := db.Model(&models.SecureFile{}).Select("COALESCE(SUM(size_bytes), 0)").Scan(&stats.FileBytes).Error; err != nil {
+		return stats, err
+	}
+	if err := db.Model(&models.SuperSecret{}).Count(&stats.Secrets).Error; err != nil {
+		return stats, err
+	}
+	if err := db.Model(&models.FileSharing{}).Count(&stats.FileShares).Error; err != nil {
+		return stats, err
+	}
+	if err := db.Model(&models.SecretSharing{}).Count(&stats.SecretShares).Error; err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
+
+func GetAuditLogs(ctx context.Context, targetUserId uint, limit int, offset int) ([]models.AuditLog, error) {
+	var logs []models.AuditLog
+	db := DatabaseConnection.WithContext(ctx)
+	if targetUserId != 0 {
+		db = db.Where("target_user_id = ?", targetUserId)
+	}
+	if err := db.Order("created_at DESC").Limit(limit).Offset(offset).Find(&logs).Error; err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+func lockUser(tx *gorm.DB, userId uint) (models.User, error) {
+	var user models.User
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", userId).Limit(1).Find(&user)
+	if result.Error != nil {
+		return user, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return user, ErrNotFound
+	}
+	return user, nil
+}
+
+func createAuditLog(tx *gorm.DB, actorId *uint, action string, targetUserId uint, details string, ipAddress string) error {
+	return tx.Create(&models.AuditLog{
+		ActorId:      actorId,
+		Action:       action,
+		TargetUserId: &targetUserId,
+		Details:      details,
+		IpAddress:    ipAddress,
+	}).Error
+}
@@ -0,0 +1,68 @@
+package orms
+
+import (
+	"context"
+	"testing"
+
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/models"
+)
+
+func TestEscapeLike(t *testing.T) {
+	if got := escapeLike(`50%_off\`); got != `50\%\_off\\` {
+		t.Errorf("escapeLike = %s", got)
+	}
+}
+
+func TestAdminActionsAreAudited(t *testing.T) {
+	db := useTestDatabase(t, &models.Session{}, &models.RefreshToken{}, &models.AuditLog{})
+	ctx := context.Background()
+	users := []models.User{
+		{FirstName: "Ada", LastName: "Admin", Email: "ada@example.com", Password: "x", PhoneNumber: "0", Role: constants.RoleAdmin},
+		{FirstName: "Bob", LastName: "User", Email: "bob@example.com", Password: "x", PhoneNumber: "0", Role: constants.RoleUser},
+	}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	admin, target := users[0], users[1]
+	session := models.Session{UserId: target.Id}
+	if err := CreateSession(ctx, &session); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetUserRole(ctx, &admin.Id, target.Id, constants.RoleAuditor, "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	// setting the same role again changes nothing and is not logged
+	if err := SetUserRole(ctx, &admin.Id, target.Id, constants.RoleAuditor, "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetUserDisabled(ctx, admin.Id, target.Id, true, "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err := GetUser(ctx, target.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Role != constants.RoleAuditor || !updated.DisabledAt.Valid || !updated.TokensRevokedAt.Valid {
+		t.Fatalf("user after admin actions = %+v", updated)
+	}
+	if active, _ := GetActiveSession(ctx, session.Id); active != nil {
+		t.Error("disabling the user left a session active")
+	}
+	logs, err := GetAuditLogs(ctx, target.Id, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions := map[string]int{}
+	for _, log := range logs {
+		if log.ActorId == nil || *log.ActorId != admin.Id || log.IpAddress != "10.0.0.1" {
+			t.Errorf("audit log %+v does not name the actor", log)
+		}
+		actions[log.Action]++
+	}
+	if len(logs) != 2 || actions[AuditActionRoleChange] != 1 || actions[AuditActionDisable] != 1 {
+		t.Fatalf("audit logs = %+v", logs)
+	}
+}
@@ -0,0 +1,143 @@
+package orms
+
+import (
+	"context"
+
+	"github.com/subashshakya/SFSS/models"
+	"gorm.io/gorm"
+)
+
+// queueBlobDeletions records the content of the given files and of all
+// their versions, a list of ids or a subquery selecting them, for removal
+// from the blob store, and drops the versions. It has to run in the
+// transaction that deletes the files, so the content is only removed once
+// nothing refers to it.
+func queueBlobDeletions(tx *gorm.DB, fileIds interface{}) error {
+	storageKeys := tx.Model(&models.SecureFile{}).Select("storage_key").
+		Where("id IN (?) AND storage_key <> ''", fileIds)
+	originalIds := tx.Model(&models.SecureFile{}).Select("original_id").Where("id IN (?)", fileIds)
+	versionKeys := tx.Model(&models.FileVersion{}).Select("storage_key").
+		Where("original_id IN (?) AND storage_key <> ''", originalIds)
+	if err := tx.Exec("INSERT INTO blob_deletions (storage_key) ? UNION ?", storageKeys, versionKeys).Error; err != nil {
+		return err
+	}
+	return tx.Where("original_id IN (?)", originalIds).Delete(&models.FileVersion{}).Error
+}
+
+func GetBlobDeletions(ctx context.Context, limit int) ([]models.BlobDeletion, error) {
+	var deletions []models.BlobDeletion
+	result := DatabaseConnection.WithContext(ctx).Order("id").Limit(limit).Find(&deletions)
+	return deletions, result.Error
+}
+
+func RemoveBlobDeletion(ctx context.Context, id uint) error {
+	return DatabaseConnection.WithContext(ctx).Delete(&models.BlobDeletion{}, id).Error
+}
+
+// GetFilesWithInlineData returns files whose content has not been moved to
+// the blob store yet. Files without any content come back with empty data.
+func GetFilesWithInlineData(ctx context.Context, limit int) ([]models.InlineFileData, error) {
+	var files []models.InlineFileData
+	result := DatabaseConnection.WithContext(ctx).Model(&models.SecureFile{}).
+		Select("id, COALESCE(file_data, ''::bytea) AS file_data").
+		Where("storage_key IS NULL OR storage_key = ''").
+		Order("id").Limit(limit).
+		Find(&files)
+	return files, result.Error
+}
+
+// GetInlineFileData returns the content of a file that has not been moved to
+// the blob store yet, or nil once it has been.
+func GetInlineFileData(ctx context.Context, fileId string) ([]byte, error) {
+	var file models.InlineFileData
+	result := DatabaseConnection.WithContext(ctx).Model(&models.SecureFile{}).
+		Select("id, COALESCE(file_data, ''::bytea) AS file_data").
+		Where("id = ? AND (storage_key IS NULL OR storage_key = '')", fileId).
+		Limit(1).Find(&file)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, result.Error
+	}
+	return file.FileData, nil
+}
+
+// MoveFileDataToStorage points the file at content copied to the blob store,
+// drops the inline copy and records the content as the first version. It
+// returns false when the file was deleted or already moved in the meantime.
+func MoveFileDataToStorage(ctx context.Context, stored *models.SecureFile) (bool, error) {
+	var moved bool
+	err := DatabaseConnection.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		updates := contentUpdates(stored)
+		updates["file_data"] = nil
+		result := tx.Model(&models.SecureFile{}).
+			Where("id = ? AND (storage_key IS NULL OR storage_key = '')", stored.Id).
+			Updates(updates)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		var secureFile models.SecureFile
+		if err := tx.Where("id = ?", stored.Id).First(&secureFile).Error; err != nil {
+			return err
+		}
+		moved = true
+		return addFileVersion(tx, &secureFile, nil)
+	})
+	return moved && err == nil, err
+}
+
+// plainContent selects rows whose stored content is not encrypted. Columns
+// added by the encryption migration are NULL on rows from before it.
+const plainContent = "storage_key <> '' AND (encryption_algorithm IS NULL OR encryption_algorithm = '')"
+
+// GetPlainStorageKeys returns up to limit storage keys after the given one
+// whose content a file or a version stores unencrypted, in key order.
+func GetPlainStorageKeys(ctx context.Context, after string, limit int) ([]string, error) {
+	var storageKeys []string
+	db := DatabaseConnection.WithContext(ctx)
+	fileKeys := db.Model(&models.SecureFile{}).Select("storage_key").Where(plainContent).Where("storage_key > ?", after)
+	versionKeys := db.Model(&models.FileVersion{}).Select("storage_key").Where(plainContent).Where("storage_key > ?", after)
+	result := db.Raw("? UNION ? ORDER BY 1 LIMIT ?", fileKeys, versionKeys, limit).Scan(&storageKeys)
+	return storageKeys, result.Error
+}
+
+// ReplacePlainContent points every file and version that stores the plain
+// content under plainKey at its encrypted copy, and queues the plain content
+// for deletion. It returns false when nothing refers to plainKey anymore.
+func ReplacePlainContent(ctx context.Context, plainKey string, encrypted *models.SecureFile) (bool, error) {
+	var replaced bool
+	err := DatabaseConnection.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{
+			"storage_key":              encrypted.StorageKey,
+			"encryption_algorithm":     encrypted.Encryption.Algorithm,
+			"encryption_key_algorithm": encrypted.Encryption.KeyAlgorithm,
+			"encryption_key_id":        encrypted.Encryption.KeyId,
+			"encryption_wrapped_key":   encrypted.Encryption.WrappedKey,
+		}
+		files := tx.Model(&models.SecureFile{}).Where(plainContent).Where("storage_key = ?", plainKey).Updates(updates)
+		if files.Error != nil {
+			return files.Error
+		}
+		versions := tx.Model(&models.FileVersion{}).Where(plainContent).Where("storage_key = ?", plainKey).Updates(updates)
+		if versions.Error != nil {
+			return versions.Error
+		}
+		if files.RowsAffected+versions.RowsAffected == 0 {
+			return nil
+		}
+		replaced = true
+		return tx.Create(&models.BlobDeletion{StorageKey: plainKey}).Error
+	})
+	return replaced && err == nil, err
+}
+
+// contentUpdates are the columns that change with the stored content.
+func contentUpdates(secureFile *models.SecureFile) map[string]interface{} {
+	return map[string]interface{}{
+		"storage_key":              secureFile.StorageKey,
+		"size_bytes":               secureFile.SizeBytes,
+		"sha256":                   secureFile.Sha256,
+		"encryption_algorithm":     secureFile.Encryption.Algorithm,
+		"encryption_key_algorithm": secureFile.Encryption.KeyAlgorithm,
+		"encryption_key_id":        secureFile.Encryption.KeyId,
+		"encryption_wrapped_key":   secureFile.Encryption.WrappedKey,
+	}
+}
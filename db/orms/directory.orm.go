@@ -0,0 +1,86 @@
+package orms
+
+import (
+	"context"
+	"strings"
+
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/models"
+	"gorm.io/gorm"
+)
+
+// discoverableBy matches active users that callerId may find: those listed for
+// everyone, and those listed for their organization when the caller shares one
+// with them. Hidden users are never matched.
+func discoverableBy(callerId uint) *gorm.DB {
+	callerOrganizations := DatabaseConnection.Model(&models.OrganizationMember{}).Select("organization_id").Where("user_id = ?", callerId)
+	colleagues := DatabaseConnection.Model(&models.OrganizationMember{}).Select("user_id").Where("organization_id IN (?)", callerOrganizations)
+	visible := DatabaseConnection.Where("directory_visibility = ?", constants.DirectoryVisibilityEveryone).
+		Or("directory_visibility = ? AND id IN (?)", constants.DirectoryVisibilityOrganization, colleagues)
+	return DatabaseConnection.Where("disabled_at IS NULL AND deletion_scheduled_at IS NULL").Where(visible)
+}
+
+// FindDirectoryUserByEmail returns the user with that exact email if callerId
+// may discover them, or nil.
+func FindDirectoryUserByEmail(ctx context.Context, callerId uint, email string) (*models.User, error) {
+	var user models.User
+	result := DatabaseConnection.WithContext(ctx).
+		Where("LOWER(email) = ?", strings.ToLower(strings.TrimSpace(email))).
+		Where(discoverableBy(callerId)).
+		Limit(1).
+		Find(&user)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &user, nil
+}
+
+// FindDirectoryUserById returns the user if callerId may discover them, or
+// nil.
+func FindDirectoryUserById(ctx context.Context, callerId uint, userId uint) (*models.User, error) {
+	var user models.User
+	result := DatabaseConnection.WithContext(ctx).
+		Where("id = ?", userId).
+		Where(discoverableBy(callerId)).
+		Limit(1).
+		Find(&user)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &user, nil
+}
+
+// SearchDirectoryByName matches prefix against the first name, the last name
+// or the full display name.
+func SearchDirectoryByName(ctx context.Context, callerId uint, prefix string, limit int) ([]models.DirectoryEntry, error) {
+	entries := []models.DirectoryEntry{}
+	pattern := escapeLike(strings.TrimSpace(prefix)) + "%"
+	result := DatabaseConnection.WithContext(ctx).Model(&models.User{}).
+		Select("id", "first_name", "last_name").
+		Where("first_name ILIKE ? OR last_name ILIKE ? OR (first_name || ' ' || last_name) ILIKE ?", pattern, pattern, pattern).
+		Where(discoverableBy(callerId)).
+		Order("first_name, last_name, id").
+		Limit(limit).
+		Find(&entries)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return entries, nil
+}
+
+func SetDirectoryVisibility(ctx context.Context, userId uint, visibility string) error {
+	result := DatabaseConnection.WithContext(ctx).Model(&models.User{}).Where("id = ?", userId).Update("directory_visibility", visibility)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
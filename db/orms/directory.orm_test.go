@@ -0,0 +1,78 @@
+package orms
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/models"
+)
+
+func TestDirectoryHonoursVisibility(t *testing.T) {
+	db := useTestDatabase(t, &models.Organization{}, &models.OrganizationMember{})
+	ctx := context.Background()
+	gone := sql.NullTime{Time: time.Now(), Valid: true}
+	users := []models.User{
+		{FirstName: "Caller", LastName: "Self", Email: "caller@example.com", Password: "x", PhoneNumber: "0"},
+		{FirstName: "Ada", LastName: "Public", Email: "ada@example.com", Password: "x", PhoneNumber: "0"},
+		{FirstName: "Adam", LastName: "Colleague", Email: "adam@example.com", Password: "x", PhoneNumber: "0", DirectoryVisibility: constants.DirectoryVisibilityOrganization},
+		{FirstName: "Adele", LastName: "Stranger", Email: "adele@example.com", Password: "x", PhoneNumber: "0", DirectoryVisibility: constants.DirectoryVisibilityOrganization},
+		{FirstName: "Adrian", LastName: "Hidden", Email: "adrian@example.com", Password: "x", PhoneNumber: "0", DirectoryVisibility: constants.DirectoryVisibilityHidden},
+		{FirstName: "Adelaide", LastName: "Disabled", Email: "adelaide@example.com", Password: "x", PhoneNumber: "0", DisabledAt: gone},
+		{FirstName: "Adina", LastName: "Leaving", Email: "adina@example.com", Password: "x", PhoneNumber: "0", DeletionScheduledAt: gone},
+	}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	caller, public, colleague, stranger := users[0], users[1], users[2], users[3]
+	shared := models.Organization{Name: "Acme"}
+	if err := CreateOrganization(ctx, &shared, caller.Id); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetOrganizationMember(ctx, shared.Id, colleague.Id, constants.MemberRoleMember); err != nil {
+		t.Fatal(err)
+	}
+	other := models.Organization{Name: "Elsewhere"}
+	if err := CreateOrganization(ctx, &other, stranger.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := SearchDirectoryByName(ctx, caller.Id, "ad", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Id != public.Id || entries[1].Id != colleague.Id {
+		t.Fatalf("search found %+v, want only the public user and the colleague", entries)
+	}
+	if entries[0].Email != "" {
+		t.Error("a name search exposed an email")
+	}
+	for _, user := range users[1:] {
+		found, err := FindDirectoryUserByEmail(ctx, caller.Id, "  "+user.Email+" ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		visible := user.Id == public.Id || user.Id == colleague.Id
+		if (found != nil) != visible {
+			t.Errorf("%s found = %v, want %v", user.Email, found != nil, visible)
+		}
+		if byId, _ := FindDirectoryUserById(ctx, caller.Id, user.Id); (byId != nil) != visible {
+			t.Errorf("%d found by id = %v, want %v", user.Id, byId != nil, visible)
+		}
+	}
+	if found, _ := FindDirectoryUserByEmail(ctx, caller.Id, "ADA@EXAMPLE.COM"); found == nil {
+		t.Error("email lookup is case sensitive")
+	}
+	if entries, _ := SearchDirectoryByName(ctx, caller.Id, "%", 10); len(entries) != 0 {
+		t.Errorf("a wildcard prefix matched %+v", entries)
+	}
+
+	if err := SetDirectoryVisibility(ctx, public.Id, constants.DirectoryVisibilityHidden); err != nil {
+		t.Fatal(err)
+	}
+	if found, _ := FindDirectoryUserByEmail(ctx, caller.Id, public.Email); found != nil {
+		t.Error("user still listed after hiding")
+	}
+}
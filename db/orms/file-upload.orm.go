@@ -0,0 +1,154 @@
+package orms
+
+import (
+	"context"
+	"time"
+
+	"github.com/subashshakya/SFSS/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func CreateFileUpload(ctx context.Context, upload *models.FileUpload) error {
+	return DatabaseConnection.WithContext(ctx).Create(upload).Error
+}
+
+// GetFileUpload returns the upload only to the user who started it.
+func GetFileUpload(ctx context.Context, id string, userId uint) (*models.FileUpload, error) {
+	var upload models.FileUpload
+	result := DatabaseConnection.WithContext(ctx).Where("id = ? AND user_id = ?", id, userId).Limit(1).Find(&upload)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &upload, nil
+}
+
+func GetFileUploadParts(ctx context.Context, uploadId string) ([]models.FileUploadPart, error) {
+	var parts []models.FileUploadPart
+	result := DatabaseConnection.WithContext(ctx).Where("upload_id = ?", uploadId).Order("start_offset").Find(&parts)
+	return parts, result.Error
+}
+
+// AddFileUploadPart records a stored chunk and moves the upload to its new
+// offset, hash and expiry. It returns false when the upload is no longer at
+// fromOffset because another request got there first.
+func AddFileUploadPart(ctx context.Context, upload *models.FileUpload, fromOffset int64, part *models.FileUploadPart) (bool, error) {
+	var added bool
+	err := DatabaseConnection.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.FileUpload{}).
+			Where("id = ? AND upload_offset = ? AND file_id IS NULL", upload.Id, fromOffset).
+			Updates(map[string]interface{}{"upload_offset": upload.Offset, "hash_state": upload.HashState, "expires_at": upload.ExpiresAt})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		added = true
+		return tx.Create(part).Error
+	})
+	return added, err
+}
+
+// ClaimFinishedUpload picks an upload whose chunks have all arrived but
+// that has not become a file yet, and reserves it for assembly until
+// now+lease so that other instances leave it alone. The upload is kept from
+// expiring while it is reserved. It returns nil when there is nothing to
+// assemble.
+func ClaimFinishedUpload(ctx context.Context, now time.Time, lease time.Duration) (*models.FileUpload, error) {
+	var upload models.FileUpload
+	var claimed bool
+	err := DatabaseConnection.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("file_id IS NULL AND upload_offset = upload_length").
+			Where("assembling_until IS NULL OR assembling_until < ?", now).
+			Order("created_at").Limit(1).Find(&upload)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		until := now.Add(lease)
+		upload.AssemblingUntil = &until
+		if upload.ExpiresAt.Before(until) {
+			upload.ExpiresAt = until
+		}
+		claimed = true
+		return tx.Model(&upload).Updates(map[string]interface{}{"assembling_until": until, "expires_at": upload.ExpiresAt}).Error
+	})
+	if err != nil || !claimed {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+// CompleteFileUpload saves the file assembled from a finished upload and
+// drops the chunks. It returns false when the upload was already completed.
+func CompleteFileUpload(ctx context.Context, uploadId string, secureFile *models.SecureFile) (bool, error) {
+	var completed bool
+	err := DatabaseConnection.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var upload models.FileUpload
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND file_id IS NULL AND upload_offset = upload_length", uploadId).
+			Limit(1).Find(&upload)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		if err := tx.Create(secureFile).Error; err != nil {
+			return err
+		}
+		if err := addFileVersion(tx, secureFile, nil); err != nil {
+			return err
+		}
+		if err := deleteFileUploadParts(tx, []string{uploadId}); err != nil {
+			return err
+		}
+		completed = true
+		return tx.Model(&upload).Updates(map[string]interface{}{"file_id": secureFile.Id, "hash_state": nil}).Error
+	})
+	return completed, err
+}
+
+func DeleteFileUpload(ctx context.Context, id string, userId uint) (bool, error) {
+	var deleted bool
+	err := DatabaseConnection.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		upload := tx.Model(&models.FileUpload{}).Select("id").Where("id = ? AND user_id = ?", id, userId)
+		if err := deleteFileUploadParts(tx, upload); err != nil {
+			return err
+		}
+		result := tx.Where("id = ? AND user_id = ?", id, userId).Delete(&models.FileUpload{})
+		deleted = result.RowsAffected != 0
+		return result.Error
+	})
+	return deleted, err
+}
+
+// DeleteExpiredFileUploads removes up to limit uploads that expired before
+// now, finished or not, and returns how many it removed.
+func DeleteExpiredFileUploads(ctx context.Context, now time.Time, limit int) (int64, error) {
+	var deleted int64
+	err := DatabaseConnection.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var ids []string
+		if err := tx.Model(&models.FileUpload{}).Where("expires_at <= ?", now).Order("expires_at").Limit(limit).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		if err := deleteFileUploadParts(tx, ids); err != nil {
+			return err
+		}
+		result := tx.Where("id IN ?", ids).Delete(&models.FileUpload{})
+		deleted = result.RowsAffected
+		return result.Error
+	})
+	return deleted, err
+}
+
+// deleteFileUploadParts deletes the chunks of the given uploads, a list of
+// ids or a subquery selecting them, and queues their content for deletion.
+func deleteFileUploadParts(tx *gorm.DB, uploadIds interface{}) error {
+	storageKeys := tx.Model(&models.FileUploadPart{}).Select("storage_key").Where("upload_id IN (?)", uploadIds)
+	if err := tx.Exec("INSERT INTO blob_deletions (storage_key) ?", storageKeys).Error; err != nil {
+		return err
+	}
+	return tx.Where("upload_id IN (?)", uploadIds).Delete(&models.FileUploadPart{}).Error
+}
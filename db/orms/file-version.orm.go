@@ -0,0 +1,202 @@
+package orms
+
+import (
+	"context"
+	"time"
+
+	"github.com/subashshakya/SFSS/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// VersionRetention decides which old versions of a file are kept. A version
+// is kept while it is one of the Keep newest or younger than MaxAge. With
+// both zero every version is kept. The current version is always kept.
+type VersionRetention struct {
+	Keep   int
+	MaxAge time.Duration
+}
+
+func (r VersionRetention) keepsEverything() bool {
+	return r.Keep <= 0 && r.MaxAge <= 0
+}
+
+// expired reports whether the version at position, counted from the newest
+// starting at 1, can be removed.
+func (r VersionRetention) expired(position int, createdAt, now time.Time) bool {
+	if r.keepsEverything() {
+		return false
+	}
+	if r.Keep > 0 && position <= r.Keep {
+		return false
+	}
+	return r.MaxAge <= 0 || !createdAt.After(now.Add(-r.MaxAge))
+}
+
+// GetFileVersions returns the versions of a file, newest first.
+func GetFileVersions(ctx context.Context, secureFile *models.SecureFile) ([]models.FileVersion, error) {
+	var versions []models.FileVersion
+	result := DatabaseConnection.WithContext(ctx).Where("original_id = ?", secureFile.OriginalId).Order("version DESC").Find(&versions)
+	return versions, result.Error
+}
+
+func GetFileVersion(ctx context.Context, secureFile *models.SecureFile, version int) (*models.FileVersion, error) {
+	var fileVersion models.FileVersion
+	result := DatabaseConnection.WithContext(ctx).Where("original_id = ? AND version = ?", secureFile.OriginalId, version).Limit(1).Find(&fileVersion)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &fileVersion, nil
+}
+
+// RestoreFileVersion makes a copy of an old version the newest version of
+// the file. The copy shares the old version's content, so nothing is stored
+// again. It returns ErrNotFound when ownerId cannot change the file or the
+// version does not exist.
+func RestoreFileVersion(ctx context.Context, fileId string, version int, ownerId uint, retention VersionRetention) (models.SecureFile, error) {
+	var secureFile models.SecureFile
+	err := DatabaseConnection.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", fileId).
+			Where(writableBy(ownerId)).
+			Limit(1).Find(&secureFile)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		var restored models.FileVersion
+		result = tx.Where("original_id = ? AND version = ?", secureFile.OriginalId, version).Limit(1).Find(&restored)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		secureFile.StorageKey = restored.StorageKey
+		secureFile.ContentType = restored.ContentType
+		secureFile.SizeBytes = restored.SizeBytes
+		secureFile.Sha256 = restored.Sha256
+		secureFile.Encryption = restored.Encryption
+		updates := contentUpdates(&secureFile)
+		updates["content_type"] = secureFile.ContentType
+		if err := tx.Model(&secureFile).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := addFileVersion(tx, &secureFile, &restored.Version); err != nil {
+			return err
+		}
+		return pruneFileVersions(tx, &secureFile, retention, time.Now())
+	})
+	return secureFile, err
+}
+
+// PruneExpiredFileVersions applies the retention to up to limit files that
+// have versions past it and returns how many files it went through.
+func PruneExpiredFileVersions(ctx context.Context, retention VersionRetention, limit int) (int, error) {
+	if retention.keepsEverything() {
+		return 0, nil
+	}
+	now := time.Now()
+	positioned := DatabaseConnection.Model(&models.FileVersion{}).
+		Select("secure_files.id AS file_id, file_versions.version, file_versions.created_at, secure_files.version AS current_version, " +
+			"ROW_NUMBER() OVER (PARTITION BY file_versions.original_id ORDER BY file_versions.version DESC) AS position").
+		Joins("JOIN secure_files ON secure_files.original_id = file_versions.original_id")
+	query := DatabaseConnection.WithContext(ctx).Table("(?) AS positioned", positioned).
+		Distinct("file_id").
+		Where("version <> current_version")
+	if retention.Keep > 0 {
+		query = query.Where("position > ?", retention.Keep)
+	}
+	if retention.MaxAge > 0 {
+		query = query.Where("created_at <= ?", now.Add(-retention.MaxAge))
+	}
+	var fileIds []string
+	if err := query.Limit(limit).Pluck("file_id", &fileIds).Error; err != nil {
+		return 0, err
+	}
+	for _, fileId := range fileIds {
+		err := DatabaseConnection.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var secureFile models.SecureFile
+			result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", fileId).Limit(1).Find(&secureFile)
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+			return pruneFileVersions(tx, &secureFile, retention, now)
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(fileIds), nil
+}
+
+// addFileVersion records the content secureFile now points at as its next
+// version. The file row has to be locked by the caller.
+func addFileVersion(tx *gorm.DB, secureFile *models.SecureFile, restoredFrom *int) error {
+	var latest int
+	if err := tx.Model(&models.FileVersion{}).Select("COALESCE(MAX(version), 0)").Where("original_id = ?", secureFile.OriginalId).Scan(&latest).Error; err != nil {
+		return err
+	}
+	fileVersion := models.FileVersion{
+		OriginalId:   secureFile.OriginalId,
+		Version:      latest + 1,
+		StorageKey:   secureFile.StorageKey,
+		ContentType:  secureFile.ContentType,
+		SizeBytes:    secureFile.SizeBytes,
+		Sha256:       secureFile.Sha256,
+		Encryption:   secureFile.Encryption,
+		RestoredFrom: restoredFrom,
+	}
+	if err := tx.Create(&fileVersion).Error; err != nil {
+		return err
+	}
+	secureFile.Version = fileVersion.Version
+	return tx.Model(&models.SecureFile{}).Where("id = ?", secureFile.Id).Update("version", fileVersion.Version).Error
+}
+
+// pruneFileVersions removes the versions of secureFile the retention no
+// longer keeps. Their content is queued for deletion unless a remaining
+// version was restored from it and still uses it.
+func pruneFileVersions(tx *gorm.DB, secureFile *models.SecureFile, retention VersionRetention, now time.Time) error {
+	if retention.keepsEverything() {
+		return nil
+	}
+	var versions []models.FileVersion
+	if err := tx.Where("original_id = ?", secureFile.OriginalId).Order("version DESC").Find(&versions).Error; err != nil {
+		return err
+	}
+	inUse := map[string]bool{secureFile.StorageKey: true}
+	var expired []models.FileVersion
+	for i, version := range versions {
+		if version.Version == secureFile.Version || !retention.expired(i+1, version.CreatedAt, now) {
+			inUse[version.StorageKey] = true
+			continue
+		}
+		expired = append(expired, version)
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+	var ids []uint
+	var deletions []models.BlobDeletion
+	queued := map[string]bool{}
+	for _, version := range expired {
+		ids = append(ids, version.Id)
+		if !inUse[version.StorageKey] && !queued[version.StorageKey] && version.StorageKey != "" {
+			queued[version.StorageKey] = true
+			deletions = append(deletions, models.BlobDeletion{StorageKey: version.StorageKey})
+		}
+	}
+	if err := tx.Delete(&models.FileVersion{}, ids).Error; err != nil {
+		return err
+	}
+	if len(deletions) == 0 {
+		return nil
+	}
+	return tx.Create(&deletions).Error
+}
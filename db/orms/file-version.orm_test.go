@@ -0,0 +1,70 @@
+package orms
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/subashshakya/SFSS/models"
+)
+
+func TestVersionRetentionExpired(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	tests := []struct {
+		name      string
+		retention VersionRetention
+		position  int
+		age       time.Duration
+		expired   bool
+	}{
+		{"keeps everything by default", VersionRetention{}, 50, 1000 * day, false},
+		{"keeps the newest N", VersionRetention{Keep: 3}, 3, 1000 * day, false},
+		{"drops past N", VersionRetention{Keep: 3}, 4, time.Minute, true},
+		{"keeps younger than max age", VersionRetention{MaxAge: 30 * day}, 100, 29 * day, false},
+		{"drops at max age", VersionRetention{MaxAge: 30 * day}, 2, 30 * day, true},
+		{"either rule keeps, newest N", VersionRetention{Keep: 2, MaxAge: 30 * day}, 2, 90 * day, false},
+		{"either rule keeps, young", VersionRetention{Keep: 2, MaxAge: 30 * day}, 10, day, false},
+		{"both rules drop", VersionRetention{Keep: 2, MaxAge: 30 * day}, 3, 31 * day, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.retention.expired(test.position, now.Add(-test.age), now); got != test.expired {
+				t.Errorf("expired(%d, %s old) = %v, want %v", test.position, test.age, got, test.expired)
+			}
+		})
+	}
+}
+
+func TestDeleteSecureFileQueuesEveryVersion(t *testing.T) {
+	db := useTestDatabase(t, &models.SecureFile{}, &models.FileVersion{}, &models.BlobDeletion{}, &models.TeamMember{})
+	ctx := context.Background()
+	user := models.User{FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com", Password: "x", PhoneNumber: "0"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	file := models.SecureFile{Id: "file-1", FileName: "notes.txt", StorageKey: "key-3", UserId: int(user.Id)}
+	if _, err := CreateSecureFile(ctx, &file); err != nil {
+		t.Fatal(err)
+	}
+	for version, storageKey := range []string{"key-1", "key-2", "key-3"} {
+		fileVersion := models.FileVersion{OriginalId: file.OriginalId, Version: version + 1, StorageKey: storageKey}
+		if err := db.Create(&fileVersion).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if deleted, err := DeleteSecureFile(ctx, file.Id, user.Id); err != nil || !deleted {
+		t.Fatalf("DeleteSecureFile = %v, %v", deleted, err)
+	}
+	var storageKeys []string
+	db.Model(&models.BlobDeletion{}).Order("storage_key").Pluck("storage_key", &storageKeys)
+	if len(storageKeys) != 3 || storageKeys[0] != "key-1" || storageKeys[2] != "key-3" {
+		t.Errorf("queued %v, want every version once", storageKeys)
+	}
+	var remaining int64
+	db.Model(&models.FileVersion{}).Where("original_id = ?", file.OriginalId).Count(&remaining)
+	if remaining != 0 {
+		t.Errorf("%d versions left behind", remaining)
+	}
+}
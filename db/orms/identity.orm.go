@@ -0,0 +1,70 @@
+package orms
+
+import (
+	"context"
+	"errors"
+
+	"github.com/subashshakya/SFSS/models"
+	"gorm.io/gorm"
+)
+
+var ErrIdentityLinkRequired = errors.New("an account with the identity's email exists and has to link it explicitly")
+var ErrIdentityLinkedElsewhere = errors.New("identity is linked to another account")
+
+// ResolveExternalIdentity returns the user linked to issuer/subject. An
+// unlinked identity is attached to the account with the same email only when
+// both the provider and the account verified that email. Anyone could have
+// registered an unverified account with the address, so otherwise the owner
+// has to sign in and link the identity. Without such an account newUser is
+// created and linked.
+func ResolveExternalIdentity(ctx context.Context, identity *models.UserIdentity, emailVerified bool, newUser *models.User) (models.User, error) {
+	var user models.User
+	err := DatabaseConnection.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var linked models.UserIdentity
+		result := tx.Where("issuer = ? AND subject = ?", identity.Issuer, identity.Subject).Limit(1).Find(&linked)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 1 {
+			return tx.First(&user, linked.UserId).Error
+		}
+		result = tx.Where("email = ?", identity.Email).Limit(1).Find(&user)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 1 {
+			if !emailVerified || !user.EmailVerifiedAt.Valid {
+				return ErrIdentityLinkRequired
+			}
+		} else {
+			if err := tx.Create(newUser).Error; err != nil {
+				return err
+			}
+			user = *newUser
+		}
+		identity.UserId = user.Id
+		return tx.Create(identity).Error
+	})
+	return user, err
+}
+
+// LinkExternalIdentity attaches issuer/subject to the signed-in user. Linking
+// an identity the user already has is not an error.
+func LinkExternalIdentity(ctx context.Context, identity *models.UserIdentity, userId uint) error {
+	return DatabaseConnection.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var linked models.UserIdentity
+		result := tx.Where("issuer = ? AND subject = ?", identity.Issuer, identity.Subject).Limit(1).Find(&linked)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 1 {
+			if linked.UserId != userId {
+				return ErrIdentityLinkedElsewhere
+			}
+			*identity = linked
+			return nil
+		}
+		identity.UserId = userId
+		return tx.Create(identity).Error
+	})
+}
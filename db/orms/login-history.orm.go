@@ -0,0 +1,61 @@
+package orms
+
+import (
+	"context"
+	"time"
+
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/models"
+	"gorm.io/gorm/clause"
+)
+
+func RecordLoginAttempt(ctx context.Context, attempt *models.LoginAttempt) error {
+	return DatabaseConnection.WithContext(ctx).Create(attempt).Error
+}
+
+func GetLoginHistory(ctx context.Context, userId uint, limit int, offset int) ([]models.LoginAttempt, int64, error) {
+	attempts := []models.LoginAttempt{}
+	var total int64
+	db := DatabaseConnection.WithContext(ctx).Model(&models.LoginAttempt{}).Where("user_id = ?", userId)
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := db.Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&attempts).Error; err != nil {
+		return nil, 0, err
+	}
+	return attempts, total, nil
+}
+
+// DeleteOldLoginAttempts removes up to limit sign-in attempts made before
+// before and returns how many it removed.
+func DeleteOldLoginAttempts(ctx context.Context, before time.Time, limit int) (int64, error) {
+	old := DatabaseConnection.Model(&models.LoginAttempt{}).Select("id").Where("created_at < ?", before).Order("id").Limit(limit)
+	result := DatabaseConnection.WithContext(ctx).Where("id IN (?)", old).Delete(&models.LoginAttempt{})
+	return result.RowsAffected, result.Error
+}
+
+// IsKnownSignInLocation reports whether the user has signed in successfully
+// before with this exact IP address and user agent.
+func IsKnownSignInLocation(ctx context.Context, userId uint, ipAddress string, userAgent string) (bool, error) {
+	var count int64
+	result := DatabaseConnection.WithContext(ctx).Model(&models.LoginAttempt{}).
+		Where("user_id = ? AND outcome = ? AND ip_address = ? AND user_agent = ?", userId, constants.SignInSucceeded, ipAddress, userAgent).
+		Limit(1).
+		Count(&count)
+	return count > 0, result.Error
+}
+
+// UseStepUpCode spends the step-up code and returns false when it was
+// already used.
+func UseStepUpCode(ctx context.Context, codeHash string, expiresAt time.Time) (bool, error) {
+	used := models.UsedStepUpCode{CodeHash: codeHash, ExpiresAt: expiresAt}
+	result := DatabaseConnection.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&used)
+	return result.RowsAffected == 1, result.Error
+}
+
+// DeleteExpiredStepUpCodes forgets spent step-up codes that expired before
+// now, since they can no longer be confirmed anyway.
+func DeleteExpiredStepUpCodes(ctx context.Context, now time.Time) (int64, error) {
+	result := DatabaseConnection.WithContext(ctx).Where("expires_at < ?", now).Delete(&models.UsedStepUpCode{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,34 @@
+package orms
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/models"
+)
+
+func TestDeleteOldLoginAttempts(t *testing.T) {
+	db := useTestDatabase(t, &models.LoginAttempt{})
+	ctx := context.Background()
+	now := time.Now()
+	for _, age := range []time.Duration{time.Hour, 48 * time.Hour, 72 * time.Hour, 96 * time.Hour} {
+		attempt := models.LoginAttempt{Email: "ada@example.com", Method: "password", Outcome: constants.SignInSucceeded, CreatedAt: now.Add(-age)}
+		if err := RecordLoginAttempt(ctx, &attempt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deleted, err := DeleteOldLoginAttempts(ctx, now.Add(-24*time.Hour), 2)
+	if err != nil || deleted != 2 {
+		t.Fatalf("first batch deleted %d, err %v", deleted, err)
+	}
+	if deleted, err = DeleteOldLoginAttempts(ctx, now.Add(-24*time.Hour), 2); err != nil || deleted != 1 {
+		t.Fatalf("second batch deleted %d, err %v", deleted, err)
+	}
+	var left int64
+	db.Model(&models.LoginAttempt{}).Count(&left)
+	if left != 1 {
+		t.Errorf("%d attempts left, want the recent one", left)
+	}
+}
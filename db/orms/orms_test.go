@@ -0,0 +1,20 @@
+package orms
+
+import (
+	"testing"
+
+	"github.com/subashshakya/SFSS/db/dbtest"
+	"github.com/subashshakya/SFSS/models"
+	"gorm.io/gorm"
+)
+
+// useTestDatabase points the package at a fresh schema for the duration of
+// the test, or skips the test when there is no test database.
+func useTestDatabase(t *testing.T, tables ...interface{}) *gorm.DB {
+	t.Helper()
+	db := dbtest.Open(t, append([]interface{}{&models.User{}}, tables...)...)
+	previous := DatabaseConnection
+	DatabaseConnection = db
+	t.Cleanup(func() { DatabaseConnection = previous })
+	return db
+}
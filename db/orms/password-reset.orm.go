@@ -0,0 +1,73 @@
+package orms
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/subashshakya/SFSS/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrResetTokenInvalid = errors.New("password reset token is invalid or expired")
+
+// CreatePasswordResetToken stores a new reset token and invalidates any
+// earlier token of the same user that has not been used yet.
+func CreatePasswordResetToken(ctx context.Context, resetToken *models.PasswordResetToken) error {
+	return DatabaseConnection.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", resetToken.UserId).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(resetToken).Error
+	})
+}
+
+// GetPasswordResetUser returns the user an unused, unexpired token belongs
+// to, or nil. The token is only checked here; ResetPassword consumes it.
+func GetPasswordResetUser(ctx context.Context, tokenHash string) (*models.User, error) {
+	var user models.User
+	validToken := DatabaseConnection.Model(&models.PasswordResetToken{}).Select("user_id").
+		Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, time.Now())
+	result := DatabaseConnection.WithContext(ctx).Where("id IN (?)", validToken).Limit(1).Find(&user)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &user, nil
+}
+
+// ResetPassword consumes the token, stores the new password hash and revokes
+// every session of the user in one transaction.
+func ResetPassword(ctx context.Context, tokenHash string, passwordHash string) (uint, error) {
+	var resetToken models.PasswordResetToken
+	err := DatabaseConnection.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, time.Now()).
+			Limit(1).Find(&resetToken)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrResetTokenInvalid
+		}
+		now := time.Now()
+		if err := tx.Model(&resetToken).Update("used_at", now).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.User{}).Where("id = ?", resetToken.UserId).
+			Updates(map[string]interface{}{"password": passwordHash, "tokens_revoked_at": now, "password_reset_required": false}).Error; err != nil {
+			return err
+		}
+		_, err := revokeSessionsOfAUser(tx, resetToken.UserId, "", now)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return resetToken.UserId, nil
+}
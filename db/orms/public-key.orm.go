@@ -0,0 +1,95 @@
+package orms
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/subashshakya/SFSS/models"
+	"gorm.io/gorm"
+)
+
+const maxActivePublicKeys = 20
+
+var ErrPublicKeyExists = errors.New("public key is already registered")
+var ErrTooManyPublicKeys = errors.New("too many active public keys")
+
+func CreateUserPublicKey(ctx context.Context, key *models.UserPublicKey) error {
+	if key.UserId == 0 {
+		return errors.New("UserID cannot be zero")
+	}
+	return DatabaseConnection.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if _, err := lockUser(tx, key.UserId); err != nil {
+			return err
+		}
+		var taken int64
+		if err := tx.Model(&models.UserPublicKey{}).Where("fingerprint = ?", key.Fingerprint).Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken > 0 {
+			return ErrPublicKeyExists
+		}
+		var active int64
+		if err := tx.Model(&models.UserPublicKey{}).Where("user_id = ? AND retired_at IS NULL", key.UserId).Count(&active).Error; err != nil {
+			return err
+		}
+		if active >= maxActivePublicKeys {
+			return ErrTooManyPublicKeys
+		}
+		err := tx.Omit("User").Create(key).Error
+		if isUniqueViolation(err) {
+			// registered concurrently after the check above
+			return ErrPublicKeyExists
+		}
+		return err
+	})
+}
+
+// GetActiveUserPublicKey returns one of the user's unretired keys, or nil.
+func GetActiveUserPublicKey(ctx context.Context, userId uint, keyId uint) (*models.UserPublicKey, error) {
+	var key models.UserPublicKey
+	result := DatabaseConnection.WithContext(ctx).
+		Where("id = ? AND user_id = ? AND retired_at IS NULL", keyId, userId).
+		Limit(1).
+		Find(&key)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &key, nil
+}
+
+func GetPublicKeysOfAUser(ctx context.Context, userId uint, includeRetired bool) ([]models.UserPublicKey, error) {
+	keys := []models.UserPublicKey{}
+	query := DatabaseConnection.WithContext(ctx).Where("user_id = ?", userId)
+	if !includeRetired {
+		query = query.Where("retired_at IS NULL")
+	}
+	result := query.Order("created_at DESC").Find(&keys)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return keys, nil
+}
+
+// RetireUserPublicKey retires the key and every key it certified, since
+// those can no longer be verified against a current signing key.
+func RetireUserPublicKey(ctx context.Context, userId uint, keyId uint) (bool, error) {
+	retired := false
+	err := DatabaseConnection.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&models.UserPublicKey{}).
+			Where("id = ? AND user_id = ? AND retired_at IS NULL", keyId, userId).
+			Update("retired_at", now)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		retired = true
+		return tx.Model(&models.UserPublicKey{}).
+			Where("signed_by_id = ? AND user_id = ? AND retired_at IS NULL", keyId, userId).
+			Update("retired_at", now).Error
+	})
+	return retired, err
+}
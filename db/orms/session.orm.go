@@ -0,0 +1,99 @@
+package orms
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/subashshakya/SFSS/models"
+	"gorm.io/gorm"
+)
+
+const sessionTouchInterval = time.Minute
+
+func CreateSession(ctx context.Context, session *models.Session) error {
+	if session.UserId == 0 {
+		return errors.New("UserID cannot be zero")
+	}
+	session.LastSeenAt = time.Now()
+	return DatabaseConnection.WithContext(ctx).Create(session).Error
+}
+
+func GetActiveSession(ctx context.Context, sessionId string) (*models.Session, error) {
+	var session models.Session
+	result := DatabaseConnection.WithContext(ctx).Where("id = ? AND revoked_at IS NULL", sessionId).Limit(1).Find(&session)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &session, nil
+}
+
+// TouchSession records activity at most once per sessionTouchInterval so that
+// authenticated requests do not write on every call.
+func TouchSession(ctx context.Context, sessionId string, ipAddress string) error {
+	return DatabaseConnection.WithContext(ctx).Model(&models.Session{}).
+		Where("id = ? AND last_seen_at < ?", sessionId, time.Now().Add(-sessionTouchInterval)).
+		Updates(map[string]interface{}{"last_seen_at": time.Now(), "ip_address": ipAddress}).Error
+}
+
+func GetActiveSessionsOfAUser(ctx context.Context, userId uint) ([]models.Session, error) {
+	var sessions []models.Session
+	result := DatabaseConnection.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL", userId).
+		Order("last_seen_at DESC").
+		Find(&sessions)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return sessions, nil
+}
+
+func RevokeSession(ctx context.Context, userId uint, sessionId string) (bool, error) {
+	revoked := false
+	err := DatabaseConnection.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Session{}).
+			Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionId, userId).
+			Update("revoked_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		revoked = true
+		return revokeRefreshTokenFamily(tx, sessionId, time.Now())
+	})
+	return revoked, err
+}
+
+// RevokeSessionsOfAUser ends every session of the user except keepSessionId,
+// which may be empty to end all of them.
+func RevokeSessionsOfAUser(ctx context.Context, userId uint, keepSessionId string) (int64, error) {
+	var revokedCount int64
+	err := DatabaseConnection.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		revokedCount, err = revokeSessionsOfAUser(tx, userId, keepSessionId, time.Now())
+		return err
+	})
+	return revokedCount, err
+}
+
+func revokeSessionsOfAUser(tx *gorm.DB, userId uint, keepSessionId string, revokedAt time.Time) (int64, error) {
+	sessions := tx.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", userId)
+	refreshTokens := tx.Model(&models.RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userId)
+	if keepSessionId != "" {
+		sessions = sessions.Where("id <> ?", keepSessionId)
+		refreshTokens = refreshTokens.Where("family_id <> ?", keepSessionId)
+	}
+	result := sessions.Update("revoked_at", revokedAt)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if err := refreshTokens.Update("revoked_at", revokedAt).Error; err != nil {
+		return 0, err
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,100 @@
+package orms
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/subashshakya/SFSS/models"
+	"gorm.io/gorm"
+)
+
+// startSessions signs the user in on count devices, each with a refresh token.
+func startSessions(t *testing.T, userId uint, count int) []models.Session {
+	t.Helper()
+	var sessions []models.Session
+	for i := 0; i < count; i++ {
+		session := models.Session{UserId: userId, DeviceName: "device"}
+		if err := CreateSession(context.Background(), &session); err != nil {
+			t.Fatal(err)
+		}
+		token := models.RefreshToken{UserId: userId, FamilyId: session.Id, TokenHash: session.Id, ExpiresAt: time.Now().Add(time.Hour)}
+		if err := CreateRefreshToken(context.Background(), &token); err != nil {
+			t.Fatal(err)
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
+
+func activeRefreshTokens(t *testing.T, db *gorm.DB, familyId string) int64 {
+	t.Helper()
+	var count int64
+	if err := db.Model(&models.RefreshToken{}).Where("family_id = ? AND revoked_at IS NULL", familyId).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestRevokeSession(t *testing.T) {
+	db := useTestDatabase(t, &models.Session{}, &models.RefreshToken{})
+	ctx := context.Background()
+	users := []models.User{
+		{FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com", Password: "x", PhoneNumber: "0"},
+		{FirstName: "Eve", LastName: "Other", Email: "eve@example.com", Password: "x", PhoneNumber: "0"},
+	}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	sessions := startSessions(t, users[0].Id, 2)
+
+	if revoked, err := RevokeSession(ctx, users[1].Id, sessions[0].Id); err != nil || revoked {
+		t.Fatalf("another user revoked the session: %v, %v", revoked, err)
+	}
+	if revoked, err := RevokeSession(ctx, users[0].Id, sessions[0].Id); err != nil || !revoked {
+		t.Fatalf("RevokeSession = %v, %v", revoked, err)
+	}
+	if revoked, _ := RevokeSession(ctx, users[0].Id, sessions[0].Id); revoked {
+		t.Error("a revoked session was revoked again")
+	}
+	if activeRefreshTokens(t, db, sessions[0].Id) != 0 {
+		t.Error("the revoked session can still refresh")
+	}
+	active, err := GetActiveSessionsOfAUser(ctx, users[0].Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(active) != 1 || active[0].Id != sessions[1].Id {
+		t.Fatalf("active sessions = %+v", active)
+	}
+	if session, _ := GetActiveSession(ctx, sessions[0].Id); session != nil {
+		t.Error("GetActiveSession returned a revoked session")
+	}
+}
+
+func TestRevokeSessionsOfAUserKeepsTheCurrentOne(t *testing.T) {
+	db := useTestDatabase(t, &models.Session{}, &models.RefreshToken{})
+	ctx := context.Background()
+	user := models.User{FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com", Password: "x", PhoneNumber: "0"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	sessions := startSessions(t, user.Id, 3)
+
+	revokedCount, err := RevokeSessionsOfAUser(ctx, user.Id, sessions[0].Id)
+	if err != nil || revokedCount != 2 {
+		t.Fatalf("RevokeSessionsOfAUser = %d, %v", revokedCount, err)
+	}
+	if activeRefreshTokens(t, db, sessions[0].Id) != 1 {
+		t.Error("the current session lost its refresh token")
+	}
+	for _, session := range sessions[1:] {
+		if activeRefreshTokens(t, db, session.Id) != 0 {
+			t.Errorf("session %s can still refresh", session.Id)
+		}
+	}
+	active, _ := GetActiveSessionsOfAUser(ctx, user.Id)
+	if len(active) != 1 || active[0].Id != sessions[0].Id {
+		t.Fatalf("active sessions = %+v", active)
+	}
+}
@@ -2,18 +2,40 @@ package orms
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"log"
+	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/subashshakya/SFSS/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var DatabaseConnection *gorm.DB
 
+var ErrNotFound = errors.New("record not found")
+
+var ErrForbidden = errors.New("caller does not own the resource")
+
+// uniqueViolation is the SQLSTATE of a unique constraint violation.
+const uniqueViolation = "23505"
+
+// isUniqueViolation reports whether err is Postgres rejecting a row that
+// duplicates a unique column.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
+
+// GetUser returns ErrNotFound when there is no user with the id.
 func GetUser(ctx context.Context, id uint) (models.User, error) {
 	var user models.User
 	result := DatabaseConnection.WithContext(ctx).First(&user, id)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return user, ErrNotFound
+	}
 	return user, result.Error
 }
 
@@ -26,59 +48,155 @@ func CreateUser(ctx context.Context, userData *models.User) (models.User, error)
 	return *userData, result.Error
 }
 
-func CheckUserInDB(ctx context.Context, user *models.User) (bool, error) {
-	result := DatabaseConnection.WithContext(ctx).Find(&user)
-	exists := result.RowsAffected == 0
-	return exists, result.Error
+func GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	result := DatabaseConnection.WithContext(ctx).Where("email = ?", email).Limit(1).Find(&user)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &user, nil
+}
+
+func UpdateUserPassword(ctx context.Context, userId uint, passwordHash string) error {
+	return updateUserPassword(DatabaseConnection.WithContext(ctx), userId, passwordHash)
+}
+
+// ChangeUserPassword stores the new password hash and ends every other
+// session of the user in one transaction.
+func ChangeUserPassword(ctx context.Context, userId uint, passwordHash string, keepSessionId string) error {
+	return DatabaseConnection.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := updateUserPassword(tx, userId, passwordHash); err != nil {
+			return err
+		}
+		_, err := revokeSessionsOfAUser(tx, userId, keepSessionId, time.Now())
+		return err
+	})
 }
 
-func DeleteUser(ctx context.Context, userData *models.User) (bool, error) {
-	result := DatabaseConnection.WithContext(ctx).Delete(&userData)
+func updateUserPassword(tx *gorm.DB, userId uint, passwordHash string) error {
+	if passwordHash == "" {
+		return errors.New("password hash cannot be empty")
+	}
+	result := tx.Model(&models.User{}).Where("id = ?", userId).Update("password", passwordHash)
 	if result.Error != nil {
-		return false, result.Error
+		return result.Error
 	}
-	if result.Error == nil && result.RowsAffected != 0 {
-		return true, nil
+	if result.RowsAffected == 0 {
+		return errors.New("could not update the password")
 	}
-	return true, nil
+	return nil
 }
 
-func UpdateUser(ctx context.Context, userData *models.User) (bool, error) {
-	result := DatabaseConnection.WithContext(ctx).Save(&userData)
+func MarkEmailVerified(ctx context.Context, userId uint, email string) (bool, error) {
+	result := DatabaseConnection.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND email = ? AND email_verified_at IS NULL", userId, email).
+		Update("email_verified_at", time.Now())
 	if result.Error != nil {
 		return false, result.Error
 	}
-	if result.Error == nil && result.RowsAffected != 0 {
-		return true, nil
+	return result.RowsAffected == 1, nil
+}
+
+func CheckUserInDB(ctx context.Context, user *models.User) (bool, error) {
+	result := DatabaseConnection.WithContext(ctx).Find(&user)
+	exists := result.RowsAffected != 0
+	return exists, result.Error
+}
+
+// UpdateUser changes only the profile fields set in the request. Password and
+// account state columns are never written from here. A new email clears the
+// verification in the same statement, so the new address is never taken as
+// verified.
+func UpdateUser(ctx context.Context, userId uint, profile *models.UpdateUserRequest) (bool, error) {
+	updates := map[string]interface{}{}
+	if profile.FirstName != "" {
+		updates["first_name"] = profile.FirstName
 	}
-	return true, nil
+	if profile.MiddleName != nil {
+		updates["middle_name"] = sql.NullString{String: *profile.MiddleName, Valid: *profile.MiddleName != ""}
+	}
+	if profile.LastName != "" {
+		updates["last_name"] = profile.LastName
+	}
+	if profile.Email != "" {
+		updates["email"] = profile.Email
+		updates["email_verified_at"] = gorm.Expr("CASE WHEN email = ? THEN email_verified_at END", profile.Email)
+	}
+	if profile.PhoneNumber != "" {
+		updates["phone_number"] = profile.PhoneNumber
+	}
+	if len(updates) == 0 {
+		return false, nil
+	}
+	result := DatabaseConnection.WithContext(ctx).Model(&models.User{}).Where("id = ?", userId).Updates(updates)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected != 0, nil
 }
 
-func GetSecureFilesOfAUser(ctx context.Context, userId int) ([]models.SecureFile, error) {
+func GetSecureFilesOfAUser(ctx context.Context, userId uint) ([]models.SecureFile, error) {
 	var secureFiles []models.SecureFile
-	result := DatabaseConnection.WithContext(ctx).Where("UserId = ?", userId).Find(&secureFiles)
+	result := DatabaseConnection.WithContext(ctx).Where("user_id = ? AND team_id IS NULL", userId).Find(&secureFiles)
 	if result.Error != nil {
 		return nil, result.Error
 	}
 	return secureFiles, nil
 }
 
-func UpdateFile(ctx context.Context, secureFile *models.SecureFile) (models.SecureFile, error) {
+// UpdateFile renames the file and, when secureFile has a StorageKey, points
+// it at new content as its next version. The versions past the retention are
+// removed.
+func UpdateFile(ctx context.Context, secureFile *models.SecureFile, ownerId uint, retention VersionRetention) (models.SecureFile, error) {
 	var updatedSecureFile models.SecureFile
-	result := DatabaseConnection.WithContext(ctx).Save(&secureFile)
-	updatedSecureFile = *secureFile
-	if result.Error != nil {
-		return updatedSecureFile, result.Error
-	}
-	return updatedSecureFile, nil
+	err := DatabaseConnection.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", secureFile.Id).
+			Where(writableBy(ownerId)).
+			Limit(1).Find(&updatedSecureFile)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		if secureFile.StorageKey == "" {
+			return tx.Model(&updatedSecureFile).Update("file_name", secureFile.FileName).Error
+		}
+		updatedSecureFile.FileName = secureFile.FileName
+		updatedSecureFile.StorageKey = secureFile.StorageKey
+		updatedSecureFile.SizeBytes = secureFile.SizeBytes
+		updatedSecureFile.Sha256 = secureFile.Sha256
+		updatedSecureFile.Encryption = secureFile.Encryption
+		updates := contentUpdates(&updatedSecureFile)
+		updates["file_name"] = updatedSecureFile.FileName
+		if err := tx.Model(&updatedSecureFile).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := addFileVersion(tx, &updatedSecureFile, nil); err != nil {
+			return err
+		}
+		return pruneFileVersions(tx, &updatedSecureFile, retention, time.Now())
+	})
+	return updatedSecureFile, err
 }
 
+// CreateSecureFile inserts the file as its first version. It fails rather
+// than overwrite when a file with the id exists.
 func CreateSecureFile(ctx context.Context, secureFile *models.SecureFile) (bool, error) {
-	result := DatabaseConnection.WithContext(ctx).Save(&secureFile)
-	if result.Error != nil || result.RowsAffected == 0 {
-		return false, result.Error
-	}
-	return true, nil
+	var created bool
+	err := DatabaseConnection.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Omit(clause.Associations).Create(secureFile)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		created = true
+		return addFileVersion(tx, secureFile, nil)
+	})
+	return created && err == nil, err
 }
 
 func CheckIfSecureFileExists(ctx context.Context, secFile *models.SecureFile) (bool, error) {
@@ -91,27 +209,53 @@ func CheckIfSecureFileExists(ctx context.Context, secFile *models.SecureFile) (b
 
 func GetSecureFileById(ctx context.Context, id string) (secureFile *models.SecureFile, err error) {
 	var secFile models.SecureFile
-	result := DatabaseConnection.WithContext(ctx).Where("Id = ?", id).Find(&secFile)
+	result := DatabaseConnection.WithContext(ctx).Where("id = ?", id).Limit(1).Find(&secFile)
 	if result.Error != nil {
 		return nil, result.Error
 	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
 	return &secFile, nil
 }
 
-func DeleteSecureFile(ctx context.Context, id string) (bool, error) {
-	var secureFile models.SecureFile
-	result := DatabaseConnection.WithContext(ctx).Where("Id = ?", id).Delete(&secureFile)
+// GetAccessibleSecureFile returns the file only if userId owns it, belongs to
+// the team that owns it or it has been shared with userId.
+func GetAccessibleSecureFile(ctx context.Context, id string, userId uint) (*models.SecureFile, error) {
+	var secFile models.SecureFile
+	sharedWithUser := DatabaseConnection.Model(&models.FileSharing{}).Select("1").
+		Where("file_sharings.file_id = secure_files.id AND file_sharings.recipient_id = ?", userId)
+	result := DatabaseConnection.WithContext(ctx).
+		Where("id = ?", id).
+		Where(readableBy(userId).Or("EXISTS (?)", sharedWithUser)).
+		Limit(1).Find(&secFile)
 	if result.Error != nil {
-		return false, result.Error
+		return nil, result.Error
 	}
 	if result.RowsAffected == 0 {
-		return false, nil
+		return nil, nil
 	}
-	return true, nil
+	return &secFile, nil
 }
 
+func DeleteSecureFile(ctx context.Context, id string, ownerId uint) (bool, error) {
+	var deleted bool
+	err := DatabaseConnection.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		file := tx.Model(&models.SecureFile{}).Select("id").Where("id = ?", id).Where(writableBy(ownerId))
+		if err := queueBlobDeletions(tx, file); err != nil {
+			return err
+		}
+		result := tx.Where("id = ?", id).Where(writableBy(ownerId)).Delete(&models.SecureFile{})
+		deleted = result.RowsAffected != 0
+		return result.Error
+	})
+	return deleted, err
+}
+
+// CreateSuperSecret inserts the secret. It fails rather than overwrite when a
+// secret with the id exists.
 func CreateSuperSecret(ctx context.Context, supaSecret *models.SuperSecret) (bool, error) {
-	result := DatabaseConnection.WithContext(ctx).Save(&supaSecret)
+	result := DatabaseConnection.WithContext(ctx).Omit(clause.Associations).Create(supaSecret)
 	if result.Error != nil {
 		return false, result.Error
 	}
@@ -123,7 +267,7 @@ func CreateSuperSecret(ctx context.Context, supaSecret *models.SuperSecret) (boo
 
 func GetSecretsOfAUser(ctx context.Context, userId uint) ([]models.SuperSecret, error) {
 	var supaSecretsList []models.SuperSecret
-	result := DatabaseConnection.WithContext(ctx).Where("UserId = ?", userId).Find(&supaSecretsList)
+	result := DatabaseConnection.WithContext(ctx).Where("user_id = ? AND team_id IS NULL", userId).Find(&supaSecretsList)
 	if result.Error != nil {
 		return nil, result.Error
 	}
@@ -132,21 +276,46 @@ func GetSecretsOfAUser(ctx context.Context, userId uint) ([]models.SuperSecret,
 
 func GetSecrect(ctx context.Context, secretId string) (*models.SuperSecret, error) {
 	var supaSecret models.SuperSecret
-	result := DatabaseConnection.WithContext(ctx).Where("Id = ?", secretId).Find(&supaSecret)
+	result := DatabaseConnection.WithContext(ctx).Where("id = ?", secretId).Limit(1).Find(&supaSecret)
 	if result.Error != nil {
 		return nil, result.Error
 	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
 	return &supaSecret, nil
 }
 
-func IsSecretAvailable(ctx context.Context, secretId string) bool {
+// GetAccessibleSecret returns the secret only if userId owns it, belongs to
+// the team that owns it or it has been shared with userId.
+func GetAccessibleSecret(ctx context.Context, secretId string, userId uint) (*models.SuperSecret, error) {
 	var supaSecret models.SuperSecret
-	result := DatabaseConnection.WithContext(ctx).Where("Id = ?", secretId).Find(&supaSecret)
-	return result.Error != nil
+	sharedWithUser := DatabaseConnection.Model(&models.SecretSharing{}).Select("1").
+		Where("secret_sharings.secret_id = super_secrets.id AND secret_sharings.recipient_id = ?", userId)
+	result := DatabaseConnection.WithContext(ctx).
+		Where("id = ?", secretId).
+		Where(readableBy(userId).Or("EXISTS (?)", sharedWithUser)).
+		Limit(1).Find(&supaSecret)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &supaSecret, nil
+}
+
+func IsSecretAvailable(ctx context.Context, secretId string) bool {
+	var count int64
+	result := DatabaseConnection.WithContext(ctx).Model(&models.SuperSecret{}).Where("id = ?", secretId).Count(&count)
+	return result.Error == nil && count > 0
 }
 
-func UpdateSuperSecret(ctx context.Context, supaSecret *models.SuperSecret) (bool, error) {
-	result := DatabaseConnection.WithContext(ctx).Save(&supaSecret)
+func UpdateSuperSecret(ctx context.Context, supaSecret *models.SuperSecret, ownerId uint) (bool, error) {
+	result := DatabaseConnection.WithContext(ctx).Model(&models.SuperSecret{}).
+		Where("id = ?", supaSecret.Id).
+		Where(writableBy(ownerId)).
+		Update("secret", supaSecret.Secret)
 	if result.Error != nil {
 		return false, result.Error
 	}
@@ -156,8 +325,8 @@ func UpdateSuperSecret(ctx context.Context, supaSecret *models.SuperSecret) (boo
 	return true, nil
 }
 
-func DeleteSuperSecret(ctx context.Context, supaSecret *models.SuperSecret) (bool, error) {
-	result := DatabaseConnection.WithContext(ctx).Delete(&supaSecret)
+func DeleteSuperSecret(ctx context.Context, supaSecret *models.SuperSecret, ownerId uint) (bool, error) {
+	result := DatabaseConnection.WithContext(ctx).Where("id = ?", supaSecret.Id).Where(writableBy(ownerId)).Delete(&models.SuperSecret{})
 	if result.Error != nil {
 		return false, result.Error
 	}
@@ -181,7 +350,14 @@ func ShareFile(ctx context.Context, fileShare *models.FileSharing) error {
 		if err := tx.First(&fileShare.Sender, fileShare.SenderId).Error; err != nil {
 			return err
 		}
-		if err := tx.Save(&fileShare).Error; err != nil {
+		result := tx.Where("id = ?", fileShare.FileId).Where(writableBy(fileShare.SenderId)).Limit(1).Find(&fileShare.File)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrForbidden
+		}
+		if err := tx.Omit(clause.Associations).Create(fileShare).Error; err != nil {
 			return err
 		}
 		return nil
@@ -191,7 +367,7 @@ func ShareFile(ctx context.Context, fileShare *models.FileSharing) error {
 
 func GetFileSharesOfAUser(ctx context.Context, senderId uint) ([]*models.FileSharing, error) {
 	var fileSharedForUser []*models.FileSharing
-	result := DatabaseConnection.WithContext(ctx).Where("SenderId = ?", senderId).Find(&fileSharedForUser)
+	result := DatabaseConnection.WithContext(ctx).Where("sender_id = ?", senderId).Find(&fileSharedForUser)
 	if result.Error != nil {
 		return nil, result.Error
 	}
@@ -212,7 +388,14 @@ func ShareSecret(ctx context.Context, secretShare *models.SecretSharing) error {
 		if err := tx.First(&secretShare.Sender, secretShare.SenderId).Error; err != nil {
 			return err
 		}
-		if err := tx.Save(&secretShare).Error; err != nil {
+		result := tx.Where("id = ?", secretShare.SecretId).Where(writableBy(secretShare.SenderId)).Limit(1).Find(&secretShare.Secret)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrForbidden
+		}
+		if err := tx.Omit(clause.Associations).Create(secretShare).Error; err != nil {
 			return err
 		}
 		return nil
@@ -222,7 +405,7 @@ func ShareSecret(ctx context.Context, secretShare *models.SecretSharing) error {
 
 func GetSecretSharesOfAUser(ctx context.Context, senderId uint) ([]*models.SecretSharing, error) {
 	var secretSharedForUser []*models.SecretSharing
-	result := DatabaseConnection.WithContext(ctx).Where("SenderId = ?", senderId).Find(&secretSharedForUser)
+	result := DatabaseConnection.WithContext(ctx).Where("sender_id = ?", senderId).Find(&secretSharedForUser)
 	if result.Error != nil {
 		return nil, result.Error
 	}
@@ -256,3 +439,7 @@ func SecretPasswordCount(ctx context.Context, secretPassCount *models.SecretPass
 	}
 	return nil
 }
+
+func RecordLoginLockout(ctx context.Context, event *models.LoginLockoutEvent) error {
+	return DatabaseConnection.WithContext(ctx).Create(event).Error
+}
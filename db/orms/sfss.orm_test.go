@@ -0,0 +1,75 @@
+package orms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/subashshakya/SFSS/models"
+)
+
+func TestIsUniqueViolation(t *testing.T) {
+	duplicate := &pgconn.PgError{Code: uniqueViolation}
+	if !isUniqueViolation(fmt.Errorf("insert: %w", duplicate)) {
+		t.Error("wrapped unique violation was not recognized")
+	}
+	if isUniqueViolation(&pgconn.PgError{Code: "23503"}) || isUniqueViolation(errors.New("23505")) || isUniqueViolation(nil) {
+		t.Error("other errors were taken for a unique violation")
+	}
+}
+
+func TestCreateDoesNotOverwriteExistingRows(t *testing.T) {
+	db := useTestDatabase(t, &models.SecureFile{}, &models.FileVersion{}, &models.SuperSecret{}, &models.FileSharing{}, &models.TeamMember{})
+	ctx := context.Background()
+	owner := models.User{FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com", Password: "x", PhoneNumber: "0"}
+	attacker := models.User{FirstName: "Eve", LastName: "Example", Email: "eve@example.com", Password: "x", PhoneNumber: "0"}
+	for _, user := range []*models.User{&owner, &attacker} {
+		if err := db.Create(user).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	file := models.SecureFile{Id: "file-1", FileName: "owner.txt", StorageKey: "owner-key", UserId: int(owner.Id)}
+	if _, err := CreateSecureFile(ctx, &file); err != nil {
+		t.Fatal(err)
+	}
+	secret := models.SuperSecret{Id: "secret-1", Secret: "owner secret", UserId: owner.Id}
+	if _, err := CreateSuperSecret(ctx, &secret); err != nil {
+		t.Fatal(err)
+	}
+	share := models.FileSharing{FileId: file.Id, SenderId: owner.Id, RecipientId: attacker.Id}
+	if err := ShareFile(ctx, &share); err != nil {
+		t.Fatal(err)
+	}
+
+	if created, err := CreateSecureFile(ctx, &models.SecureFile{Id: file.Id, FileName: "eve.txt", StorageKey: "eve-key", UserId: int(attacker.Id)}); err == nil || created {
+		t.Error("creating a file with an existing id succeeded")
+	}
+	if created, err := CreateSuperSecret(ctx, &models.SuperSecret{Id: secret.Id, Secret: "eve", UserId: attacker.Id}); err == nil || created {
+		t.Error("creating a secret with an existing id succeeded")
+	}
+	attackerFile := models.SecureFile{Id: "file-2", FileName: "eve.txt", StorageKey: "eve-key", UserId: int(attacker.Id)}
+	if _, err := CreateSecureFile(ctx, &attackerFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := ShareFile(ctx, &models.FileSharing{Id: share.Id, FileId: attackerFile.Id, SenderId: attacker.Id, RecipientId: attacker.Id}); err == nil {
+		t.Error("creating a share with an existing id succeeded")
+	}
+
+	var storedFile models.SecureFile
+	db.First(&storedFile, "id = ?", file.Id)
+	if storedFile.UserId != int(owner.Id) || storedFile.FileName != "owner.txt" || storedFile.StorageKey != "owner-key" {
+		t.Errorf("file was changed: %+v", storedFile.Metadata())
+	}
+	var storedSecret models.SuperSecret
+	db.First(&storedSecret, "id = ?", secret.Id)
+	if storedSecret.UserId != owner.Id || storedSecret.Secret != "owner secret" {
+		t.Errorf("secret was changed: user %d", storedSecret.UserId)
+	}
+	var storedShare models.FileSharing
+	db.First(&storedShare, share.Id)
+	if storedShare.FileId != file.Id || storedShare.SenderId != owner.Id {
+		t.Errorf("share was changed: %+v", storedShare)
+	}
+}
@@ -0,0 +1,267 @@
+package orms
+
+import (
+	"context"
+	"errors"
+
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrLastOwner = errors.New("organization must keep at least one owner")
+var ErrNotOrganizationMember = errors.New("user is not a member of the organization")
+
+var teamWriterRoles = []string{constants.MemberRoleOwner, constants.MemberRoleAdmin}
+
+// readableBy matches the files or secrets userId can read through ownership:
+// personal items they created and items of every team they belong to.
+// Membership is checked on each query so removal takes effect immediately.
+func readableBy(userId uint) *gorm.DB {
+	teams := DatabaseConnection.Model(&models.TeamMember{}).Select("team_id").Where("user_id = ?", userId)
+	return DatabaseConnection.Where("team_id IS NULL AND user_id = ?", userId).Or("team_id IN (?)", teams)
+}
+
+// writableBy is readableBy limited to teams where userId is owner or admin.
+func writableBy(userId uint) *gorm.DB {
+	teams := DatabaseConnection.Model(&models.TeamMember{}).Select("team_id").Where("user_id = ? AND role IN ?", userId, teamWriterRoles)
+	return DatabaseConnection.Where("team_id IS NULL AND user_id = ?", userId).Or("team_id IN (?)", teams)
+}
+
+func CanWriteTeamItems(role string) bool {
+	return role == constants.MemberRoleOwner || role == constants.MemberRoleAdmin
+}
+
+func CreateOrganization(ctx context.Context, organization *models.Organization, ownerId uint) error {
+	return DatabaseConnection.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(organization).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.OrganizationMember{OrganizationId: organization.Id, UserId: ownerId, Role: constants.MemberRoleOwner}).Error
+	})
+}
+
+func GetOrganizationsOfAUser(ctx context.Context, userId uint) ([]models.Organization, error) {
+	var organizations []models.Organization
+	memberOf := DatabaseConnection.Model(&models.OrganizationMember{}).Select("organization_id").Where("user_id = ?", userId)
+	result := DatabaseConnection.WithContext(ctx).Where("id IN (?)", memberOf).Order("name").Find(&organizations)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return organizations, nil
+}
+
+// GetOrganizationRole returns the role of userId in the organization, or an
+// empty string when they are not a member.
+func GetOrganizationRole(ctx context.Context, organizationId uint, userId uint) (string, error) {
+	var member models.OrganizationMember
+	result := DatabaseConnection.WithContext(ctx).Where("organization_id = ? AND user_id = ?", organizationId, userId).Limit(1).Find(&member)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	return member.Role, nil
+}
+
+func GetOrganizationMembers(ctx context.Context, organizationId uint) ([]models.MemberView, error) {
+	var members []models.MemberView
+	result := DatabaseConnection.WithContext(ctx).Model(&models.OrganizationMember{}).
+		Select("organization_members.user_id, organization_members.role, users.email, users.first_name, users.last_name").
+		Joins("JOIN users ON users.id = organization_members.user_id").
+		Where("organization_members.organization_id = ?", organizationId).
+		Order("users.email").
+		Scan(&members)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return members, nil
+}
+
+// SetOrganizationMember adds userId to the organization or changes their
+// role. The last owner cannot be demoted.
+func SetOrganizationMember(ctx context.Context, organizationId uint, userId uint, role string) error {
+	return DatabaseConnection.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var member models.OrganizationMember
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("organization_id = ? AND user_id = ?", organizationId, userId).Limit(1).Find(&member)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return tx.Create(&models.OrganizationMember{OrganizationId: organizationId, UserId: userId, Role: role}).Error
+		}
+		if member.Role == constants.MemberRoleOwner && role != constants.MemberRoleOwner {
+			if err := ensureAnotherOwner(tx, organizationId, userId); err != nil {
+				return err
+			}
+		}
+		return tx.Model(&member).Update("role", role).Error
+	})
+}
+
+// RemoveOrganizationMember also drops the user from every team of the
+// organization, which ends their access to team-owned items.
+func RemoveOrganizationMember(ctx context.Context, organizationId uint, userId uint) (bool, error) {
+	removed := false
+	err := DatabaseConnection.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var member models.OrganizationMember
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("organization_id = ? AND user_id = ?", organizationId, userId).Limit(1).Find(&member)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		if member.Role == constants.MemberRoleOwner {
+			if err := ensureAnotherOwner(tx, organizationId, userId); err != nil {
+				return err
+			}
+		}
+		var teamIds []uint
+		if err := tx.Model(&models.Team{}).Where("organization_id = ?", organizationId).Pluck("id", &teamIds).Error; err != nil {
+			return err
+		}
+		for _, teamId := range teamIds {
+			if err := removeTeamMember(tx, teamId, userId); err != nil {
+				return err
+			}
+		}
+		if err := tx.Delete(&member).Error; err != nil {
+			return err
+		}
+		removed = true
+		return nil
+	})
+	return removed, err
+}
+
+func ensureAnotherOwner(tx *gorm.DB, organizationId uint, userId uint) error {
+	var owners int64
+	if err := tx.Model(&models.OrganizationMember{}).
+		Where("organization_id = ? AND role = ? AND user_id <> ?", organizationId, constants.MemberRoleOwner, userId).
+		Count(&owners).Error; err != nil {
+		return err
+	}
+	if owners == 0 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+func CreateTeam(ctx context.Context, team *models.Team, creatorId uint) error {
+	return DatabaseConnection.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(team).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.TeamMember{TeamId: team.Id, UserId: creatorId, Role: constants.MemberRoleOwner}).Error
+	})
+}
+
+func GetTeam(ctx context.Context, teamId uint) (*models.Team, error) {
+	var team models.Team
+	result := DatabaseConnection.WithContext(ctx).Where("id = ?", teamId).Limit(1).Find(&team)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &team, nil
+}
+
+func GetTeamsOfOrganization(ctx context.Context, organizationId uint) ([]models.Team, error) {
+	var teams []models.Team
+	result := DatabaseConnection.WithContext(ctx).Where("organization_id = ?", organizationId).Order("name").Find(&teams)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return teams, nil
+}
+
+// GetTeamRole returns the role of userId in the team, or an empty string when
+// they are not a member.
+func GetTeamRole(ctx context.Context, teamId uint, userId uint) (string, error) {
+	var member models.TeamMember
+	result := DatabaseConnection.WithContext(ctx).Where("team_id = ? AND user_id = ?", teamId, userId).Limit(1).Find(&member)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	return member.Role, nil
+}
+
+func GetTeamMembers(ctx context.Context, teamId uint) ([]models.MemberView, error) {
+	var members []models.MemberView
+	result := DatabaseConnection.WithContext(ctx).Model(&models.TeamMember{}).
+		Select("team_members.user_id, team_members.role, users.email, users.first_name, users.last_name").
+		Joins("JOIN users ON users.id = team_members.user_id").
+		Where("team_members.team_id = ?", teamId).
+		Order("users.email").
+		Scan(&members)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return members, nil
+}
+
+// SetTeamMember adds userId to the team or changes their role. Only members
+// of the team's organization can join it.
+func SetTeamMember(ctx context.Context, team *models.Team, userId uint, role string) error {
+	return DatabaseConnection.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var orgMembers int64
+		if err := tx.Model(&models.OrganizationMember{}).
+			Where("organization_id = ? AND user_id = ?", team.OrganizationId, userId).
+			Count(&orgMembers).Error; err != nil {
+			return err
+		}
+		if orgMembers == 0 {
+			return ErrNotOrganizationMember
+		}
+		result := tx.Model(&models.TeamMember{}).Where("team_id = ? AND user_id = ?", team.Id, userId).Update("role", role)
+		if result.Error != nil || result.RowsAffected == 1 {
+			return result.Error
+		}
+		return tx.Create(&models.TeamMember{TeamId: team.Id, UserId: userId, Role: role}).Error
+	})
+}
+
+func RemoveTeamMember(ctx context.Context, teamId uint, userId uint) (bool, error) {
+	var members int64
+	err := DatabaseConnection.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.TeamMember{}).Where("team_id = ? AND user_id = ?", teamId, userId).Count(&members).Error; err != nil {
+			return err
+		}
+		if members == 0 {
+			return nil
+		}
+		return removeTeamMember(tx, teamId, userId)
+	})
+	return members != 0, err
+}
+
+// removeTeamMember deletes the membership together with any direct shares of
+// the team's items to that user, so nothing of the team stays readable.
+func removeTeamMember(tx *gorm.DB, teamId uint, userId uint) error {
+	if err := tx.Where("team_id = ? AND user_id = ?", teamId, userId).Delete(&models.TeamMember{}).Error; err != nil {
+		return err
+	}
+	teamFiles := tx.Model(&models.SecureFile{}).Select("id").Where("team_id = ?", teamId)
+	if err := tx.Where("recipient_id = ? AND file_id IN (?)", userId, teamFiles).Delete(&models.FileSharing{}).Error; err != nil {
+		return err
+	}
+	teamSecrets := tx.Model(&models.SuperSecret{}).Select("id").Where("team_id = ?", teamId)
+	return tx.Where("recipient_id = ? AND secret_id IN (?)", userId, teamSecrets).Delete(&models.SecretSharing{}).Error
+}
+
+func GetSecureFilesOfATeam(ctx context.Context, teamId uint) ([]models.SecureFile, error) {
+	var secureFiles []models.SecureFile
+	result := DatabaseConnection.WithContext(ctx).Where("team_id = ?", teamId).Find(&secureFiles)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return secureFiles, nil
+}
+
+func GetSecretsOfATeam(ctx context.Context, teamId uint) ([]models.SuperSecret, error) {
+	var secrets []models.SuperSecret
+	result := DatabaseConnection.WithContext(ctx).Where("team_id = ?", teamId).Find(&secrets)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return secrets, nil
+}
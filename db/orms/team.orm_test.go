@@ -0,0 +1,99 @@
+package orms
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/models"
+	"gorm.io/gorm/clause"
+)
+
+func TestRemovingATeamMemberRevokesAccess(t *testing.T) {
+	db := useTestDatabase(t, &models.Organization{}, &models.OrganizationMember{}, &models.Team{}, &models.TeamMember{},
+		&models.SecureFile{}, &models.SuperSecret{}, &models.FileSharing{}, &models.SecretSharing{})
+	ctx := context.Background()
+	users := []models.User{
+		{FirstName: "Ada", LastName: "Owner", Email: "ada@example.com", Password: "x", PhoneNumber: "0"},
+		{FirstName: "Bob", LastName: "Member", Email: "bob@example.com", Password: "x", PhoneNumber: "0"},
+		{FirstName: "Eve", LastName: "Outsider", Email: "eve@example.com", Password: "x", PhoneNumber: "0"},
+	}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	owner, member, outsider := users[0], users[1], users[2]
+	organization := models.Organization{Name: "Acme"}
+	if err := CreateOrganization(ctx, &organization, owner.Id); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetOrganizationMember(ctx, organization.Id, member.Id, constants.MemberRoleMember); err != nil {
+		t.Fatal(err)
+	}
+	team := models.Team{OrganizationId: organization.Id, Name: "Ops"}
+	if err := CreateTeam(ctx, &team, owner.Id); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetTeamMember(ctx, &team, member.Id, constants.MemberRoleMember); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetTeamMember(ctx, &team, outsider.Id, constants.MemberRoleMember); !errors.Is(err, ErrNotOrganizationMember) {
+		t.Fatalf("outsider joined the team: %v", err)
+	}
+
+	file := models.SecureFile{FileName: "runbook.md", UserId: int(owner.Id), TeamId: &team.Id}
+	secret := models.SuperSecret{Secret: "s", UserId: owner.Id, TeamId: &team.Id}
+	if err := db.Omit(clause.Associations).Create(&file).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Omit(clause.Associations).Create(&secret).Error; err != nil {
+		t.Fatal(err)
+	}
+	share := models.FileSharing{FileId: file.Id, SenderId: owner.Id, RecipientId: member.Id}
+	if err := db.Omit(clause.Associations).Create(&share).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if readable, _ := GetAccessibleSecureFile(ctx, file.Id, member.Id); readable == nil {
+		t.Fatal("team member cannot read the team file")
+	}
+	if readable, _ := GetAccessibleSecret(ctx, secret.Id, member.Id); readable == nil {
+		t.Fatal("team member cannot read the team secret")
+	}
+	if deleted, _ := DeleteSecureFile(ctx, file.Id, member.Id); deleted {
+		t.Fatal("a plain member deleted a team file")
+	}
+
+	if removed, err := RemoveTeamMember(ctx, team.Id, member.Id); err != nil || !removed {
+		t.Fatalf("RemoveTeamMember = %v, %v", removed, err)
+	}
+	if readable, _ := GetAccessibleSecureFile(ctx, file.Id, member.Id); readable != nil {
+		t.Error("removed member can still read the team file, directly shared or not")
+	}
+	if readable, _ := GetAccessibleSecret(ctx, secret.Id, member.Id); readable != nil {
+		t.Error("removed member can still read the team secret")
+	}
+	if readable, _ := GetAccessibleSecureFile(ctx, file.Id, owner.Id); readable == nil {
+		t.Error("the owner lost access")
+	}
+}
+
+func TestOrganizationKeepsAnOwner(t *testing.T) {
+	db := useTestDatabase(t, &models.Organization{}, &models.OrganizationMember{}, &models.Team{}, &models.TeamMember{},
+		&models.SecureFile{}, &models.SuperSecret{}, &models.FileSharing{}, &models.SecretSharing{})
+	ctx := context.Background()
+	owner := models.User{FirstName: "Ada", LastName: "Owner", Email: "ada@example.com", Password: "x", PhoneNumber: "0"}
+	if err := db.Create(&owner).Error; err != nil {
+		t.Fatal(err)
+	}
+	organization := models.Organization{Name: "Acme"}
+	if err := CreateOrganization(ctx, &organization, owner.Id); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetOrganizationMember(ctx, organization.Id, owner.Id, constants.MemberRoleMember); !errors.Is(err, ErrLastOwner) {
+		t.Errorf("demoting the last owner: %v", err)
+	}
+	if _, err := RemoveOrganizationMember(ctx, organization.Id, owner.Id); !errors.Is(err, ErrLastOwner) {
+		t.Errorf("removing the last owner: %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package orms
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/subashshakya/SFSS/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrRefreshTokenNotFound = errors.New("refresh token not found")
+var ErrRefreshTokenExpired = errors.New("refresh token expired")
+var ErrRefreshTokenReused = errors.New("refresh token reused, token family revoked")
+
+func CreateRefreshToken(ctx context.Context, refreshToken *models.RefreshToken) error {
+	if refreshToken.UserId == 0 {
+		return errors.New("UserID cannot be zero")
+	}
+	return DatabaseConnection.WithContext(ctx).Create(refreshToken).Error
+}
+
+// RotateRefreshToken swaps the presented refresh token for next. Presenting a
+// token that was already rotated or revoked revokes the whole family.
+func RotateRefreshToken(ctx context.Context, tokenHash string, next *models.RefreshToken) (*models.RefreshToken, error) {
+	var current models.RefreshToken
+	reused := false
+	err := DatabaseConnection.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("token_hash = ?", tokenHash).Limit(1).Find(&current)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenNotFound
+		}
+		now := time.Now()
+		if current.RevokedAt != nil {
+			reused = true
+			return revokeRefreshTokenFamily(tx, current.FamilyId, now)
+		}
+		if now.After(current.ExpiresAt) {
+			return ErrRefreshTokenExpired
+		}
+		next.UserId = current.UserId
+		next.FamilyId = current.FamilyId
+		if err := tx.Create(next).Error; err != nil {
+			return err
+		}
+		return tx.Model(&current).Updates(map[string]interface{}{"revoked_at": now, "replaced_by": next.Id}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reused {
+		return nil, ErrRefreshTokenReused
+	}
+	return &current, nil
+}
+
+func RevokeRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	var refreshToken models.RefreshToken
+	result := DatabaseConnection.WithContext(ctx).Where("token_hash = ? AND revoked_at IS NULL", tokenHash).Limit(1).Find(&refreshToken)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrRefreshTokenNotFound
+	}
+	if err := DatabaseConnection.WithContext(ctx).Model(&refreshToken).Update("revoked_at", time.Now()).Error; err != nil {
+		return nil, err
+	}
+	return &refreshToken, nil
+}
+
+// revokeRefreshTokenFamily also ends the session, since a session is the
+// family of refresh tokens issued from one sign-in.
+func revokeRefreshTokenFamily(tx *gorm.DB, familyId string, revokedAt time.Time) error {
+	if err := tx.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyId).
+		Update("revoked_at", revokedAt).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", familyId).
+		Update("revoked_at", revokedAt).Error
+}
+
+func RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	if jti == "" {
+		return errors.New("JTI cannot be empty")
+	}
+	revoked := models.RevokedAccessToken{Jti: jti, ExpiresAt: expiresAt}
+	return DatabaseConnection.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&revoked).Error
+}
+
+// DeleteExpiredAccessTokenRevocations forgets revocations of access tokens
+// that expired before now, since those are rejected anyway.
+func DeleteExpiredAccessTokenRevocations(ctx context.Context, now time.Time) (int64, error) {
+	result := DatabaseConnection.WithContext(ctx).Where("expires_at < ?", now).Delete(&models.RevokedAccessToken{})
+	return result.RowsAffected, result.Error
+}
+
+func IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var count int64
+	result := DatabaseConnection.WithContext(ctx).Model(&models.RevokedAccessToken{}).Where("jti = ?", jti).Count(&count)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return count > 0, nil
+}
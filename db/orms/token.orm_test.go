@@ -0,0 +1,113 @@
+package orms
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/subashshakya/SFSS/models"
+	"gorm.io/gorm"
+)
+
+func startTokenFamily(t *testing.T, db *gorm.DB) (models.Session, models.RefreshToken) {
+	t.Helper()
+	user := models.User{FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com", Password: "x", PhoneNumber: "0"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	session := models.Session{UserId: user.Id, LastSeenAt: time.Now()}
+	if err := db.Create(&session).Error; err != nil {
+		t.Fatal(err)
+	}
+	first := models.RefreshToken{UserId: user.Id, FamilyId: session.Id, TokenHash: "first", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := CreateRefreshToken(context.Background(), &first); err != nil {
+		t.Fatal(err)
+	}
+	return session, first
+}
+
+func TestRotateRefreshTokenChainsTheFamily(t *testing.T) {
+	db := useTestDatabase(t, &models.Session{}, &models.RefreshToken{})
+	session, first := startTokenFamily(t, db)
+
+	second := models.RefreshToken{TokenHash: "second", ExpiresAt: time.Now().Add(time.Hour)}
+	previous, err := RotateRefreshToken(context.Background(), "first", &second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if previous.Id != first.Id || second.FamilyId != session.Id || second.UserId != first.UserId {
+		t.Fatalf("rotated %+v into %+v", previous, second)
+	}
+	var rotated models.RefreshToken
+	db.First(&rotated, first.Id)
+	if rotated.RevokedAt == nil || rotated.ReplacedBy == nil || *rotated.ReplacedBy != second.Id {
+		t.Errorf("rotated token = %+v", rotated)
+	}
+
+	third := models.RefreshToken{TokenHash: "third", ExpiresAt: time.Now().Add(time.Hour)}
+	if _, err := RotateRefreshToken(context.Background(), "second", &third); err != nil {
+		t.Fatalf("rotating the new token: %v", err)
+	}
+}
+
+func TestRotateRefreshTokenRevokesFamilyOnReuse(t *testing.T) {
+	db := useTestDatabase(t, &models.Session{}, &models.RefreshToken{})
+	session, _ := startTokenFamily(t, db)
+	second := models.RefreshToken{TokenHash: "second", ExpiresAt: time.Now().Add(time.Hour)}
+	if _, err := RotateRefreshToken(context.Background(), "first", &second); err != nil {
+		t.Fatal(err)
+	}
+
+	replay := models.RefreshToken{TokenHash: "replay", ExpiresAt: time.Now().Add(time.Hour)}
+	if _, err := RotateRefreshToken(context.Background(), "first", &replay); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("reusing a rotated token: err = %v, want %v", err, ErrRefreshTokenReused)
+	}
+	var live int64
+	db.Model(&models.RefreshToken{}).Where("family_id = ? AND revoked_at IS NULL", session.Id).Count(&live)
+	if live != 0 {
+		t.Errorf("%d tokens of the family are still live", live)
+	}
+	var revoked models.Session
+	db.First(&revoked, "id = ?", session.Id)
+	if revoked.RevokedAt == nil {
+		t.Error("session was not revoked")
+	}
+	next := models.RefreshToken{TokenHash: "next", ExpiresAt: time.Now().Add(time.Hour)}
+	if _, err := RotateRefreshToken(context.Background(), "second", &next); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Errorf("rotating the thief's token after reuse: err = %v, want %v", err, ErrRefreshTokenReused)
+	}
+}
+
+func TestRotateRefreshTokenRejectsUnknownAndExpired(t *testing.T) {
+	db := useTestDatabase(t, &models.Session{}, &models.RefreshToken{})
+	_, first := startTokenFamily(t, db)
+	next := models.RefreshToken{TokenHash: "next", ExpiresAt: time.Now().Add(time.Hour)}
+	if _, err := RotateRefreshToken(context.Background(), "unknown", &next); !errors.Is(err, ErrRefreshTokenNotFound) {
+		t.Errorf("unknown token: err = %v", err)
+	}
+	db.Model(&first).Update("expires_at", time.Now().Add(-time.Minute))
+	if _, err := RotateRefreshToken(context.Background(), "first", &next); !errors.Is(err, ErrRefreshTokenExpired) {
+		t.Errorf("expired token: err = %v", err)
+	}
+}
+
+func TestDeleteExpiredAccessTokenRevocations(t *testing.T) {
+	db := useTestDatabase(t, &models.RevokedAccessToken{})
+	ctx := context.Background()
+	now := time.Now()
+	if err := RevokeAccessToken(ctx, "expired", now.Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := RevokeAccessToken(ctx, "live", now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if deleted, err := DeleteExpiredAccessTokenRevocations(ctx, now); err != nil || deleted != 1 {
+		t.Fatalf("deleted %d, err %v", deleted, err)
+	}
+	var revoked []string
+	db.Model(&models.RevokedAccessToken{}).Pluck("jti", &revoked)
+	if len(revoked) != 1 || revoked[0] != "live" {
+		t.Errorf("revocations left = %v", revoked)
+	}
+}
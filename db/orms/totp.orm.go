@@ -0,0 +1,93 @@
+package orms
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/subashshakya/SFSS/models"
+	"gorm.io/gorm"
+)
+
+var ErrTotpCodeReplayed = errors.New("totp code was already used")
+
+func SetPendingTotpSecret(ctx context.Context, userId uint, secret string) error {
+	result := DatabaseConnection.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND totp_enabled = ?", userId, false).
+		Update("totp_secret", secret)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("two-factor authentication is already enabled")
+	}
+	return nil
+}
+
+// EnableTotp turns on two-factor authentication for the user and replaces any
+// previously issued recovery codes in a single transaction.
+func EnableTotp(ctx context.Context, userId uint, step int64, recoveryCodeHashes []string) error {
+	return DatabaseConnection.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND totp_enabled = ?", userId, false).
+			Updates(map[string]interface{}{"totp_enabled": true, "totp_last_step": step})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("two-factor authentication is already enabled")
+		}
+		if err := tx.Where("user_id = ?", userId).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		recoveryCodes := make([]models.RecoveryCode, 0, len(recoveryCodeHashes))
+		for _, hash := range recoveryCodeHashes {
+			recoveryCodes = append(recoveryCodes, models.RecoveryCode{UserId: userId, CodeHash: hash})
+		}
+		return tx.Create(&recoveryCodes).Error
+	})
+}
+
+// MarkTotpStepUsed records the time step of an accepted code. A step that is
+// not newer than the last accepted one is a replay.
+func MarkTotpStepUsed(ctx context.Context, userId uint, step int64) error {
+	result := DatabaseConnection.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", userId, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTotpCodeReplayed
+	}
+	return nil
+}
+
+func ConsumeRecoveryCode(ctx context.Context, userId uint, codeHash string) (bool, error) {
+	result := DatabaseConnection.WithContext(ctx).Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userId, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// GetTotpSecrets returns the id and TOTP secret of up to limit users with a
+// secret whose id comes after afterId, in id order.
+func GetTotpSecrets(ctx context.Context, afterId uint, limit int) ([]models.User, error) {
+	users := []models.User{}
+	result := DatabaseConnection.WithContext(ctx).Select("id", "totp_secret").
+		Where("totp_secret IS NOT NULL AND id > ?", afterId).
+		Order("id").Limit(limit).Find(&users)
+	return users, result.Error
+}
+
+// ReplaceTotpSecret stores secret for the user unless the stored secret is
+// no longer previous, in which case it returns false.
+func ReplaceTotpSecret(ctx context.Context, userId uint, previous string, secret string) (bool, error) {
+	result := DatabaseConnection.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND totp_secret = ?", userId, previous).
+		Update("totp_secret", secret)
+	return result.RowsAffected == 1, result.Error
+}
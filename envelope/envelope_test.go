@@ -0,0 +1,24 @@
+package envelope
+
+import (
+	"crypto/rand"
+	"testing"
+)
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func testKeyring(t *testing.T, ids ...string) *Keyring {
+	t.Helper()
+	keyring := &Keyring{Active: ids[0], Keys: map[string][]byte{}}
+	for _, id := range ids {
+		keyring.Keys[id] = randomBytes(t, keySize)
+	}
+	return keyring
+}
@@ -0,0 +1,269 @@
+// Package envelope encrypts file contents with a random key per file and
+// wraps that key with a master key that never leaves the server.
+package envelope
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/subashshakya/SFSS/models"
+	"github.com/subashshakya/SFSS/storage"
+)
+
+const (
+	// AlgorithmStream is AES-256-GCM over 64 KiB segments, see stream.go.
+	AlgorithmStream = "aes-256-gcm-stream-64k"
+	// KeyAlgorithmGCM wraps a data key with AES-256-GCM under a random nonce,
+	// bound to the storage key of the content.
+	KeyAlgorithmGCM = "aes-256-gcm"
+
+	keySize            = 32
+	wrapAssociatedData = "sfss-file-key:v1:"
+)
+
+var ErrUnknownAlgorithm = errors.New("file encryption algorithm is not supported")
+var ErrKeyUnavailable = errors.New("master key for the file is not configured")
+var ErrNoKeys = errors.New("FILE_ENCRYPTION_KEYS is not set; set FILE_ENCRYPTION_DISABLED=true to store files unencrypted")
+
+// Default has no keys, so content is stored in plain until FromEnv loads
+// the master keys.
+var Default *Keyring
+
+// Keyring holds the master keys. New files are encrypted under Active; the
+// others are kept to read files written before a rotation.
+type Keyring struct {
+	Active string
+	Keys   map[string][]byte
+}
+
+// FromEnv reads FILE_ENCRYPTION_KEYS, a comma separated list of id:key pairs
+// with base64 encoded 32 byte keys. The first key is the active one. Without
+// keys it fails, unless FILE_ENCRYPTION_DISABLED=true asks for files to be
+// stored in plain, in which case it returns nil.
+func FromEnv() (*Keyring, error) {
+	raw := os.Getenv("FILE_ENCRYPTION_KEYS")
+	if raw == "" {
+		if os.Getenv("FILE_ENCRYPTION_DISABLED") == "true" {
+			return nil, nil
+		}
+		return nil, ErrNoKeys
+	}
+	keyring := &Keyring{Keys: map[string][]byte{}}
+	for _, pair := range strings.Split(raw, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || id == "" {
+			return nil, errors.New("FILE_ENCRYPTION_KEYS entries must be id:key")
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != keySize {
+			return nil, fmt.Errorf("file encryption key %q must be %d base64 encoded bytes", id, keySize)
+		}
+		if _, exists := keyring.Keys[id]; exists {
+			return nil, fmt.Errorf("file encryption key %q is listed twice", id)
+		}
+		keyring.Keys[id] = key
+		if keyring.Active == "" {
+			keyring.Active = id
+		}
+	}
+	return keyring, nil
+}
+
+// Put stores r under storageKey, encrypted with a new data key when the
+// keyring has keys, and returns what has to be saved with the file to read
+// it back.
+func (k *Keyring) Put(ctx context.Context, store storage.BlobStore, storageKey string, r io.Reader) (models.FileEncryption, error) {
+	if k == nil {
+		_, err := store.Put(ctx, storageKey, r)
+		return models.FileEncryption{}, err
+	}
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return models.FileEncryption{}, err
+	}
+	encryption, err := k.wrap(storageKey, dataKey)
+	if err != nil {
+		return models.FileEncryption{}, err
+	}
+	encrypted, err := NewEncryptingReader(r, dataKey)
+	if err != nil {
+		return models.FileEncryption{}, err
+	}
+	_, err = store.Put(ctx, storageKey, encrypted)
+	return encryption, err
+}
+
+// Open reads the content stored under storageKey. Reads fail with
+// ErrIntegrity when the stored content was changed.
+func (k *Keyring) Open(ctx context.Context, store storage.BlobStore, storageKey string, encryption models.FileEncryption) (io.ReadCloser, error) {
+	if encryption.Algorithm == "" {
+		return store.Get(ctx, storageKey)
+	}
+	if encryption.Algorithm != AlgorithmStream {
+		return nil, ErrUnknownAlgorithm
+	}
+	dataKey, err := k.unwrap(storageKey, encryption)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := store.Get(ctx, storageKey)
+	if err != nil {
+		return nil, err
+	}
+	decrypted, err := NewDecryptingReader(stored, dataKey)
+	if err != nil {
+		stored.Close()
+		return nil, err
+	}
+	return readCloser{Reader: decrypted, Closer: stored}, nil
+}
+
+func (k *Keyring) wrap(storageKey string, dataKey []byte) (models.FileEncryption, error) {
+	aead, err := newGCM(k.Keys[k.Active])
+	if err != nil {
+		return models.FileEncryption{}, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return models.FileEncryption{}, err
+	}
+	wrapped := aead.Seal(nonce, nonce, dataKey, []byte(wrapAssociatedData+storageKey))
+	return models.FileEncryption{
+		Algorithm:    AlgorithmStream,
+		KeyAlgorithm: KeyAlgorithmGCM,
+		KeyId:        k.Active,
+		WrappedKey:   base64.StdEncoding.EncodeToString(wrapped),
+	}, nil
+}
+
+func (k *Keyring) unwrap(storageKey string, encryption models.FileEncryption) ([]byte, error) {
+	if encryption.KeyAlgorithm != KeyAlgorithmGCM {
+		return nil, ErrUnknownAlgorithm
+	}
+	if k == nil || k.Keys[encryption.KeyId] == nil {
+		return nil, ErrKeyUnavailable
+	}
+	aead, err := newGCM(k.Keys[encryption.KeyId])
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(encryption.WrappedKey)
+	if err != nil || len(wrapped) < aead.NonceSize() {
+		return nil, ErrIntegrity
+	}
+	dataKey, err := aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], []byte(wrapAssociatedData+storageKey))
+	if err != nil {
+		return nil, ErrIntegrity
+	}
+	return dataKey, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// OpenSeeker is Open for content of a known plain size that also seeks,
+// for serving ranges. Nothing is read until the first Read after a Seek,
+// and then only from the segment holding the new position on.
+func (k *Keyring) OpenSeeker(ctx context.Context, store storage.BlobStore, storageKey string, encryption models.FileEncryption, size int64) (io.ReadSeekCloser, error) {
+	if encryption.Algorithm == "" {
+		return &seekingReader{size: size, open: func(offset int64) (io.ReadCloser, error) {
+			return store.GetRange(ctx, storageKey, offset, -1)
+		}}, nil
+	}
+	if encryption.Algorithm != AlgorithmStream {
+		return nil, ErrUnknownAlgorithm
+	}
+	dataKey, err := k.unwrap(storageKey, encryption)
+	if err != nil {
+		return nil, err
+	}
+	return &seekingReader{size: size, open: func(offset int64) (io.ReadCloser, error) {
+		first := offset / segmentSize
+		stored, err := store.GetRange(ctx, storageKey, first*(segmentSize+tagSize), -1)
+		if err != nil {
+			return nil, err
+		}
+		decrypted, err := newSegmentDecryptingReader(stored, dataKey, uint32(first), size)
+		if err == nil {
+			_, err = io.CopyN(io.Discard, decrypted, offset-first*segmentSize)
+		}
+		if err != nil {
+			stored.Close()
+			return nil, err
+		}
+		return readCloser{Reader: decrypted, Closer: stored}, nil
+	}}, nil
+}
+
+type seekingReader struct {
+	open    func(offset int64) (io.ReadCloser, error)
+	size    int64
+	offset  int64
+	current io.ReadCloser
+}
+
+func (r *seekingReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.current == nil {
+		current, err := r.open(r.offset)
+		if err != nil {
+			return 0, err
+		}
+		r.current = current
+	}
+	if remaining := r.size - r.offset; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := r.current.Read(p)
+	r.offset += int64(n)
+	if err == io.EOF && r.offset < r.size {
+		err = ErrIntegrity
+	}
+	return n, err
+}
+
+func (r *seekingReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, errors.New("seek before the start of the content")
+	}
+	if offset != r.offset {
+		r.Close()
+		r.offset = offset
+	}
+	return offset, nil
+}
+
+func (r *seekingReader) Close() error {
+	if r.current == nil {
+		return nil
+	}
+	err := r.current.Close()
+	r.current = nil
+	return err
+}
@@ -0,0 +1,135 @@
+package envelope
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/subashshakya/SFSS/storage"
+)
+
+func TestFromEnv(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(make([]byte, keySize))
+	t.Setenv("FILE_ENCRYPTION_KEYS", "new:"+key+", old:"+key)
+	keyring, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyring.Active != "new" || len(keyring.Keys) != 2 {
+		t.Errorf("keyring = %+v", keyring)
+	}
+	for _, raw := range []string{"nokey", "short:" + base64.StdEncoding.EncodeToString([]byte("short")), "a:" + key + ",a:" + key} {
+		t.Setenv("FILE_ENCRYPTION_KEYS", raw)
+		if _, err := FromEnv(); err == nil {
+			t.Errorf("FromEnv() accepted %q", raw)
+		}
+	}
+}
+
+func TestFromEnvNeedsKeysOrOptOut(t *testing.T) {
+	t.Setenv("FILE_ENCRYPTION_KEYS", "")
+	t.Setenv("FILE_ENCRYPTION_DISABLED", "")
+	if _, err := FromEnv(); !errors.Is(err, ErrNoKeys) {
+		t.Errorf("without keys: err = %v, want %v", err, ErrNoKeys)
+	}
+	t.Setenv("FILE_ENCRYPTION_DISABLED", "true")
+	if keyring, err := FromEnv(); keyring != nil || err != nil {
+		t.Errorf("opted out: FromEnv() = %v, %v", keyring, err)
+	}
+}
+
+func TestKeyringPutOpen(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := &storage.LocalStore{Dir: dir}
+	keyring := testKeyring(t, "k1")
+	plain := randomBytes(t, segmentSize*2+5)
+
+	encryption, err := keyring.Put(ctx, store, "file-1", bytes.NewReader(plain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encryption.Algorithm != AlgorithmStream || encryption.KeyId != "k1" {
+		t.Errorf("encryption = %+v", encryption)
+	}
+	stored, err := os.ReadFile(filepath.Join(dir, "fi", "file-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(stored, plain[:64]) {
+		t.Error("content was stored in plain")
+	}
+	opened, err := keyring.Open(ctx, store, "file-1", encryption)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer opened.Close()
+	read, err := io.ReadAll(opened)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read, plain) {
+		t.Error("Open() returned other content")
+	}
+
+	rotated := testKeyring(t, "k2")
+	rotated.Keys["k1"] = keyring.Keys["k1"]
+	if opened, err := rotated.Open(ctx, store, "file-1", encryption); err != nil {
+		t.Errorf("after rotation: %v", err)
+	} else {
+		opened.Close()
+	}
+	if _, err := testKeyring(t, "k2").Open(ctx, store, "file-1", encryption); !errors.Is(err, ErrKeyUnavailable) {
+		t.Errorf("without the master key: err = %v, want %v", err, ErrKeyUnavailable)
+	}
+}
+
+func TestKeyringBindsDataKeyToStorageKey(t *testing.T) {
+	ctx := context.Background()
+	store := &storage.LocalStore{Dir: t.TempDir()}
+	keyring := testKeyring(t, "k1")
+	first, err := keyring.Put(ctx, store, "first", bytes.NewReader([]byte("first content")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keyring.Put(ctx, store, "second", bytes.NewReader([]byte("second content"))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keyring.Open(ctx, store, "second", first); !errors.Is(err, ErrIntegrity) {
+		t.Errorf("opening with another file's key: err = %v, want %v", err, ErrIntegrity)
+	}
+}
+
+func TestKeyringOpenSeeker(t *testing.T) {
+	ctx := context.Background()
+	store := &storage.LocalStore{Dir: t.TempDir()}
+	keyring := testKeyring(t, "k1")
+	plain := randomBytes(t, segmentSize*3+100)
+	encryption, err := keyring.Put(ctx, store, "file", bytes.NewReader(plain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	seeker, err := keyring.OpenSeeker(ctx, store, "file", encryption, int64(len(plain)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer seeker.Close()
+	for _, offset := range []int64{0, 10, segmentSize - 3, segmentSize, 2*segmentSize + 7, int64(len(plain)) - 1} {
+		if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		chunk := make([]byte, 10)
+		n, err := io.ReadFull(seeker, chunk)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			t.Fatalf("offset %d: %v", offset, err)
+		}
+		if !bytes.Equal(chunk[:n], plain[offset:offset+int64(n)]) {
+			t.Errorf("offset %d: read other content", offset)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package envelope
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Content is split into segments of segmentSize bytes that are sealed one
+// by one, so files of any size are encrypted and decrypted in constant
+// memory. The nonce of a segment is its index followed by a flag marking
+// the final segment; with a fresh data key for every file this keeps nonces
+// unique, and a stream that was cut short, reordered or extended fails to
+// open.
+const (
+	segmentSize = 64 << 10
+	nonceSize   = 12
+	tagSize     = 16
+)
+
+var ErrIntegrity = errors.New("file content failed the integrity check")
+
+func segmentNonce(index uint32, last bool) []byte {
+	nonce := make([]byte, nonceSize)
+	binary.BigEndian.PutUint32(nonce[7:11], index)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+type encryptingReader struct {
+	src     io.Reader
+	aead    cipher.AEAD
+	buf     []byte
+	carried int
+	sealed  []byte
+	out     []byte
+	index   uint32
+	done    bool
+}
+
+// NewEncryptingReader returns the encryption of everything read from src.
+func NewEncryptingReader(src io.Reader, dataKey []byte) (io.Reader, error) {
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptingReader{src: src, aead: aead, buf: make([]byte, segmentSize+1)}, nil
+}
+
+func (e *encryptingReader) Read(p []byte) (int, error) {
+	for len(e.out) == 0 {
+		if e.done {
+			return 0, io.EOF
+		}
+		if err := e.sealNext(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, e.out)
+	e.out = e.out[n:]
+	return n, nil
+}
+
+// sealNext reads one byte past the segment to know whether it is the last.
+func (e *encryptingReader) sealNext() error {
+	n, err := io.ReadFull(e.src, e.buf[e.carried:])
+	n += e.carried
+	last := err == io.EOF || err == io.ErrUnexpectedEOF
+	if err != nil && !last {
+		return err
+	}
+	if !last {
+		n = segmentSize
+	}
+	e.sealed = e.aead.Seal(e.sealed[:0], segmentNonce(e.index, last), e.buf[:n], nil)
+	e.out = e.sealed
+	if last {
+		e.done = true
+		return nil
+	}
+	if e.index == ^uint32(0) {
+		return errors.New("content is too large to encrypt")
+	}
+	e.index++
+	e.buf[0] = e.buf[segmentSize]
+	e.carried = 1
+	return nil
+}
+
+type decryptingReader struct {
+	src     io.Reader
+	aead    cipher.AEAD
+	buf     []byte
+	carried int
+	opened  []byte
+	out     []byte
+	index   uint32
+	// lastIndex is the index of the final segment, or -1 to find it by
+	// reading past each segment.
+	lastIndex int64
+	done      bool
+}
+
+// NewDecryptingReader returns the content of a stream written by
+// NewEncryptingReader. Reads fail with ErrIntegrity when the stream was
+// changed in any way.
+func NewDecryptingReader(src io.Reader, dataKey []byte) (io.Reader, error) {
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptingReader{src: src, aead: aead, buf: make([]byte, segmentSize+tagSize+1), lastIndex: -1}, nil
+}
+
+// newSegmentDecryptingReader decrypts a stream that starts at segment
+// first of content that is size bytes long in plain.
+func newSegmentDecryptingReader(src io.Reader, dataKey []byte, first uint32, size int64) (*decryptingReader, error) {
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	lastIndex := int64(0)
+	if size > 0 {
+		lastIndex = (size - 1) / segmentSize
+	}
+	return &decryptingReader{src: src, aead: aead, buf: make([]byte, segmentSize+tagSize), index: first, lastIndex: lastIndex}, nil
+}
+
+func (d *decryptingReader) Read(p []byte) (int, error) {
+	for len(d.out) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.openNext(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	return n, nil
+}
+
+func (d *decryptingReader) openNext() error {
+	n, err := io.ReadFull(d.src, d.buf[d.carried:])
+	n += d.carried
+	last := err == io.EOF || err == io.ErrUnexpectedEOF
+	if err != nil && !last {
+		return err
+	}
+	if d.lastIndex >= 0 {
+		last = int64(d.index) == d.lastIndex
+	} else if !last {
+		n = segmentSize + tagSize
+	}
+	d.opened, err = d.aead.Open(d.opened[:0], segmentNonce(d.index, last), d.buf[:n], nil)
+	if err != nil {
+		return ErrIntegrity
+	}
+	d.out = d.opened
+	if last {
+		d.done = true
+		return nil
+	}
+	d.index++
+	if d.lastIndex < 0 {
+		d.buf[0] = d.buf[segmentSize+tagSize]
+		d.carried = 1
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package envelope
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func encrypt(t *testing.T, plain []byte, dataKey []byte) []byte {
+	t.Helper()
+	encrypting, err := NewEncryptingReader(bytes.NewReader(plain), dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := io.ReadAll(encrypting)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sealed
+}
+
+func decrypt(sealed []byte, dataKey []byte) ([]byte, error) {
+	decrypting, err := NewDecryptingReader(bytes.NewReader(sealed), dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(decrypting)
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	dataKey := randomBytes(t, keySize)
+	for _, size := range []int{0, 1, segmentSize - 1, segmentSize, segmentSize + 1, 3*segmentSize + 17} {
+		plain := randomBytes(t, size)
+		sealed := encrypt(t, plain, dataKey)
+		segments := (size + segmentSize - 1) / segmentSize
+		if segments == 0 {
+			segments = 1
+		}
+		if len(sealed) != size+segments*tagSize {
+			t.Errorf("size %d: sealed %d bytes, want %d", size, len(sealed), size+segments*tagSize)
+		}
+		opened, err := decrypt(sealed, dataKey)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if !bytes.Equal(opened, plain) {
+			t.Errorf("size %d: content changed in the round trip", size)
+		}
+	}
+}
+
+func TestStreamDetectsTampering(t *testing.T) {
+	dataKey := randomBytes(t, keySize)
+	sealed := encrypt(t, randomBytes(t, 2*segmentSize+100), dataKey)
+	segment := segmentSize + tagSize
+	swapped := append(append(append([]byte{}, sealed[segment:2*segment]...), sealed[:segment]...), sealed[2*segment:]...)
+	flipped := append([]byte{}, sealed...)
+	flipped[segment+5] ^= 1
+	tests := map[string][]byte{
+		"flipped bit":           flipped,
+		"truncated at segment":  sealed[:2*segment],
+		"truncated mid segment": sealed[:segment+10],
+		"reordered segments":    swapped,
+		"extended":              append(append([]byte{}, sealed...), encrypt(t, []byte("more"), dataKey)...),
+	}
+	for name, changed := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := decrypt(changed, dataKey); !errors.Is(err, ErrIntegrity) {
+				t.Errorf("err = %v, want %v", err, ErrIntegrity)
+			}
+		})
+	}
+	t.Run("other key", func(t *testing.T) {
+		if _, err := decrypt(sealed, randomBytes(t, keySize)); !errors.Is(err, ErrIntegrity) {
+			t.Errorf("err = %v, want %v", err, ErrIntegrity)
+		}
+	})
+}
@@ -0,0 +1,67 @@
+package envelope
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+)
+
+const (
+	// sealedValuePrefix starts every value sealed by SealValue. Plain values
+	// such as base32 TOTP secrets never contain a colon.
+	sealedValuePrefix   = "enc:v1:"
+	valueAssociatedData = "sfss-value:v1:"
+)
+
+// IsSealedValue reports whether stored was written by SealValue.
+func IsSealedValue(stored string) bool {
+	return strings.HasPrefix(stored, sealedValuePrefix)
+}
+
+// SealValue encrypts a small value kept in the database, such as a TOTP
+// secret, with AES-256-GCM under the active master key. purpose names where
+// the value is kept, so that it cannot be moved to another row or column.
+// Without keys the value is returned as is.
+func (k *Keyring) SealValue(plain string, purpose string) (string, error) {
+	if k == nil {
+		return plain, nil
+	}
+	aead, err := newGCM(k.Keys[k.Active])
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plain), []byte(valueAssociatedData+purpose))
+	return sealedValuePrefix + k.Active + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// OpenValue returns the plain value of stored, which is either sealed by
+// SealValue for the same purpose or was saved before it was encrypted.
+func (k *Keyring) OpenValue(stored string, purpose string) (string, error) {
+	if !IsSealedValue(stored) {
+		return stored, nil
+	}
+	keyId, encoded, ok := strings.Cut(strings.TrimPrefix(stored, sealedValuePrefix), ":")
+	if !ok {
+		return "", ErrIntegrity
+	}
+	if k == nil || k.Keys[keyId] == nil {
+		return "", ErrKeyUnavailable
+	}
+	aead, err := newGCM(k.Keys[keyId])
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", ErrIntegrity
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(valueAssociatedData+purpose))
+	if err != nil {
+		return "", ErrIntegrity
+	}
+	return string(plain), nil
+}
@@ -0,0 +1,36 @@
+package envelope
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSealValue(t *testing.T) {
+	keyring := testKeyring(t, "k1")
+	sealed, err := keyring.SealValue("JBSWY3DPEHPK3PXP", "totp:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsSealedValue(sealed) || sealed == "JBSWY3DPEHPK3PXP" {
+		t.Fatalf("sealed = %q", sealed)
+	}
+	if plain, err := keyring.OpenValue(sealed, "totp:1"); err != nil || plain != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("OpenValue() = %q, %v", plain, err)
+	}
+	if _, err := keyring.OpenValue(sealed, "totp:2"); !errors.Is(err, ErrIntegrity) {
+		t.Errorf("other purpose: err = %v, want %v", err, ErrIntegrity)
+	}
+	if _, err := testKeyring(t, "k2").OpenValue(sealed, "totp:1"); !errors.Is(err, ErrKeyUnavailable) {
+		t.Errorf("without the master key: err = %v, want %v", err, ErrKeyUnavailable)
+	}
+	if plain, err := keyring.OpenValue("JBSWY3DPEHPK3PXP", "totp:1"); err != nil || plain != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("plain value: OpenValue() = %q, %v", plain, err)
+	}
+}
+
+func TestSealValueWithoutKeys(t *testing.T) {
+	var keyring *Keyring
+	if sealed, err := keyring.SealValue("secret", "totp:1"); err != nil || sealed != "secret" {
+		t.Errorf("SealValue() = %q, %v", sealed, err)
+	}
+}
@@ -0,0 +1,49 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/db/orms"
+)
+
+const accountDeletionBatchSize = 50
+
+// RunAccountDeletion purges accounts whose grace period is over, once at start
+// and then every interval until ctx is cancelled.
+func RunAccountDeletion(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		purgeDueAccounts(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func purgeDueAccounts(ctx context.Context) {
+	listCtx, cancel := context.WithTimeout(ctx, constants.ShortTimeout)
+	userIds, err := orms.GetUsersDueForDeletion(listCtx, time.Now(), accountDeletionBatchSize)
+	cancel()
+	if err != nil {
+		log.Println("Could not list accounts due for deletion:", err)
+		return
+	}
+	for _, userId := range userIds {
+		purgeCtx, cancel := context.WithTimeout(ctx, constants.LongTimeout*4)
+		tombstone, err := orms.PurgeUser(purgeCtx, userId, time.Now())
+		cancel()
+		if err != nil {
+			log.Println("Could not purge account", userId, ":", err)
+			continue
+		}
+		if tombstone != nil {
+			log.Printf("Purged account %d: %d files, %d secrets, %d shares", userId, tombstone.FilesDeleted, tombstone.SecretsDeleted, tombstone.SharesDeleted)
+		}
+	}
+}
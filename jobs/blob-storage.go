@@ -0,0 +1,163 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/db/orms"
+	"github.com/subashshakya/SFSS/envelope"
+	"github.com/subashshakya/SFSS/models"
+	"github.com/subashshakya/SFSS/storage"
+	"github.com/subashshakya/SFSS/utils"
+)
+
+const blobDeletionBatchSize = 100
+const fileDataMigrationBatchSize = 10
+
+// RunBlobDeletion removes content of deleted or replaced files from the blob
+// store, once at start and then every interval until ctx is cancelled.
+func RunBlobDeletion(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		deleteQueuedBlobs(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func deleteQueuedBlobs(ctx context.Context) {
+	listCtx, cancel := context.WithTimeout(ctx, constants.ShortTimeout)
+	deletions, err := orms.GetBlobDeletions(listCtx, blobDeletionBatchSize)
+	cancel()
+	if err != nil {
+		log.Println("Could not list queued blob deletions:", err)
+		return
+	}
+	for _, deletion := range deletions {
+		deleteCtx, cancel := context.WithTimeout(ctx, constants.LongTimeout)
+		err := storage.Default.Delete(deleteCtx, deletion.StorageKey)
+		if err == nil {
+			err = orms.RemoveBlobDeletion(deleteCtx, deletion.Id)
+		}
+		cancel()
+		if err != nil {
+			log.Println("Could not delete blob", deletion.StorageKey, ":", err)
+		}
+	}
+}
+
+// MigrateFileData copies file contents still kept in the database to the
+// blob store, encrypted when master keys are configured, and clears them
+// from the database. It is safe to run while the
+// server is up and to run again after an interruption. It returns the
+// number of files moved.
+func MigrateFileData(ctx context.Context) (int, error) {
+	moved := 0
+	for {
+		listCtx, cancel := context.WithTimeout(ctx, constants.LongTimeout)
+		files, err := orms.GetFilesWithInlineData(listCtx, fileDataMigrationBatchSize)
+		cancel()
+		if err != nil {
+			return moved, err
+		}
+		if len(files) == 0 {
+			return moved, nil
+		}
+		for _, file := range files {
+			storageKey := uuid.New().String()
+			putCtx, cancel := context.WithTimeout(ctx, constants.LongTimeout*4)
+			stored := models.SecureFile{
+				Id:         file.Id,
+				StorageKey: storageKey,
+				SizeBytes:  int64(len(file.FileData)),
+				Sha256:     utils.ContentSha256(file.FileData),
+			}
+			var err error
+			stored.Encryption, err = envelope.Default.Put(putCtx, storage.Default, storageKey, bytes.NewReader(file.FileData))
+			if err != nil {
+				cancel()
+				return moved, err
+			}
+			updated, err := orms.MoveFileDataToStorage(putCtx, &stored)
+			if err != nil || !updated {
+				storage.Default.Delete(putCtx, storageKey)
+			}
+			cancel()
+			if err != nil {
+				return moved, err
+			}
+			if updated {
+				moved++
+			}
+		}
+	}
+}
+
+// EncryptStoredFiles encrypts content that files and versions keep in the
+// blob store in plain, written before master keys were configured. Each
+// content is copied to a new key encrypted, the rows are switched over and
+// the plain copy is queued for deletion. Like MigrateFileData it is safe to
+// run while the server is up and to run again. It returns the number of
+// contents encrypted.
+func EncryptStoredFiles(ctx context.Context) (int, error) {
+	if envelope.Default == nil {
+		return 0, envelope.ErrNoKeys
+	}
+	encrypted := 0
+	after := ""
+	for {
+		listCtx, cancel := context.WithTimeout(ctx, constants.LongTimeout)
+		storageKeys, err := orms.GetPlainStorageKeys(listCtx, after, fileDataMigrationBatchSize)
+		cancel()
+		if err != nil {
+			return encrypted, err
+		}
+		if len(storageKeys) == 0 {
+			return encrypted, nil
+		}
+		for _, plainKey := range storageKeys {
+			after = plainKey
+			replaced, err := encryptStoredContent(ctx, plainKey)
+			if errors.Is(err, storage.ErrNotFound) {
+				log.Println("Plain content", plainKey, "is missing from the blob store, skipped")
+				continue
+			}
+			if err != nil {
+				return encrypted, err
+			}
+			if replaced {
+				encrypted++
+			}
+		}
+	}
+}
+
+func encryptStoredContent(ctx context.Context, plainKey string) (bool, error) {
+	putCtx, cancel := context.WithTimeout(ctx, constants.LongTimeout*4)
+	defer cancel()
+	plain, err := storage.Default.Get(putCtx, plainKey)
+	if err != nil {
+		return false, err
+	}
+	defer plain.Close()
+	encrypted := models.SecureFile{StorageKey: uuid.New().String()}
+	encrypted.Encryption, err = envelope.Default.Put(putCtx, storage.Default, encrypted.StorageKey, plain)
+	if err != nil {
+		storage.Default.Delete(putCtx, encrypted.StorageKey)
+		return false, err
+	}
+	replaced, err := orms.ReplacePlainContent(putCtx, plainKey, &encrypted)
+	if err != nil || !replaced {
+		storage.Default.Delete(putCtx, encrypted.StorageKey)
+	}
+	return replaced, err
+}
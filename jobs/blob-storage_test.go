@@ -0,0 +1,120 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"testing"
+
+	"github.com/subashshakya/SFSS/db/dbtest"
+	"github.com/subashshakya/SFSS/db/orms"
+	"github.com/subashshakya/SFSS/envelope"
+	"github.com/subashshakya/SFSS/models"
+	"github.com/subashshakya/SFSS/storage"
+)
+
+func TestEncryptStoredFiles(t *testing.T) {
+	db := dbtest.Open(t, &models.User{}, &models.SecureFile{}, &models.FileVersion{}, &models.BlobDeletion{})
+	previousDB, previousStore, previousKeyring := orms.DatabaseConnection, storage.Default, envelope.Default
+	t.Cleanup(func() {
+		orms.DatabaseConnection, storage.Default, envelope.Default = previousDB, previousStore, previousKeyring
+	})
+	orms.DatabaseConnection = db
+	storage.Default = &storage.LocalStore{Dir: t.TempDir()}
+	key := make([]byte, 32)
+	rand.Read(key)
+	envelope.Default = &envelope.Keyring{Active: "k1", Keys: map[string][]byte{"k1": key}}
+
+	ctx := context.Background()
+	user := models.User{FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com", Password: "x", PhoneNumber: "0"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	content := []byte("written before encryption was configured")
+	if _, err := storage.Default.Put(ctx, "plain-key", bytes.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	file := models.SecureFile{FileName: "old.txt", StorageKey: "plain-key", SizeBytes: int64(len(content)), UserId: int(user.Id)}
+	if err := db.Create(&file).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&models.FileVersion{OriginalId: file.OriginalId, Version: 1, StorageKey: "plain-key", SizeBytes: file.SizeBytes}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := EncryptStoredFiles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encrypted != 1 {
+		t.Errorf("encrypted %d contents, want 1", encrypted)
+	}
+	db.First(&file, "id = ?", file.Id)
+	if file.StorageKey == "plain-key" || file.Encryption.Algorithm != envelope.AlgorithmStream {
+		t.Fatalf("file still points at plain content: %+v", file)
+	}
+	var version models.FileVersion
+	db.First(&version, "original_id = ?", file.OriginalId)
+	if version.StorageKey != file.StorageKey || version.Encryption != file.Encryption {
+		t.Errorf("version = %+v, file encryption %+v", version, file.Encryption)
+	}
+	opened, err := envelope.Default.Open(ctx, storage.Default, file.StorageKey, file.Encryption)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer opened.Close()
+	if read, _ := io.ReadAll(opened); !bytes.Equal(read, content) {
+		t.Error("encrypted content does not match")
+	}
+	var queued int64
+	db.Model(&models.BlobDeletion{}).Where("storage_key = ?", "plain-key").Count(&queued)
+	if queued != 1 {
+		t.Error("plain content was not queued for deletion")
+	}
+
+	if again, err := EncryptStoredFiles(ctx); err != nil || again != 0 {
+		t.Errorf("second run encrypted %d, err %v", again, err)
+	}
+}
+
+func TestMigrateFileDataRecordsTheFirstVersion(t *testing.T) {
+	db := dbtest.Open(t, &models.User{}, &models.SecureFile{}, &models.FileVersion{}, &models.BlobDeletion{})
+	previousDB, previousStore, previousKeyring := orms.DatabaseConnection, storage.Default, envelope.Default
+	t.Cleanup(func() {
+		orms.DatabaseConnection, storage.Default, envelope.Default = previousDB, previousStore, previousKeyring
+	})
+	orms.DatabaseConnection = db
+	storage.Default = &storage.LocalStore{Dir: t.TempDir()}
+	envelope.Default = nil
+	// file_data only exists in databases from before the blob store.
+	if err := db.Exec("ALTER TABLE secure_files ADD COLUMN file_data BYTEA").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	user := models.User{FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com", Password: "x", PhoneNumber: "0"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	file := models.SecureFile{FileName: "inline.txt", UserId: int(user.Id)}
+	if err := db.Create(&file).Error; err != nil {
+		t.Fatal(err)
+	}
+	content := []byte("kept in the database")
+	if err := db.Exec("UPDATE secure_files SET file_data = ? WHERE id = ?", content, file.Id).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if moved, err := MigrateFileData(ctx); err != nil || moved != 1 {
+		t.Fatalf("moved %d, err %v", moved, err)
+	}
+	db.First(&file, "id = ?", file.Id)
+	versions, err := orms.GetFileVersions(ctx, &file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 || versions[0].Version != 1 || versions[0].OriginalId != file.Id || versions[0].StorageKey != file.StorageKey {
+		t.Fatalf("versions = %+v, file = %+v", versions, file)
+	}
+}
@@ -0,0 +1,46 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/db/orms"
+	"github.com/subashshakya/SFSS/utils"
+)
+
+const versionRetentionBatchSize = 100
+
+// RunVersionRetention removes file versions that aged out of the retention,
+// once at start and then every interval until ctx is cancelled. Versions are
+// also pruned whenever a file changes, so this only catches files left
+// untouched. Their content is left to the blob deletion job.
+func RunVersionRetention(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		pruneFileVersions(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func pruneFileVersions(ctx context.Context) {
+	retention := utils.FileVersionRetention()
+	for {
+		pruneCtx, cancel := context.WithTimeout(ctx, constants.LongTimeout)
+		pruned, err := orms.PruneExpiredFileVersions(pruneCtx, retention, versionRetentionBatchSize)
+		cancel()
+		if err != nil {
+			log.Println("Could not prune file versions:", err)
+			return
+		}
+		if pruned < versionRetentionBatchSize {
+			return
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/db/orms"
+	"github.com/subashshakya/SFSS/utils"
+)
+
+const loginAttemptCleanupBatchSize = 1000
+
+// RunRecordCleanup removes sign-in attempts older than the login history
+// retention and access token revocations and spent step-up codes past their
+// expiry, once at start and then every interval until ctx is cancelled.
+func RunRecordCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		cleanUpRecords(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func cleanUpRecords(ctx context.Context) {
+	now := time.Now()
+	deleteCtx, cancel := context.WithTimeout(ctx, constants.LongTimeout)
+	if _, err := orms.DeleteExpiredAccessTokenRevocations(deleteCtx, now); err != nil {
+		log.Println("Could not delete expired access token revocations:", err)
+	}
+	if _, err := orms.DeleteExpiredStepUpCodes(deleteCtx, now); err != nil {
+		log.Println("Could not delete expired step-up codes:", err)
+	}
+	cancel()
+	before := now.Add(-utils.LoginHistoryRetention())
+	for {
+		deleteCtx, cancel := context.WithTimeout(ctx, constants.LongTimeout)
+		deleted, err := orms.DeleteOldLoginAttempts(deleteCtx, before, loginAttemptCleanupBatchSize)
+		cancel()
+		if err != nil {
+			log.Println("Could not delete old sign-in attempts:", err)
+			return
+		}
+		if deleted < loginAttemptCleanupBatchSize {
+			return
+		}
+	}
+}
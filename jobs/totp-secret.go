@@ -0,0 +1,54 @@
+package jobs
+
+import (
+	"context"
+
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/db/orms"
+	"github.com/subashshakya/SFSS/envelope"
+	"github.com/subashshakya/SFSS/utils"
+)
+
+const totpSecretBatchSize = 100
+
+// EncryptTotpSecrets encrypts TOTP secrets saved in plain before they were
+// sealed with the master keys. A secret changed in the meantime is left to
+// the change. It is safe to run while the server is up and to run again,
+// and returns the number of secrets encrypted.
+func EncryptTotpSecrets(ctx context.Context) (int, error) {
+	if envelope.Default == nil {
+		return 0, envelope.ErrNoKeys
+	}
+	encrypted := 0
+	var after uint
+	for {
+		listCtx, cancel := context.WithTimeout(ctx, constants.LongTimeout)
+		users, err := orms.GetTotpSecrets(listCtx, after, totpSecretBatchSize)
+		cancel()
+		if err != nil {
+			return encrypted, err
+		}
+		if len(users) == 0 {
+			return encrypted, nil
+		}
+		for _, user := range users {
+			after = user.Id
+			if envelope.IsSealedValue(user.TotpSecret.String) {
+				continue
+			}
+			sealed, err := utils.SealTotpSecret(user.Id, user.TotpSecret.String)
+			if err != nil {
+				return encrypted, err
+			}
+			saveCtx, cancel := context.WithTimeout(ctx, constants.ShortTimeout)
+			replaced, err := orms.ReplaceTotpSecret(saveCtx, user.Id, user.TotpSecret.String, sealed)
+			cancel()
+			if err != nil {
+				return encrypted, err
+			}
+			if replaced {
+				encrypted++
+			}
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"testing"
+
+	"github.com/subashshakya/SFSS/db/dbtest"
+	"github.com/subashshakya/SFSS/db/orms"
+	"github.com/subashshakya/SFSS/envelope"
+	"github.com/subashshakya/SFSS/models"
+	"github.com/subashshakya/SFSS/utils"
+)
+
+func TestEncryptTotpSecrets(t *testing.T) {
+	db := dbtest.Open(t, &models.User{})
+	previousDB, previousKeyring := orms.DatabaseConnection, envelope.Default
+	t.Cleanup(func() { orms.DatabaseConnection, envelope.Default = previousDB, previousKeyring })
+	orms.DatabaseConnection = db
+	key := make([]byte, 32)
+	rand.Read(key)
+	envelope.Default = &envelope.Keyring{Active: "k1", Keys: map[string][]byte{"k1": key}}
+
+	user := models.User{FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com", Password: "x", PhoneNumber: "0",
+		TotpSecret: sql.NullString{String: "JBSWY3DPEHPK3PXP", Valid: true}}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	encrypted, err := EncryptTotpSecrets(ctx)
+	if err != nil || encrypted != 1 {
+		t.Fatalf("encrypted %d secrets, err %v", encrypted, err)
+	}
+	db.First(&user, user.Id)
+	if !envelope.IsSealedValue(user.TotpSecret.String) {
+		t.Fatalf("secret is still stored in plain: %q", user.TotpSecret.String)
+	}
+	if secret, err := utils.OpenTotpSecret(user.Id, user.TotpSecret.String); err != nil || secret != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("OpenTotpSecret() = %q, %v", secret, err)
+	}
+	if again, err := EncryptTotpSecrets(ctx); err != nil || again != 0 {
+		t.Errorf("second run encrypted %d, err %v", again, err)
+	}
+}
@@ -0,0 +1,182 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/db/orms"
+	"github.com/subashshakya/SFSS/envelope"
+	"github.com/subashshakya/SFSS/models"
+	"github.com/subashshakya/SFSS/storage"
+	"github.com/subashshakya/SFSS/utils"
+)
+
+// uploadAssemblyLease is how long an instance may spend assembling one
+// upload before another one takes it over.
+const uploadAssemblyLease = time.Hour
+
+var uploadAssemblyWake = make(chan struct{}, 1)
+
+// WakeUploadAssembly asks RunUploadAssembly to look for finished uploads now
+// instead of at its next tick.
+func WakeUploadAssembly() {
+	select {
+	case uploadAssemblyWake <- struct{}{}:
+	default:
+	}
+}
+
+// RunUploadAssembly turns resumable uploads whose chunks have all arrived
+// into files, once at start, then every interval and whenever
+// WakeUploadAssembly is called, until ctx is cancelled.
+func RunUploadAssembly(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		assembleUploads(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-uploadAssemblyWake:
+		}
+	}
+}
+
+func assembleUploads(ctx context.Context) {
+	for ctx.Err() == nil {
+		claimCtx, cancel := context.WithTimeout(ctx, constants.ShortTimeout)
+		upload, err := orms.ClaimFinishedUpload(claimCtx, time.Now(), uploadAssemblyLease)
+		cancel()
+		if err != nil {
+			log.Println("Could not claim a finished upload:", err)
+			return
+		}
+		if upload == nil {
+			return
+		}
+		if err := assembleUpload(ctx, upload); err != nil {
+			log.Println("Could not assemble upload", upload.Id, ":", err)
+		}
+	}
+}
+
+// assembleUpload joins the parts of upload into a new file. An upload to a
+// team the user can no longer add to is dropped.
+func assembleUpload(ctx context.Context, upload *models.FileUpload) error {
+	if upload.TeamId != nil {
+		checkCtx, cancel := context.WithTimeout(ctx, constants.ShortTimeout)
+		role, err := orms.GetTeamRole(checkCtx, *upload.TeamId, upload.UserId)
+		if err == nil && !orms.CanWriteTeamItems(role) {
+			_, err = orms.DeleteFileUpload(checkCtx, upload.Id, upload.UserId)
+			if err == nil {
+				err = errors.New("user can no longer add files to the team")
+			}
+		}
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+	hash, err := utils.ResumeHashingReader(nil, 0, upload.HashState)
+	if err != nil {
+		return err
+	}
+	secureFile := models.SecureFile{
+		Id:          uuid.New().String(),
+		FileName:    upload.FileName,
+		StorageKey:  uuid.New().String(),
+		ContentType: upload.ContentType,
+		SizeBytes:   upload.Length,
+		Sha256:      hash.Sum(),
+		UserId:      int(upload.UserId),
+		TeamId:      upload.TeamId,
+	}
+	listCtx, cancel := context.WithTimeout(ctx, constants.ShortTimeout)
+	parts, err := orms.GetFileUploadParts(listCtx, upload.Id)
+	cancel()
+	if err == nil {
+		err = checkUploadParts(parts, upload.Length)
+	}
+	if err == nil {
+		content := &uploadPartsReader{ctx: ctx, parts: parts}
+		secureFile.Encryption, err = envelope.Default.Put(ctx, storage.Default, secureFile.StorageKey, content)
+		content.Close()
+	}
+	completed := false
+	if err == nil {
+		saveCtx, cancel := context.WithTimeout(ctx, constants.ShortTimeout)
+		completed, err = orms.CompleteFileUpload(saveCtx, upload.Id, &secureFile)
+		cancel()
+	}
+	if !completed {
+		deleteCtx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+		if deleteErr := storage.Default.Delete(deleteCtx, secureFile.StorageKey); deleteErr != nil && !errors.Is(deleteErr, storage.ErrNotFound) {
+			log.Println("Could not remove assembled content:", deleteErr)
+		}
+		cancel()
+	}
+	return err
+}
+
+// checkUploadParts makes sure the parts cover the upload without gaps.
+func checkUploadParts(parts []models.FileUploadPart, length int64) error {
+	var offset int64
+	for _, part := range parts {
+		if part.Offset != offset {
+			return errors.New("upload parts are not contiguous")
+		}
+		offset += part.SizeBytes
+	}
+	if offset != length {
+		return errors.New("upload parts do not add up to the upload length")
+	}
+	return nil
+}
+
+// uploadPartsReader reads the parts one after the other, opening each only
+// when the previous one is done.
+type uploadPartsReader struct {
+	ctx     context.Context
+	parts   []models.FileUploadPart
+	current io.ReadCloser
+}
+
+func (r *uploadPartsReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.parts) == 0 {
+				return 0, io.EOF
+			}
+			part := r.parts[0]
+			r.parts = r.parts[1:]
+			content, err := envelope.Default.Open(r.ctx, storage.Default, part.StorageKey, part.Encryption)
+			if err != nil {
+				return 0, err
+			}
+			r.current = content
+		}
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			r.current.Close()
+			r.current = nil
+			if n == 0 {
+				continue
+			}
+			return n, nil
+		}
+		return n, err
+	}
+}
+
+func (r *uploadPartsReader) Close() error {
+	if r.current == nil {
+		return nil
+	}
+	return r.current.Close()
+}
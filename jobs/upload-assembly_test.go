@@ -0,0 +1,57 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"strconv"
+	"testing"
+
+	"github.com/subashshakya/SFSS/envelope"
+	"github.com/subashshakya/SFSS/models"
+	"github.com/subashshakya/SFSS/storage"
+)
+
+func TestCheckUploadParts(t *testing.T) {
+	parts := []models.FileUploadPart{{Offset: 0, SizeBytes: 5}, {Offset: 5, SizeBytes: 3}}
+	if err := checkUploadParts(parts, 8); err != nil {
+		t.Errorf("contiguous parts: %v", err)
+	}
+	if err := checkUploadParts(parts, 9); err == nil {
+		t.Error("parts short of the length were accepted")
+	}
+	if err := checkUploadParts([]models.FileUploadPart{{Offset: 0, SizeBytes: 5}, {Offset: 6, SizeBytes: 2}}, 8); err == nil {
+		t.Error("parts with a gap were accepted")
+	}
+}
+
+func TestUploadPartsReaderJoinsParts(t *testing.T) {
+	previousStore, previousKeyring := storage.Default, envelope.Default
+	t.Cleanup(func() { storage.Default, envelope.Default = previousStore, previousKeyring })
+	storage.Default = &storage.LocalStore{Dir: t.TempDir()}
+	key := make([]byte, 32)
+	rand.Read(key)
+	envelope.Default = &envelope.Keyring{Active: "k1", Keys: map[string][]byte{"k1": key}}
+
+	ctx := context.Background()
+	var parts []models.FileUploadPart
+	for i, chunk := range []string{"first,", "", "second,", "third"} {
+		part := models.FileUploadPart{StorageKey: "part-" + strconv.Itoa(i)}
+		encryption, err := envelope.Default.Put(ctx, storage.Default, part.StorageKey, bytes.NewReader([]byte(chunk)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Encryption = encryption
+		parts = append(parts, part)
+	}
+	reader := &uploadPartsReader{ctx: ctx, parts: parts}
+	defer reader.Close()
+	joined, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(joined) != "first,second,third" {
+		t.Errorf("read %q", joined)
+	}
+}
@@ -0,0 +1,43 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/db/orms"
+)
+
+const uploadExpirationBatchSize = 100
+
+// RunUploadExpiration removes resumable uploads past their expiry, once at
+// start and then every interval until ctx is cancelled. Their chunks are
+// left to the blob deletion job.
+func RunUploadExpiration(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		expireUploads(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func expireUploads(ctx context.Context) {
+	for {
+		deleteCtx, cancel := context.WithTimeout(ctx, constants.LongTimeout)
+		deleted, err := orms.DeleteExpiredFileUploads(deleteCtx, time.Now(), uploadExpirationBatchSize)
+		cancel()
+		if err != nil {
+			log.Println("Could not delete expired uploads:", err)
+			return
+		}
+		if deleted < uploadExpirationBatchSize {
+			return
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+var Default Mailer = NewMemoryMailer("")
+
+// FromEnv builds the mailer selected by MAILER: "smtp" sends through
+// SMTP_HOST, "file" writes every message to MAILER_DIR and anything else keeps
+// messages in memory.
+func FromEnv() Mailer {
+	switch os.Getenv("MAILER") {
+	case "smtp":
+		return &SMTPMailer{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("MAIL_FROM"),
+		}
+	case "file":
+		return NewMemoryMailer(os.Getenv("MAILER_DIR"))
+	default:
+		return NewMemoryMailer("")
+	}
+}
+
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, message Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	address := fmt.Sprintf("%s:%s", m.Host, m.Port)
+	return smtp.SendMail(address, auth, m.From, []string{message.To}, encode(m.From, message))
+}
+
+// MemoryMailer keeps every message it is given so that they can be inspected.
+// With a directory set each message is also written there as an .eml file.
+type MemoryMailer struct {
+	mu       sync.Mutex
+	dir      string
+	messages []Message
+}
+
+func NewMemoryMailer(dir string) *MemoryMailer {
+	return &MemoryMailer{dir: dir}
+}
+
+func (m *MemoryMailer) Send(ctx context.Context, message Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, message)
+	if m.dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(m.dir, 0700); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), sanitizeFileName(message.To))
+	return os.WriteFile(filepath.Join(m.dir, name), encode("", message), 0600)
+}
+
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+func (m *MemoryMailer) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = nil
+}
+
+func encode(from string, message Message) []byte {
+	var builder strings.Builder
+	if from != "" {
+		builder.WriteString("From: " + headerValue(from) + "\r\n")
+	}
+	builder.WriteString("To: " + headerValue(message.To) + "\r\n")
+	builder.WriteString("Subject: " + headerValue(message.Subject) + "\r\n")
+	builder.WriteString("MIME-Version: 1.0\r\n")
+	builder.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	builder.WriteString("\r\n")
+	builder.WriteString(message.Body)
+	return []byte(builder.String())
+}
+
+func headerValue(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
+
+func sanitizeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' {
+			return '_'
+		}
+		return r
+	}, name)
+}
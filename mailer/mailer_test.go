@@ -0,0 +1,71 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMemoryMailerKeepsMessages(t *testing.T) {
+	m := NewMemoryMailer("")
+	first := Message{To: "ada@example.com", Subject: "One", Body: "first"}
+	second := Message{To: "bob@example.com", Subject: "Two", Body: "second"}
+	for _, message := range []Message{first, second} {
+		if err := m.Send(context.Background(), message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	messages := m.Messages()
+	if len(messages) != 2 || messages[0] != first || messages[1] != second {
+		t.Fatalf("Messages() = %v", messages)
+	}
+	messages[0].Body = "changed"
+	if m.Messages()[0].Body != "first" {
+		t.Error("Messages() returned the mailer's own slice")
+	}
+	m.Reset()
+	if len(m.Messages()) != 0 {
+		t.Error("Reset() kept messages")
+	}
+}
+
+func TestMemoryMailerWritesFiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	m := NewMemoryMailer(dir)
+	message := Message{To: "ada@example.com", Subject: "Hello\r\nBcc: eve@example.com", Body: "the body"}
+	if err := m.Send(context.Background(), message); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || !strings.HasSuffix(entries[0].Name(), "-ada@example.com.eml") {
+		t.Fatalf("files = %v", entries)
+	}
+	contents, err := os.ReadFile(filepath.Join(dir, entries[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(contents)
+	if !strings.Contains(text, "Subject: HelloBcc: eve@example.com\r\n") {
+		t.Errorf("header line breaks were not stripped:\n%s", text)
+	}
+	if !strings.HasSuffix(text, "\r\n\r\nthe body") {
+		t.Errorf("body missing:\n%s", text)
+	}
+}
+
+func TestMemoryMailerHonoursCancellation(t *testing.T) {
+	m := NewMemoryMailer("")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := m.Send(ctx, Message{To: "ada@example.com"}); err == nil {
+		t.Fatal("Send() with a cancelled context succeeded")
+	}
+	if len(m.Messages()) != 0 {
+		t.Error("cancelled message was kept")
+	}
+}
@@ -0,0 +1,63 @@
+package mailer
+
+import (
+	"context"
+	"log"
+)
+
+const defaultQueueSize = 100
+const defaultQueueWorkers = 2
+
+// Queue runs mail jobs on a fixed number of workers, so that a burst of
+// requests cannot start an unbounded number of goroutines. A job does the
+// lookups for its message as well as sending it, which keeps that work out of
+// the request and its response time.
+type Queue struct {
+	jobs chan func(ctx context.Context)
+}
+
+// Background is the queue handlers hand their mail to. It does nothing until
+// Run is started.
+var Background = NewQueue(defaultQueueSize)
+
+func NewQueue(size int) *Queue {
+	return &Queue{jobs: make(chan func(ctx context.Context), size)}
+}
+
+// Enqueue adds the job without waiting. When the queue is full the job is
+// dropped and false returned, the same way whether or not the job would have
+// sent anything.
+func (q *Queue) Enqueue(job func(ctx context.Context)) bool {
+	select {
+	case q.jobs <- job:
+		return true
+	default:
+		log.Println("Mail queue is full, dropping a message")
+		return false
+	}
+}
+
+// Run works through queued jobs with the given number of workers until ctx
+// is cancelled.
+func (q *Queue) Run(ctx context.Context, workers int) {
+	if workers <= 0 {
+		workers = defaultQueueWorkers
+	}
+	done := make(chan struct{})
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-q.jobs:
+					job(ctx)
+				}
+			}
+		}()
+	}
+	for i := 0; i < workers; i++ {
+		<-done
+	}
+}
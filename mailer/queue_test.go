@@ -0,0 +1,47 @@
+package mailer
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestQueueDropsJobsWhenFull(t *testing.T) {
+	queue := NewQueue(2)
+	for i := 0; i < 2; i++ {
+		if !queue.Enqueue(func(ctx context.Context) {}) {
+			t.Fatalf("job %d was dropped", i)
+		}
+	}
+	if queue.Enqueue(func(ctx context.Context) {}) {
+		t.Fatal("job accepted past the queue size")
+	}
+}
+
+func TestQueueRunsJobsUntilCancelled(t *testing.T) {
+	queue := NewQueue(10)
+	ran := make(chan int, 10)
+	for i := 0; i < 5; i++ {
+		i := i
+		queue.Enqueue(func(ctx context.Context) { ran <- i })
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		queue.Run(ctx, 2)
+		close(stopped)
+	}()
+	for i := 0; i < 5; i++ {
+		select {
+		case <-ran:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only %d of 5 jobs ran", i)
+		}
+	}
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+}
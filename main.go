@@ -1,22 +1,76 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"github.com/subashshakya/SFSS/constants"
 	"github.com/subashshakya/SFSS/db/connection"
 	"github.com/subashshakya/SFSS/db/orms"
+	"github.com/subashshakya/SFSS/envelope"
+	"github.com/subashshakya/SFSS/jobs"
+	"github.com/subashshakya/SFSS/mailer"
+	"github.com/subashshakya/SFSS/oidc"
+	"github.com/subashshakya/SFSS/passwordpolicy"
 	router "github.com/subashshakya/SFSS/routes"
+	"github.com/subashshakya/SFSS/storage"
+	"github.com/subashshakya/SFSS/throttle"
+	"github.com/subashshakya/SFSS/utils"
 )
 
 func main() {
+	rotateKeys := flag.Bool("rotate-signing-key", false, "generate a new JWT signing key in JWT_KEYS_DIR, make it active and exit")
+	grantAdmin := flag.String("grant-admin", "", "give the user with this email the admin role and exit")
+	migrateFileData := flag.Bool("migrate-file-data", false, "move file contents still stored in the database to the blob store, encrypt contents and TOTP secrets stored in plain and exit")
+	flag.Parse()
+
 	err := godotenv.Load(".env")
 
 	if err != nil {
 		panic(err)
 	}
+	if *rotateKeys {
+		key, err := utils.RotateSigningKeys(os.Getenv("JWT_KEYS_DIR"), utils.SigningAlgorithm())
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println("Active signing key:", key.Kid)
+		return
+	}
+	if _, err := utils.CurrentKeyring(); err != nil {
+		panic(err)
+	}
+	mailer.Default = mailer.FromEnv()
+	passwordpolicy.Default = passwordpolicy.FromEnv()
+	storage.Default, err = storage.FromEnv()
+	if err != nil {
+		panic(err)
+	}
+	envelope.Default, err = envelope.FromEnv()
+	if err != nil {
+		panic(err)
+	}
+	if envelope.Default == nil {
+		log.Println("FILE_ENCRYPTION_DISABLED is set, new files are stored unencrypted")
+	}
+	reloadKeyringOnHangup()
+	if os.Getenv("OIDC_ISSUER_URL") != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), constants.LongTimeout)
+		oidc.Default, err = oidc.Discover(ctx, oidc.ConfigFromEnv(), nil)
+		cancel()
+		if err != nil {
+			log.Println("OIDC sign-in disabled:", err)
+		}
+	}
+
 	IP := os.Getenv("IP")
 	PORT := os.Getenv("PORT")
 	serverConfig := fmt.Sprintf("%s:%s", IP, PORT)
@@ -30,6 +84,43 @@ func main() {
 		fmt.Println("Error => ", err)
 	}
 	orms.DatabaseConnection = db
+	if *grantAdmin != "" {
+		if err := grantAdminRole(*grantAdmin); err != nil {
+			panic(err)
+		}
+		fmt.Println("Granted admin role to", *grantAdmin)
+		return
+	}
+	if *migrateFileData {
+		moved, err := jobs.MigrateFileData(context.Background())
+		if err != nil {
+			panic(fmt.Errorf("moved %d files to the blob store before failing: %w", moved, err))
+		}
+		fmt.Println("Moved", moved, "files to the blob store")
+		if envelope.Default != nil {
+			encrypted, err := jobs.EncryptStoredFiles(context.Background())
+			if err != nil {
+				panic(fmt.Errorf("encrypted %d stored files before failing: %w", encrypted, err))
+			}
+			fmt.Println("Encrypted", encrypted, "files stored in plain")
+			encrypted, err = jobs.EncryptTotpSecrets(context.Background())
+			if err != nil {
+				panic(fmt.Errorf("encrypted %d TOTP secrets before failing: %w", encrypted, err))
+			}
+			fmt.Println("Encrypted", encrypted, "TOTP secrets stored in plain")
+		}
+		return
+	}
+	go jobs.RunAccountDeletion(context.Background(), time.Minute*10)
+	go jobs.RunBlobDeletion(context.Background(), time.Minute)
+	go jobs.RunUploadExpiration(context.Background(), time.Minute*15)
+	go jobs.RunUploadAssembly(context.Background(), time.Minute)
+	go jobs.RunVersionRetention(context.Background(), time.Hour)
+	go jobs.RunRecordCleanup(context.Background(), time.Hour)
+	go mailer.Background.Run(context.Background(), 2)
+	if os.Getenv("LOGIN_THROTTLE_STORE") == "postgres" {
+		throttle.Default = throttle.NewLimiter(throttle.NewPostgresStore(db), throttle.NewPostgresRateStore(db))
+	}
 	dbConn, err := db.DB()
 	if err != nil {
 		panic(err)
@@ -40,3 +131,36 @@ func main() {
 		panic(serverRunErr)
 	}
 }
+
+// reloadKeyringOnHangup picks up keys rotated by another process so that the
+// new key is used for signing without a restart.
+func reloadKeyringOnHangup() {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			if err := utils.ReloadKeyring(); err != nil {
+				log.Println("Could not reload signing keys:", err)
+				continue
+			}
+			if current, err := utils.CurrentKeyring(); err == nil {
+				log.Println("Reloaded signing keys, active:", current.Active().Kid)
+			}
+		}
+	}()
+}
+
+// grantAdminRole bootstraps the first admin, since only admins can assign
+// roles through the API.
+func grantAdminRole(email string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+	defer cancel()
+	user, err := orms.GetUserByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return fmt.Errorf("no user with email %s", email)
+	}
+	return orms.SetUserRole(ctx, nil, user.Id, constants.RoleAdmin, "")
+}
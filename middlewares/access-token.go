@@ -0,0 +1,90 @@
+package middlewares
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/db/orms"
+	"github.com/subashshakya/SFSS/models"
+	"github.com/subashshakya/SFSS/utils"
+)
+
+// CheckAccessToken accepts a session JWT or a personal access token. Routes
+// behind it must say which scope they need with RequireScope.
+func CheckAccessToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := utils.ExtractToken(c)
+		if !utils.IsPersonalAccessToken(tokenString) {
+			if authenticateSessionToken(c) {
+				c.Next()
+			}
+			return
+		}
+		principal, err := resolveAccessTokenPrincipal(c, tokenString)
+		if err != nil {
+			log.Println("Invalid access token:", err)
+			c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+			c.Abort()
+			return
+		}
+		utils.SetPrincipal(c, principal)
+		c.Next()
+	}
+}
+
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := utils.GetPrincipal(c)
+		if !ok {
+			log.Println(constants.Unauthorized)
+			c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+			c.Abort()
+			return
+		}
+		if !principal.HasScope(scope) {
+			log.Println("Access token is missing scope", scope)
+			c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.InsufficientScope})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func resolveAccessTokenPrincipal(c *gin.Context, tokenString string) (*models.Principal, error) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), constants.ShortTimeout)
+	defer cancel()
+	token, err := orms.GetActivePersonalAccessToken(ctx, utils.HashOpaqueToken(tokenString))
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, utils.ErrTokenRevoked
+	}
+	user, err := orms.GetUser(ctx, token.UserId)
+	if err != nil {
+		return nil, err
+	}
+	if user.DisabledAt.Valid {
+		return nil, utils.ErrTokenRevoked
+	}
+	if user.TokensRevokedAt.Valid && !token.CreatedAt.After(user.TokensRevokedAt.Time) {
+		return nil, utils.ErrTokenRevoked
+	}
+	if err := orms.TouchPersonalAccessToken(ctx, token.Id); err != nil {
+		log.Println("Could not update access token activity:", err)
+	}
+	return &models.Principal{
+		UserId:        user.Id,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		Role:          user.Role,
+		AccessTokenId: token.Id,
+		Scopes:        token.Scopes,
+		FileIds:       token.FileIds,
+		SecretIds:     token.SecretIds,
+	}, nil
+}
@@ -0,0 +1,143 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/db/dbtest"
+	"github.com/subashshakya/SFSS/db/orms"
+	"github.com/subashshakya/SFSS/models"
+	"github.com/subashshakya/SFSS/utils"
+)
+
+func get(router *gin.Engine, target string, token string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, target, nil)
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestRequireScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router := gin.New()
+	router.GET("/anonymous", RequireScope(constants.ScopeFilesRead), ok)
+	router.GET("/read", func(c *gin.Context) {
+		utils.SetPrincipal(c, &models.Principal{UserId: 1, AccessTokenId: 1, Scopes: []string{constants.ScopeFilesRead}})
+	}, RequireScope(constants.ScopeFilesRead), ok)
+	router.GET("/write", func(c *gin.Context) {
+		utils.SetPrincipal(c, &models.Principal{UserId: 1, AccessTokenId: 1, Scopes: []string{constants.ScopeFilesRead}})
+	}, RequireScope(constants.ScopeFilesWrite), ok)
+
+	for target, want := range map[string]int{
+		"/anonymous": http.StatusUnauthorized,
+		"/read":      http.StatusOK,
+		"/write":     http.StatusForbidden,
+	} {
+		if got := get(router, target, "").Code; got != want {
+			t.Errorf("GET %s = %d, want %d", target, got, want)
+		}
+	}
+}
+
+func TestCheckAccessTokenAppliesTokenRestrictions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := dbtest.Open(t, &models.User{}, &models.PersonalAccessToken{})
+	previous := orms.DatabaseConnection
+	orms.DatabaseConnection = db
+	t.Cleanup(func() { orms.DatabaseConnection = previous })
+
+	user := models.User{FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com", Password: "x", PhoneNumber: "0"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	createToken := func(expiresAt *time.Time) string {
+		t.Helper()
+		token, tokenHash, err := utils.GeneratePersonalAccessToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		accessToken := models.PersonalAccessToken{
+			UserId:    user.Id,
+			Name:      "ci",
+			TokenHash: tokenHash,
+			Scopes:    models.StringList{constants.ScopeFilesRead},
+			FileIds:   models.StringList{"file-a"},
+			ExpiresAt: expiresAt,
+		}
+		if err := orms.CreatePersonalAccessToken(context.Background(), &accessToken); err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	token := createToken(nil)
+	expired := time.Now().Add(-time.Minute)
+	expiredToken := createToken(&expired)
+
+	router := gin.New()
+	router.Use(CheckAccessToken())
+	files := func(c *gin.Context) {
+		principal, _ := utils.GetPrincipal(c)
+		if !principal.CanAccessFile(c.Param("id")) {
+			c.Status(http.StatusForbidden)
+			return
+		}
+		c.Status(http.StatusOK)
+	}
+	router.GET("/files/:id", RequireScope(constants.ScopeFilesRead), files)
+	router.GET("/secrets/:id", RequireScope(constants.ScopeSecretsRead), files)
+
+	tests := []struct {
+		target string
+		token  string
+		want   int
+	}{
+		{"/files/file-a", token, http.StatusOK},
+		{"/files/file-b", token, http.StatusForbidden},
+		{"/secrets/file-a", token, http.StatusForbidden},
+		{"/files/file-a", expiredToken, http.StatusUnauthorized},
+		{"/files/file-a", "sfss_pat_unknown", http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		if got := get(router, test.target, test.token).Code; got != test.want {
+			t.Errorf("GET %s = %d, want %d", test.target, got, test.want)
+		}
+	}
+
+	var accessToken models.PersonalAccessToken
+	db.First(&accessToken, "token_hash = ?", utils.HashOpaqueToken(token))
+	if revoked, err := orms.RevokePersonalAccessToken(context.Background(), user.Id, accessToken.Id); err != nil || !revoked {
+		t.Fatalf("RevokePersonalAccessToken = %v, %v", revoked, err)
+	}
+	if got := get(router, "/files/file-a", token).Code; got != http.StatusUnauthorized {
+		t.Errorf("revoked token answered %d, want 401", got)
+	}
+}
+
+func TestPrincipalResourceRestrictions(t *testing.T) {
+	session := models.Principal{UserId: 1}
+	unrestricted := models.Principal{UserId: 1, AccessTokenId: 1}
+	restricted := models.Principal{UserId: 1, AccessTokenId: 1, FileIds: []string{"file-a"}, SecretIds: []string{"secret-a"}}
+	for _, principal := range []models.Principal{session, unrestricted} {
+		if !principal.CanAccessFile("file-b") || !principal.CanAccessSecret("secret-b") || !principal.CanCreateFiles() || !principal.CanCreateSecrets() {
+			t.Errorf("%+v is restricted", principal)
+		}
+	}
+	if !restricted.CanAccessFile("file-a") || restricted.CanAccessFile("file-b") {
+		t.Error("file list not applied")
+	}
+	if !restricted.CanAccessSecret("secret-a") || restricted.CanAccessSecret("secret-b") {
+		t.Error("secret list not applied")
+	}
+	if restricted.CanCreateFiles() || restricted.CanCreateSecrets() {
+		t.Error("a token limited to listed resources can create new ones")
+	}
+}
@@ -0,0 +1,31 @@
+package middlewares
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/utils"
+)
+
+// RequirePermission only lets callers whose role grants permission through.
+// It must run after CheckInvalidToken.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := utils.GetPrincipal(c)
+		if !ok {
+			log.Println(constants.Unauthorized)
+			c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+			c.Abort()
+			return
+		}
+		if !utils.RoleHasPermission(principal.Role, permission) {
+			log.Println("Role", principal.Role, "is missing permission", permission)
+			c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.Forbidden})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,43 @@
+package middlewares
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/models"
+	"github.com/subashshakya/SFSS/utils"
+)
+
+func TestRequirePermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/:role/:permission", func(c *gin.Context) {
+		if role := c.Param("role"); role != "anonymous" {
+			utils.SetPrincipal(c, &models.Principal{UserId: 1, Role: role})
+		}
+		RequirePermission(c.Param("permission"))(c)
+	}, func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		role       string
+		permission string
+		want       int
+	}{
+		{"anonymous", constants.PermissionUsersRead, http.StatusUnauthorized},
+		{constants.RoleUser, constants.PermissionUsersRead, http.StatusForbidden},
+		{constants.RoleAuditor, constants.PermissionUsersRead, http.StatusOK},
+		{constants.RoleAuditor, constants.PermissionAuditRead, http.StatusOK},
+		{constants.RoleAuditor, constants.PermissionUsersManage, http.StatusForbidden},
+		{constants.RoleAuditor, constants.PermissionRolesManage, http.StatusForbidden},
+		{constants.RoleAdmin, constants.PermissionUsersManage, http.StatusOK},
+		{constants.RoleAdmin, constants.PermissionRolesManage, http.StatusOK},
+		{"superuser", constants.PermissionUsersRead, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		if got := get(router, "/"+test.role+"/"+test.permission, "").Code; got != test.want {
+			t.Errorf("%s asking for %s = %d, want %d", test.role, test.permission, got, test.want)
+		}
+	}
+}
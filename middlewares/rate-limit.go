@@ -0,0 +1,44 @@
+package middlewares
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/throttle"
+	"github.com/subashshakya/SFSS/utils"
+)
+
+// RateLimit limits each caller to the policy for the named endpoint. Callers
+// are keyed by user when a principal is set and by client IP otherwise, so it
+// should run after the token check.
+func RateLimit(name string, policy throttle.RatePolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := name + ":ip:" + c.ClientIP()
+		if principal, ok := utils.GetPrincipal(c); ok {
+			key = fmt.Sprintf("%s:user:%d", name, principal.UserId)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), constants.ShortTimeout)
+		defer cancel()
+		retryAfter, err := throttle.Default.Allow(ctx, key, policy)
+		if err != nil {
+			log.Println("Could not check rate limit:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": constants.InternalServerError})
+			c.Abort()
+			return
+		}
+		if retryAfter > 0 {
+			log.Println("Rate limit hit for", key)
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{"success": false, "message": constants.TooManyRequests})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,43 @@
+package middlewares
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/subashshakya/SFSS/models"
+	"github.com/subashshakya/SFSS/throttle"
+	"github.com/subashshakya/SFSS/utils"
+)
+
+func TestRateLimitCountsPerUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	previous := throttle.Default
+	throttle.Default = throttle.NewLimiter(throttle.NewMemoryStore(), throttle.NewMemoryRateStore())
+	t.Cleanup(func() { throttle.Default = previous })
+
+	policy := throttle.RatePolicy{Limit: 2, Window: time.Minute}
+	router := gin.New()
+	router.GET("/directory/:user", func(c *gin.Context) {
+		userId, _ := strconv.Atoi(c.Param("user"))
+		utils.SetPrincipal(c, &models.Principal{UserId: uint(userId)})
+	}, RateLimit("directory", policy), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for i := 0; i < 2; i++ {
+		if got := get(router, "/directory/1", "").Code; got != http.StatusOK {
+			t.Fatalf("request %d = %d", i, got)
+		}
+	}
+	limited := get(router, "/directory/1", "")
+	if limited.Code != http.StatusTooManyRequests {
+		t.Fatalf("third request = %d, want 429", limited.Code)
+	}
+	if retryAfter, _ := strconv.Atoi(limited.Header().Get("Retry-After")); retryAfter < 1 || retryAfter > 60 {
+		t.Errorf("Retry-After = %q", limited.Header().Get("Retry-After"))
+	}
+	if got := get(router, "/directory/2", "").Code; got != http.StatusOK {
+		t.Errorf("another user was limited: %d", got)
+	}
+}
@@ -1,11 +1,15 @@
 package middlewares
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/db/orms"
+	"github.com/subashshakya/SFSS/models"
 	"github.com/subashshakya/SFSS/utils"
 )
 
@@ -13,19 +17,69 @@ func CheckInvalidToken() gin.HandlerFunc {
 	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
 
 	return func(c *gin.Context) {
-		if isTokenValid := checkInvalidToken(c); !isTokenValid {
-			log.Println("Invalid token")
-			c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
-			c.Abort()
-			return
+		if authenticateSessionToken(c) {
+			c.Next()
 		}
-		c.Next()
 	}
 }
 
+func authenticateSessionToken(c *gin.Context) bool {
+	if isTokenValid := checkInvalidToken(c); !isTokenValid {
+		log.Println("Invalid token")
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		c.Abort()
+		return false
+	}
+	principal, err := resolvePrincipal(c)
+	if err != nil {
+		log.Println("Could not resolve principal:", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+		c.Abort()
+		return false
+	}
+	utils.SetPrincipal(c, principal)
+	return true
+}
+
 func checkInvalidToken(c *gin.Context) bool {
 	if err := utils.TokenValid(c); err != nil {
 		return false
 	}
 	return true
 }
+
+func resolvePrincipal(c *gin.Context) (*models.Principal, error) {
+	claims, err := utils.ExtractTokenClaims(c)
+	if err != nil {
+		return nil, err
+	}
+	userId, err := claims.UserId()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), constants.ShortTimeout)
+	defer cancel()
+	user, err := orms.GetUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if user.DisabledAt.Valid {
+		return nil, utils.ErrTokenRevoked
+	}
+	// iat only has second precision, so a token issued in the same second as
+	// the revocation, like the pair from the reset that caused it, stays valid
+	if user.TokensRevokedAt.Valid && claims.IssuedAt.Before(user.TokensRevokedAt.Time.Truncate(time.Second)) {
+		return nil, utils.ErrTokenRevoked
+	}
+	session, err := orms.GetActiveSession(ctx, claims.SessionId)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil || session.UserId != user.Id {
+		return nil, utils.ErrTokenRevoked
+	}
+	if err := orms.TouchSession(ctx, claims.SessionId, c.ClientIP()); err != nil {
+		log.Println("Could not update session activity:", err)
+	}
+	return &models.Principal{UserId: user.Id, Email: user.Email, EmailVerified: user.EmailVerifiedAt.Valid, TokenId: claims.ID, SessionId: claims.SessionId, Role: user.Role, Scopes: claims.Scopes}, nil
+}
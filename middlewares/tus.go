@@ -0,0 +1,25 @@
+package middlewares
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/subashshakya/SFSS/constants"
+)
+
+// TusResumable rejects requests for another version of the tus protocol and
+// marks every response with the version served. OPTIONS requests are exempt
+// because clients use them to discover the version.
+func TusResumable() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header(constants.HeaderTusResumable, constants.TusVersion)
+		if c.Request.Method != http.MethodOptions && c.GetHeader(constants.HeaderTusResumable) != constants.TusVersion {
+			log.Println("Unsupported tus version:", c.GetHeader(constants.HeaderTusResumable))
+			c.Header("Tus-Version", constants.TusVersion)
+			c.AbortWithStatus(http.StatusPreconditionFailed)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,30 @@
+package middlewares
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/utils"
+)
+
+// RequireVerifiedEmail must run after CheckInvalidToken.
+func RequireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := utils.GetPrincipal(c)
+		if !ok {
+			log.Println("Principal missing")
+			c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": constants.Unauthorized})
+			c.Abort()
+			return
+		}
+		if !principal.EmailVerified {
+			log.Println("Email not verified for user", principal.UserId)
+			c.JSON(http.StatusForbidden, gin.H{"success": false, "message": constants.EmailNotVerified})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,105 @@
+package models
+
+import "time"
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type EmailVerificationRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required"`
+}
+
+type TotpCodeRequest struct {
+	Code string `json:"code" validate:"required,numeric,len=6"`
+}
+
+type TotpSignInRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required_without=RecoveryCode"`
+	RecoveryCode   string `json:"recovery_code" validate:"required_without=Code"`
+}
+
+type StepUpRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required"`
+}
+
+type CreateAccessTokenRequest struct {
+	Name      string     `json:"name" validate:"required,max=100"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1,dive,oneof=files:read files:write secrets:read secrets:write sharing:read sharing:write"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	FileIds   []string   `json:"file_ids" validate:"dive,uuid"`
+	SecretIds []string   `json:"secret_ids" validate:"dive,uuid"`
+}
+
+// UpdateUserRequest is a profile update. Fields left empty keep their value,
+// a MiddleName of "" clears it. The field names match the User JSON the
+// endpoint has always accepted.
+type UpdateUserRequest struct {
+	FirstName   string
+	MiddleName  *string
+	LastName    string
+	Email       string `validate:"omitempty,email"`
+	PhoneNumber string
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required"`
+}
+
+type UpdateRoleRequest struct {
+	Role string `json:"role" validate:"required,oneof=user auditor admin"`
+}
+
+// Principal is the authenticated caller. AccessTokenId is set when the caller
+// used a personal access token, whose scopes and resource lists then limit
+// what it can do. An empty FileIds or SecretIds list means no restriction.
+type Principal struct {
+	UserId        uint
+	Email         string
+	EmailVerified bool
+	TokenId       string
+	SessionId     string
+	Role          string
+	AccessTokenId uint
+	Scopes        []string
+	FileIds       []string
+	SecretIds     []string
+}
+
+// HasScope checks the scopes carried by the session token or personal access
+// token the caller used.
+func (p *Principal) HasScope(scope string) bool {
+	return StringList(p.Scopes).Contains(scope)
+}
+
+func (p *Principal) CanAccessFile(fileId string) bool {
+	return p.AccessTokenId == 0 || len(p.FileIds) == 0 || StringList(p.FileIds).Contains(fileId)
+}
+
+func (p *Principal) CanAccessSecret(secretId string) bool {
+	return p.AccessTokenId == 0 || len(p.SecretIds) == 0 || StringList(p.SecretIds).Contains(secretId)
+}
+
+// CanCreateFiles reports whether the caller may add files. An access token
+// restricted to listed files cannot.
+func (p *Principal) CanCreateFiles() bool {
+	return p.AccessTokenId == 0 || len(p.FileIds) == 0
+}
+
+// CanCreateSecrets reports whether the caller may add secrets. An access
+// token restricted to listed secrets cannot.
+func (p *Principal) CanCreateSecrets() bool {
+	return p.AccessTokenId == 0 || len(p.SecretIds) == 0
+}
@@ -0,0 +1,14 @@
+package models
+
+// DirectoryEntry is the minimal profile the directory reveals. Email is only
+// filled in when the caller searched for that exact address.
+type DirectoryEntry struct {
+	Id        uint   `json:"id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email,omitempty"`
+}
+
+type DirectorySettingsRequest struct {
+	Visibility string `json:"visibility" validate:"required,oneof=everyone organization hidden"`
+}
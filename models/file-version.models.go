@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// FileVersion is one immutable revision of a file's content, linked to the
+// file through its OriginalId. The file keeps its id across versions, so
+// shares and access tokens naming it always follow the current version. A
+// restored version shares its StorageKey with the version it was restored
+// from.
+type FileVersion struct {
+	Id          uint           `gorm:"primaryKey" json:"-"`
+	OriginalId  string         `gorm:"not null;uniqueIndex:idx_file_versions_original_version" json:"-"`
+	Version     int            `gorm:"not null;uniqueIndex:idx_file_versions_original_version" json:"version"`
+	StorageKey  string         `gorm:"not null" json:"-"`
+	ContentType string         `json:"content_type"`
+	SizeBytes   int64          `gorm:"not null" json:"size_bytes"`
+	Sha256      string         `gorm:"column:sha256" json:"sha256"`
+	Encryption  FileEncryption `gorm:"embedded;embeddedPrefix:encryption_" json:"-"`
+	// RestoredFrom is the version this one was restored from.
+	RestoredFrom *int      `json:"restored_from"`
+	Current      bool      `gorm:"-" json:"current"`
+	CreatedAt    time.Time `gorm:"default:current_timestamp" json:"created_at"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// UserPublicKey is a key a user publishes so others can encrypt to them.
+// Ed25519 keys certify themselves; X25519 keys are certified by one of the
+// user's Ed25519 keys, identified by SignedById.
+type UserPublicKey struct {
+	Id          uint       `gorm:"primaryKey" json:"id"`
+	UserId      uint       `gorm:"not null;index" json:"user_id"`
+	Algorithm   string     `gorm:"not null" json:"algorithm"`
+	PublicKey   string     `gorm:"not null" json:"public_key"`
+	Fingerprint string     `gorm:"not null;unique" json:"fingerprint"`
+	Signature   string     `gorm:"not null" json:"signature"`
+	SignedById  *uint      `json:"signed_by_id"`
+	CreatedAt   time.Time  `gorm:"default:current_timestamp" json:"created_at"`
+	RetiredAt   *time.Time `json:"retired_at,omitempty"`
+	User        User       `gorm:"foreignKey:UserId;references:Id" json:"-"`
+}
+
+type RegisterPublicKeyRequest struct {
+	Algorithm  string `json:"algorithm" validate:"required,oneof=x25519 ed25519"`
+	PublicKey  string `json:"public_key" validate:"required,base64"`
+	Signature  string `json:"signature" validate:"required,base64"`
+	SignedById *uint  `json:"signed_by_id" validate:"required_if=Algorithm x25519"`
+}
+
+type RecipientKeys struct {
+	UserId uint            `json:"user_id"`
+	Keys   []UserPublicKey `json:"keys"`
+}
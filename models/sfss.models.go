@@ -2,6 +2,9 @@ package models
 
 import (
 	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -10,29 +13,115 @@ import (
 )
 
 type User struct {
-	Id          uint   `gorm:"primaryKey;autoIncrement"`
-	FirstName   string `gorm:"not null"`
-	MiddleName  sql.NullString
-	LastName    string `gorm:"not null"`
-	Email       string `gorm:"not null;unique"`
-	Password    string `gorm:"not null"`
-	PhoneNumber string `gorm:"not null"`
+	Id                    uint   `gorm:"primaryKey;autoIncrement"`
+	FirstName             string `gorm:"not null"`
+	MiddleName            sql.NullString
+	LastName              string         `gorm:"not null"`
+	Email                 string         `gorm:"not null;unique"`
+	Password              string         `gorm:"not null"`
+	PhoneNumber           string         `gorm:"not null"`
+	TotpSecret            sql.NullString `json:"-"`
+	TotpEnabled           bool           `gorm:"not null;default:false" json:"-"`
+	TotpLastStep          int64          `gorm:"not null;default:0" json:"-"`
+	EmailVerifiedAt       sql.NullTime   `json:"-"`
+	TokensRevokedAt       sql.NullTime   `json:"-"`
+	Role                  string         `gorm:"not null;default:user" json:"-"`
+	DisabledAt            sql.NullTime   `json:"-"`
+	PasswordResetRequired bool           `gorm:"not null;default:false" json:"-"`
+	DeletionRequestedAt   sql.NullTime   `json:"-"`
+	DeletionScheduledAt   sql.NullTime   `json:"-"`
+	DirectoryVisibility   string         `gorm:"not null;default:everyone" json:"-"`
 }
 
+// SecureFile is the metadata of a file. Its content is in the blob store
+// under StorageKey and is also the FileVersion numbered Version.
 type SecureFile struct {
-	Id         string    `gorm:"primaryKey"`
-	FileName   string    `gorm:"not null"`
-	FileData   []byte    `gorm:"not null"`
-	OriginalId uint      `gorm:"not null"`
+	Id          string `gorm:"primaryKey"`
+	FileName    string `gorm:"not null"`
+	StorageKey  string `json:"-"`
+	ContentType string
+	SizeBytes   int64          `gorm:"not null;default:0"`
+	Sha256      string         `gorm:"column:sha256"`
+	Encryption  FileEncryption `gorm:"embedded;embeddedPrefix:encryption_" json:"-"`
+	Version     int            `gorm:"not null;default:1"`
+	// OriginalId is the id of the file the version history started from.
+	// Every FileVersion of the file is linked to it.
+	OriginalId string    `gorm:"not null;index"`
 	CreatedAt  time.Time `gorm:"default:current_timestamp"`
 	UserId     int       `gorm:"not null"`
+	TeamId     *uint     `gorm:"index"`
 	User       User      `gorm:"foreignKey:UserId;references:Id"`
 }
 
+// FileEncryption describes how stored content is encrypted. All fields are
+// empty for content stored in plain.
+type FileEncryption struct {
+	// Algorithm encrypts the content with the per-file data key.
+	Algorithm string
+	// KeyAlgorithm wraps the data key with the master key KeyId.
+	KeyAlgorithm string
+	KeyId        string
+	WrappedKey   string
+}
+
+// FileMetadata is a SecureFile without its content.
+type FileMetadata struct {
+	Id          string    `json:"id"`
+	FileName    string    `json:"file_name"`
+	ContentType string    `json:"content_type"`
+	SizeBytes   int64     `json:"size_bytes"`
+	Sha256      string    `json:"sha256"`
+	Version     int       `json:"version"`
+	TeamId      *uint     `json:"team_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (sf *SecureFile) Metadata() FileMetadata {
+	return FileMetadata{
+		Id:          sf.Id,
+		FileName:    sf.FileName,
+		ContentType: sf.ContentType,
+		SizeBytes:   sf.SizeBytes,
+		Sha256:      sf.Sha256,
+		Version:     sf.Version,
+		TeamId:      sf.TeamId,
+		CreatedAt:   sf.CreatedAt,
+	}
+}
+
+// SecureFileRequest creates or updates a file with content sent inline in
+// the JSON body. FileData is left out of an update that only renames. Id
+// names the file to update and is ignored on create, where the server picks
+// the id.
+type SecureFileRequest struct {
+	Id       string
+	FileName string `validate:"required"`
+	FileData []byte
+	TeamId   *uint
+}
+
+// InlineFileData is content still kept in the database from before files
+// moved to the blob store.
+type InlineFileData struct {
+	Id       string
+	FileData []byte
+}
+
+// BlobDeletion is stored content that is no longer referenced and is
+// waiting to be removed from the blob store.
+type BlobDeletion struct {
+	Id         uint      `gorm:"primaryKey"`
+	StorageKey string    `gorm:"not null"`
+	CreatedAt  time.Time `gorm:"default:current_timestamp"`
+}
+
 func (sf *SecureFile) BeforeCreate(tx *gorm.DB) (err error) {
 	if sf.Id == "" {
 		sf.Id = uuid.New().String()
 	}
+	if sf.OriginalId == "" {
+		sf.OriginalId = sf.Id
+	}
 	return
 }
 
@@ -40,8 +129,9 @@ type SuperSecret struct {
 	Id        string `gorm:"primaryKey"`
 	Secret    string `gorm:"not null"`
 	CreatedAt time.Time
-	UserId    uint `gorm:"not null"`
-	User      User `gorm:"foreignKey:UserId;references:Id"`
+	UserId    uint  `gorm:"not null"`
+	TeamId    *uint `gorm:"index"`
+	User      User  `gorm:"foreignKey:UserId;references:Id"`
 }
 
 func (ss *SuperSecret) BeforeCreate(tx *gorm.DB) (err error) {
@@ -52,25 +142,27 @@ func (ss *SuperSecret) BeforeCreate(tx *gorm.DB) (err error) {
 }
 
 type FileSharing struct {
-	Id          uint       `gorm:"primaryKey"`
-	FileId      string     `gorm:"not null"`
-	SenderId    uint       `gorm:"not null"`
-	RecipientId uint       `gorm:"not null"`
-	SharedAt    time.Time  `gorm:"default:current_timestamp"`
-	File        SecureFile `gorm:"foreignKey:FileId;references:Id"`
-	Sender      User       `gorm:"foreignKey:SenderId;references:Id"`
-	Recipient   User       `gorm:"foreignKey:RecipientId;references:Id"`
+	Id             uint       `gorm:"primaryKey"`
+	FileId         string     `gorm:"not null"`
+	SenderId       uint       `gorm:"not null"`
+	RecipientId    uint       `gorm:"not null"`
+	RecipientEmail string     `gorm:"-" validate:"omitempty,email"`
+	SharedAt       time.Time  `gorm:"default:current_timestamp"`
+	File           SecureFile `gorm:"foreignKey:FileId;references:Id"`
+	Sender         User       `gorm:"foreignKey:SenderId;references:Id"`
+	Recipient      User       `gorm:"foreignKey:RecipientId;references:Id"`
 }
 
 type SecretSharing struct {
-	Id          uint        `gorm:"primaryKey"`
-	SecretId    string      `gorm:"not null"`
-	SenderId    uint        `gorm:"not null"`
-	RecipientId uint        `gorm:"not null"`
-	SharedAt    time.Time   `gorm:"default:current_timestamp"`
-	Secret      SuperSecret `gorm:"foreignKey:SecretId;references:Id"`
-	Sender      User        `gorm:"foreignKey:SenderId;references:Id"`
-	Recipient   User        `gorm:"foreignKey:RecipientId;references:Id"`
+	Id             uint        `gorm:"primaryKey"`
+	SecretId       string      `gorm:"not null"`
+	SenderId       uint        `gorm:"not null"`
+	RecipientId    uint        `gorm:"not null"`
+	RecipientEmail string      `gorm:"-" validate:"omitempty,email"`
+	SharedAt       time.Time   `gorm:"default:current_timestamp"`
+	Secret         SuperSecret `gorm:"foreignKey:SecretId;references:Id"`
+	Sender         User        `gorm:"foreignKey:SenderId;references:Id"`
+	Recipient      User        `gorm:"foreignKey:RecipientId;references:Id"`
 }
 
 type SecretFileCount struct {
@@ -82,3 +174,199 @@ type SecretPasswordCount struct {
 	Id     uint `gorm:"primaryKey"`
 	UserId uint `gorm:"not null"`
 }
+
+type RefreshToken struct {
+	Id         uint      `gorm:"primaryKey"`
+	UserId     uint      `gorm:"not null;index"`
+	FamilyId   string    `gorm:"not null;index"`
+	TokenHash  string    `gorm:"not null;unique"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	RevokedAt  *time.Time
+	ReplacedBy *uint
+	CreatedAt  time.Time `gorm:"default:current_timestamp"`
+	User       User      `gorm:"foreignKey:UserId;references:Id"`
+}
+
+type RevokedAccessToken struct {
+	Jti       string    `gorm:"primaryKey"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	RevokedAt time.Time `gorm:"default:current_timestamp"`
+}
+
+// UsedStepUpCode marks the code of a sign-in step-up as spent so the
+// challenge cannot be confirmed twice before it expires.
+type UsedStepUpCode struct {
+	CodeHash  string    `gorm:"primaryKey"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	UsedAt    time.Time `gorm:"default:current_timestamp"`
+}
+
+type RecoveryCode struct {
+	Id        uint   `gorm:"primaryKey"`
+	UserId    uint   `gorm:"not null;index"`
+	CodeHash  string `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time `gorm:"default:current_timestamp"`
+	User      User      `gorm:"foreignKey:UserId;references:Id"`
+}
+
+type PasswordResetToken struct {
+	Id        uint      `gorm:"primaryKey"`
+	UserId    uint      `gorm:"not null;index"`
+	TokenHash string    `gorm:"not null;unique"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time `gorm:"default:current_timestamp"`
+	User      User      `gorm:"foreignKey:UserId;references:Id"`
+}
+
+type LoginAttemptCounter struct {
+	Key           string    `gorm:"primaryKey"`
+	Failures      int       `gorm:"not null;default:0"`
+	LastFailureAt time.Time `gorm:"not null"`
+	LockedUntil   time.Time `gorm:"not null"`
+}
+
+// RateLimitCounter counts requests of one caller to a rate limited endpoint
+// in the window ending at WindowEndsAt.
+type RateLimitCounter struct {
+	Key          string    `gorm:"primaryKey"`
+	Count        int       `gorm:"not null;default:0"`
+	WindowEndsAt time.Time `gorm:"not null"`
+}
+
+type LoginLockoutEvent struct {
+	Id          uint   `gorm:"primaryKey"`
+	Email       string `gorm:"not null"`
+	IpAddress   string `gorm:"not null"`
+	Scope       string `gorm:"not null"`
+	LockedUntil time.Time
+	CreatedAt   time.Time `gorm:"default:current_timestamp"`
+}
+
+type Session struct {
+	Id         string `gorm:"primaryKey"`
+	UserId     uint   `gorm:"not null;index"`
+	DeviceName string
+	UserAgent  string
+	IpAddress  string
+	CreatedAt  time.Time `gorm:"default:current_timestamp"`
+	LastSeenAt time.Time `gorm:"not null"`
+	RevokedAt  *time.Time
+	User       User `gorm:"foreignKey:UserId;references:Id" json:"-"`
+}
+
+func (s *Session) BeforeCreate(tx *gorm.DB) (err error) {
+	if s.Id == "" {
+		s.Id = uuid.New().String()
+	}
+	return
+}
+
+type UserIdentity struct {
+	Id        uint   `gorm:"primaryKey"`
+	UserId    uint   `gorm:"not null;index"`
+	Issuer    string `gorm:"not null;uniqueIndex:idx_user_identities_issuer_subject"`
+	Subject   string `gorm:"not null;uniqueIndex:idx_user_identities_issuer_subject"`
+	Email     string
+	CreatedAt time.Time `gorm:"default:current_timestamp"`
+	User      User      `gorm:"foreignKey:UserId;references:Id"`
+}
+
+// StringList is stored as a comma separated text column.
+type StringList []string
+
+func (l StringList) Value() (driver.Value, error) {
+	return strings.Join(l, ","), nil
+}
+
+func (l *StringList) Scan(value interface{}) error {
+	var raw string
+	switch v := value.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into StringList", value)
+	}
+	if raw == "" {
+		*l = nil
+		return nil
+	}
+	*l = strings.Split(raw, ",")
+	return nil
+}
+
+func (l StringList) Contains(value string) bool {
+	for _, item := range l {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+type PersonalAccessToken struct {
+	Id         uint       `gorm:"primaryKey" json:"id"`
+	UserId     uint       `gorm:"not null;index" json:"-"`
+	Name       string     `gorm:"not null" json:"name"`
+	TokenHash  string     `gorm:"not null;unique" json:"-"`
+	Scopes     StringList `gorm:"type:text;not null" json:"scopes"`
+	FileIds    StringList `gorm:"type:text" json:"file_ids"`
+	SecretIds  StringList `gorm:"type:text" json:"secret_ids"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"-"`
+	CreatedAt  time.Time  `gorm:"default:current_timestamp" json:"created_at"`
+	User       User       `gorm:"foreignKey:UserId;references:Id" json:"-"`
+}
+
+type AuditLog struct {
+	Id           uint      `gorm:"primaryKey" json:"id"`
+	ActorId      *uint     `json:"actor_id"`
+	Action       string    `gorm:"not null" json:"action"`
+	TargetUserId *uint     `json:"target_user_id"`
+	Details      string    `json:"details"`
+	IpAddress    string    `json:"ip_address"`
+	CreatedAt    time.Time `gorm:"default:current_timestamp" json:"created_at"`
+}
+
+type StorageStats struct {
+	Users         int64 `json:"users"`
+	DisabledUsers int64 `json:"disabled_users"`
+	Files         int64 `json:"files"`
+	FileBytes     int64 `json:"file_bytes"`
+	Secrets       int64 `json:"secrets"`
+	FileShares    int64 `json:"file_shares"`
+	SecretShares  int64 `json:"secret_shares"`
+}
+
+// LoginAttempt is one sign-in attempt. UserId is nil when the email did not
+// match an account.
+type LoginAttempt struct {
+	Id        uint      `gorm:"primaryKey" json:"id"`
+	UserId    *uint     `gorm:"index" json:"-"`
+	Email     string    `gorm:"not null" json:"-"`
+	Method    string    `gorm:"not null" json:"method"`
+	Outcome   string    `gorm:"not null" json:"outcome"`
+	IpAddress string    `json:"ip_address"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `gorm:"default:current_timestamp;index" json:"created_at"`
+}
+
+// AccountTombstone is what remains of a purged account. The email is kept
+// only as a hash.
+type AccountTombstone struct {
+	Id                  uint      `gorm:"primaryKey"`
+	UserId              uint      `gorm:"not null;unique"`
+	EmailHash           string    `gorm:"not null"`
+	DeletionRequestedAt time.Time `gorm:"not null"`
+	PurgedAt            time.Time `gorm:"not null"`
+	FilesDeleted        int64     `gorm:"not null;default:0"`
+	SecretsDeleted      int64     `gorm:"not null;default:0"`
+	SharesDeleted       int64     `gorm:"not null;default:0"`
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+type Organization struct {
+	Id        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"not null" json:"name" validate:"required,max=100"`
+	CreatedAt time.Time `gorm:"default:current_timestamp" json:"created_at"`
+}
+
+type OrganizationMember struct {
+	Id             uint      `gorm:"primaryKey"`
+	OrganizationId uint      `gorm:"not null;uniqueIndex:idx_organization_members_org_user"`
+	UserId         uint      `gorm:"not null;uniqueIndex:idx_organization_members_org_user"`
+	Role           string    `gorm:"not null"`
+	CreatedAt      time.Time `gorm:"default:current_timestamp"`
+}
+
+type Team struct {
+	Id             uint      `gorm:"primaryKey" json:"id"`
+	OrganizationId uint      `gorm:"not null;index" json:"organization_id"`
+	Name           string    `gorm:"not null" json:"name" validate:"required,max=100"`
+	CreatedAt      time.Time `gorm:"default:current_timestamp" json:"created_at"`
+}
+
+type TeamMember struct {
+	Id        uint      `gorm:"primaryKey"`
+	TeamId    uint      `gorm:"not null;uniqueIndex:idx_team_members_team_user"`
+	UserId    uint      `gorm:"not null;uniqueIndex:idx_team_members_team_user"`
+	Role      string    `gorm:"not null"`
+	CreatedAt time.Time `gorm:"default:current_timestamp"`
+}
+
+// MemberView is a membership row joined with the public part of the user.
+type MemberView struct {
+	UserId    uint   `json:"user_id"`
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Role      string `json:"role"`
+}
+
+type MemberRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	Role  string `json:"role" validate:"required,oneof=owner admin member"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// FileUpload is a resumable upload. Chunks are stored as FileUploadParts
+// until Offset reaches Length, then a background job assembles the upload
+// into the file FileId. HashState is the SHA-256 of the chunks received so
+// far. AssemblingUntil is set while a job is assembling the upload.
+type FileUpload struct {
+	Id              string `gorm:"primaryKey"`
+	UserId          uint   `gorm:"not null;index"`
+	TeamId          *uint
+	FileName        string `gorm:"not null"`
+	ContentType     string
+	Length          int64 `gorm:"column:upload_length;not null"`
+	Offset          int64 `gorm:"column:upload_offset;not null;default:0"`
+	HashState       []byte
+	FileId          *string
+	AssemblingUntil *time.Time
+	ExpiresAt       time.Time `gorm:"not null;index"`
+	CreatedAt       time.Time `gorm:"default:current_timestamp"`
+	User            User      `gorm:"foreignKey:UserId;references:Id"`
+}
+
+// FileUploadPart is one chunk of a FileUpload, starting at Offset.
+type FileUploadPart struct {
+	Id         uint           `gorm:"primaryKey"`
+	UploadId   string         `gorm:"not null;index"`
+	Offset     int64          `gorm:"column:start_offset;not null"`
+	SizeBytes  int64          `gorm:"not null"`
+	StorageKey string         `gorm:"not null"`
+	Encryption FileEncryption `gorm:"embedded;embeddedPrefix:encryption_"`
+}
@@ -0,0 +1,55 @@
+// Package notifier tells users about security events on their account.
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/subashshakya/SFSS/mailer"
+)
+
+const KindNewSignIn = "new_sign_in"
+
+type Notification struct {
+	Kind       string
+	UserId     uint
+	Email      string
+	FirstName  string
+	IpAddress  string
+	UserAgent  string
+	OccurredAt time.Time
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, notification Notification) error
+}
+
+var Default Notifier = MailNotifier{}
+
+// MailNotifier emails the notification to the account's address through
+// mailer.Default.
+type MailNotifier struct{}
+
+func (MailNotifier) Notify(ctx context.Context, notification Notification) error {
+	switch notification.Kind {
+	case KindNewSignIn:
+		return mailer.Default.Send(ctx, mailer.Message{
+			To:      notification.Email,
+			Subject: "New sign-in to your SFSS account",
+			Body: fmt.Sprintf("Hi %s,\n\nYour account was signed in to from a device we have not seen before.\n\nTime: %s\nIP address: %s\nBrowser: %s\n\nIf this was not you, change your password and sign out your other sessions.\n",
+				notification.FirstName, notification.OccurredAt.UTC().Format(time.RFC1123), notification.IpAddress, notification.UserAgent),
+		})
+	default:
+		return fmt.Errorf("unknown notification kind %q", notification.Kind)
+	}
+}
+
+// LogNotifier only logs notifications, for setups without a mailer.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, notification Notification) error {
+	log.Printf("Security notification %s for user %d from %s", notification.Kind, notification.UserId, notification.IpAddress)
+	return nil
+}
@@ -0,0 +1,278 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+const jwksRefreshInterval = time.Minute
+
+var ErrNotConfigured = errors.New("OIDC provider is not configured")
+
+type Config struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+func ConfigFromEnv() Config {
+	scopes := []string{"openid", "email", "profile"}
+	if raw := os.Getenv("OIDC_SCOPES"); raw != "" {
+		scopes = strings.Fields(raw)
+	}
+	return Config{
+		IssuerURL:    os.Getenv("OIDC_ISSUER_URL"),
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:       scopes,
+	}
+}
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+// Provider talks to one OpenID Connect identity provider. Its signing keys are
+// fetched from the discovered jwks_uri and refreshed when an unknown kid shows
+// up.
+type Provider struct {
+	config     Config
+	metadata   metadata
+	httpClient *http.Client
+
+	mu          sync.RWMutex
+	keys        map[string]interface{}
+	lastRefresh time.Time
+}
+
+var Default *Provider
+
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	IDToken     string `json:"id_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+type IDTokenClaims struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+	Name          string
+}
+
+// Discover loads the provider metadata from the issuer's well-known document.
+func Discover(ctx context.Context, config Config, httpClient *http.Client) (*Provider, error) {
+	if config.IssuerURL == "" || config.ClientID == "" {
+		return nil, ErrNotConfigured
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: time.Second * 10}
+	}
+	discoveryURL := strings.TrimSuffix(config.IssuerURL, "/") + "/.well-known/openid-configuration"
+	var meta metadata
+	if err := getJSON(ctx, httpClient, discoveryURL, &meta); err != nil {
+		return nil, err
+	}
+	if meta.Issuer != config.IssuerURL {
+		return nil, fmt.Errorf("issuer mismatch: discovered %q, configured %q", meta.Issuer, config.IssuerURL)
+	}
+	provider := &Provider{config: config, metadata: meta, httpClient: httpClient, keys: map[string]interface{}{}}
+	if err := provider.refreshKeys(ctx); err != nil {
+		return nil, err
+	}
+	return provider, nil
+}
+
+func (p *Provider) AuthCodeURL(state string, nonce string, codeChallenge string) string {
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", p.config.RedirectURL)
+	query.Set("scope", strings.Join(p.config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	separator := "?"
+	if strings.Contains(p.metadata.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.metadata.AuthorizationEndpoint + separator + query.Encode()
+}
+
+func (p *Provider) Exchange(ctx context.Context, code string, codeVerifier string) (*TokenResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+	form.Set("client_id", p.config.ClientID)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, p.metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+	response, err := p.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned %s", response.Status)
+	}
+	var tokens TokenResponse
+	if err := json.NewDecoder(response.Body).Decode(&tokens); err != nil {
+		return nil, err
+	}
+	if tokens.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+	return &tokens, nil
+}
+
+// VerifyIDToken checks the signature against the provider JWKS and validates
+// iss, aud, azp, exp, iat and nonce.
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken string, nonce string) (*IDTokenClaims, error) {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "EdDSA"}),
+		jwt.WithIssuer(p.metadata.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	token, err := parser.Parse(rawIDToken, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("id token claims are invalid")
+	}
+	if audiences, isList := claims["aud"].([]interface{}); isList && len(audiences) > 1 && claims["azp"] != p.config.ClientID {
+		return nil, errors.New("id token authorized party mismatch")
+	}
+	if _, hasIssuedAt := claims["iat"]; !hasIssuedAt {
+		return nil, errors.New("id token has no issued at")
+	}
+	if claims["nonce"] != nonce {
+		return nil, errors.New("id token nonce mismatch")
+	}
+	idClaims := &IDTokenClaims{Issuer: p.metadata.Issuer}
+	idClaims.Subject, _ = claims["sub"].(string)
+	idClaims.Email, _ = claims["email"].(string)
+	idClaims.EmailVerified, _ = claims["email_verified"].(bool)
+	idClaims.GivenName, _ = claims["given_name"].(string)
+	idClaims.FamilyName, _ = claims["family_name"].(string)
+	idClaims.Name, _ = claims["name"].(string)
+	if idClaims.Subject == "" {
+		return nil, errors.New("id token has no subject")
+	}
+	return idClaims, nil
+}
+
+func (p *Provider) key(ctx context.Context, kid string) (interface{}, error) {
+	p.mu.RLock()
+	key, ok := p.keys[kid]
+	canRefresh := time.Since(p.lastRefresh) > jwksRefreshInterval
+	p.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+	if canRefresh {
+		if err := p.refreshKeys(ctx); err != nil {
+			return nil, err
+		}
+		p.mu.RLock()
+		key, ok = p.keys[kid]
+		p.mu.RUnlock()
+		if ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (p *Provider) refreshKeys(ctx context.Context) error {
+	var set jsonWebKeySet
+	if err := getJSON(ctx, p.httpClient, p.metadata.JwksURI, &set); err != nil {
+		return err
+	}
+	keys := map[string]interface{}{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		publicKey, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = publicKey
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys = keys
+	p.lastRefresh = time.Now()
+	return nil
+}
+
+func getJSON(ctx context.Context, httpClient *http.Client, target string, into interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", target, response.Status)
+	}
+	return json.NewDecoder(response.Body).Decode(into)
+}
+
+// RandomString returns a URL-safe random value for state, nonce and the PKCE
+// code verifier.
+func RandomString() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func CodeChallengeS256(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,137 @@
+package oidc_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/subashshakya/SFSS/oidc"
+	"github.com/subashshakya/SFSS/oidc/oidctest"
+)
+
+const clientID = "sfss-test"
+const redirectURL = "https://sfss.example.com/user/oidc/callback"
+
+var ada = oidctest.User{Subject: "ada-1", Email: "ada@example.com", EmailVerified: true, GivenName: "Ada", FamilyName: "Lovelace"}
+
+func newProvider(t *testing.T) (*oidctest.Server, *oidc.Provider) {
+	t.Helper()
+	server, err := oidctest.NewServer(clientID, ada)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	provider, err := oidc.Discover(context.Background(), oidc.Config{
+		IssuerURL:   server.URL,
+		ClientID:    clientID,
+		RedirectURL: redirectURL,
+		Scopes:      []string{"openid", "email"},
+	}, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, provider
+}
+
+// authorize follows the authorization URL the way a browser would and
+// returns the query the provider redirected back with.
+func authorize(t *testing.T, server *oidctest.Server, authorizationURL string) url.Values {
+	t.Helper()
+	client := server.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	response, err := client.Get(authorizationURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusFound {
+		t.Fatalf("authorize returned %s", response.Status)
+	}
+	location, err := url.Parse(response.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location.Query()
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	server, provider := newProvider(t)
+	verifier, _ := oidc.RandomString()
+	callback := authorize(t, server, provider.AuthCodeURL("the-state", "the-nonce", oidc.CodeChallengeS256(verifier)))
+	if callback.Get("state") != "the-state" {
+		t.Errorf("state = %q", callback.Get("state"))
+	}
+
+	tokens, err := provider.Exchange(context.Background(), callback.Get("code"), verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := provider.VerifyIDToken(context.Background(), tokens.IDToken, "the-nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := oidc.IDTokenClaims{Issuer: server.URL, Subject: ada.Subject, Email: ada.Email, EmailVerified: true, GivenName: ada.GivenName, FamilyName: ada.FamilyName}
+	if *claims != want {
+		t.Errorf("claims = %+v, want %+v", *claims, want)
+	}
+}
+
+func TestExchangeRejectsWrongCodeVerifier(t *testing.T) {
+	server, provider := newProvider(t)
+	verifier, _ := oidc.RandomString()
+	callback := authorize(t, server, provider.AuthCodeURL("state", "nonce", oidc.CodeChallengeS256(verifier)))
+	if _, err := provider.Exchange(context.Background(), callback.Get("code"), verifier+"x"); err == nil {
+		t.Fatal("Exchange() accepted a code verifier that does not match the challenge")
+	}
+}
+
+func TestExchangeRejectsReusedCode(t *testing.T) {
+	server, provider := newProvider(t)
+	verifier, _ := oidc.RandomString()
+	callback := authorize(t, server, provider.AuthCodeURL("state", "nonce", oidc.CodeChallengeS256(verifier)))
+	if _, err := provider.Exchange(context.Background(), callback.Get("code"), verifier); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.Exchange(context.Background(), callback.Get("code"), verifier); err == nil {
+		t.Fatal("Exchange() accepted a code twice")
+	}
+}
+
+func TestVerifyIDTokenRejectsWrongNonce(t *testing.T) {
+	server, provider := newProvider(t)
+	verifier, _ := oidc.RandomString()
+	callback := authorize(t, server, provider.AuthCodeURL("state", "the-nonce", oidc.CodeChallengeS256(verifier)))
+	tokens, err := provider.Exchange(context.Background(), callback.Get("code"), verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.VerifyIDToken(context.Background(), tokens.IDToken, "another-nonce"); err == nil {
+		t.Fatal("VerifyIDToken() accepted a token with another nonce")
+	}
+}
+
+func TestVerifyIDTokenRejectsOtherAudience(t *testing.T) {
+	server, provider := newProvider(t)
+	other, err := oidc.Discover(context.Background(), oidc.Config{IssuerURL: server.URL, ClientID: "other-client", RedirectURL: redirectURL}, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, _ := oidc.RandomString()
+	callback := authorize(t, server, provider.AuthCodeURL("state", "nonce", oidc.CodeChallengeS256(verifier)))
+	tokens, err := provider.Exchange(context.Background(), callback.Get("code"), verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.VerifyIDToken(context.Background(), tokens.IDToken, "nonce"); err == nil {
+		t.Fatal("VerifyIDToken() accepted a token issued to another client")
+	}
+}
+
+func TestDiscoverRejectsIssuerMismatch(t *testing.T) {
+	server, _ := newProvider(t)
+	_, err := oidc.Discover(context.Background(), oidc.Config{IssuerURL: server.URL + "/", ClientID: clientID}, server.Client())
+	if err == nil {
+		t.Fatal("Discover() accepted metadata for another issuer")
+	}
+}
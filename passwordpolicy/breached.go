@@ -0,0 +1,107 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const hashPrefixLength = 5
+
+type BreachChecker interface {
+	IsBreached(password string) (bool, error)
+}
+
+// PrefixDirectory looks passwords up in a local copy of a k-anonymity breach
+// corpus: one file per five character SHA-1 prefix, named PREFIX or
+// PREFIX.txt, holding SUFFIX:COUNT lines. Only the file for the password's
+// prefix is read. A prefix without a file counts as not breached so a partial
+// corpus can be used.
+type PrefixDirectory struct {
+	Dir string
+}
+
+func (d PrefixDirectory) IsBreached(password string) (bool, error) {
+	prefix, suffix := splitPasswordHash(password)
+	file, err := d.open(prefix)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	return rangeContains(file, suffix)
+}
+
+func (d PrefixDirectory) open(prefix string) (*os.File, error) {
+	file, err := os.Open(filepath.Join(d.Dir, prefix+".txt"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return os.Open(filepath.Join(d.Dir, prefix))
+	}
+	return file, err
+}
+
+// RangeAPI asks a k-anonymity range service in the format of Pwned
+// Passwords, GET BaseURL/range/PREFIX, for the suffixes of a prefix. It is
+// for deployments that prefer an online lookup or a self-hosted mirror to a
+// local corpus. Responses are padded so their size does not hint at the
+// prefix.
+type RangeAPI struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+func (a RangeAPI) IsBreached(password string) (bool, error) {
+	prefix, suffix := splitPasswordHash(password)
+	client := a.Client
+	if client == nil {
+		client = &http.Client{Timeout: time.Second * 5}
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, strings.TrimSuffix(a.BaseURL, "/")+"/range/"+prefix, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Add-Padding", "true")
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("breached password range lookup returned %d", resp.StatusCode)
+	}
+	return rangeContains(resp.Body, suffix)
+}
+
+// splitPasswordHash returns the upper case hex SHA-1 of password split into
+// the prefix that is looked up and the suffix that is searched for.
+func splitPasswordHash(password string) (string, string) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	return hash[:hashPrefixLength], hash[hashPrefixLength:]
+}
+
+// rangeContains reads SUFFIX:COUNT lines and reports whether suffix is listed
+// with a non-zero count. Padding entries have a count of zero.
+func rangeContains(r io.Reader, suffix string) (bool, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		candidate, count, _ := strings.Cut(line, ":")
+		if strings.EqualFold(candidate, suffix) {
+			return strings.TrimSpace(count) != "0", nil
+		}
+	}
+	return false, scanner.Err()
+}
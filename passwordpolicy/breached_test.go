@@ -0,0 +1,103 @@
+package passwordpolicy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// "password" hashes to 5BAA6 1E4C9B93F3F0682250B6CF8331B7EE68FD8.
+const breachedPassword = "password"
+const breachedPrefix = "5BAA6"
+const breachedSuffix = "1E4C9B93F3F0682250B6CF8331B7EE68FD8"
+
+func TestRangeContains(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     bool
+	}{
+		{name: "listed", response: "0018A45C4D1DEF81644B54AB7F969B88D65:1\r\n" + breachedSuffix + ":9545824\r\n", want: true},
+		{name: "lower case", response: strings.ToLower(breachedSuffix) + ":3\n", want: true},
+		{name: "padding entry", response: breachedSuffix + ":0\n", want: false},
+		{name: "not listed", response: "0018A45C4D1DEF81644B54AB7F969B88D65:1\n", want: false},
+		{name: "empty", response: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rangeContains(strings.NewReader(tt.response), breachedSuffix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("rangeContains = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRangeAPI(t *testing.T) {
+	var gotPath, gotPadding string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotPadding = r.URL.Path, r.Header.Get("Add-Padding")
+		if r.URL.Path != "/range/"+breachedPrefix {
+			w.Write([]byte("0018A45C4D1DEF81644B54AB7F969B88D65:0\r\n"))
+			return
+		}
+		w.Write([]byte("0018A45C4D1DEF81644B54AB7F969B88D65:0\r\n" + breachedSuffix + ":9545824\r\n"))
+	}))
+	defer server.Close()
+	api := RangeAPI{BaseURL: server.URL + "/", Client: server.Client()}
+
+	breached, err := api.IsBreached(breachedPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !breached {
+		t.Errorf("IsBreached(%q) = false, want true", breachedPassword)
+	}
+	if gotPath != "/range/"+breachedPrefix {
+		t.Errorf("requested %q, want only the prefix", gotPath)
+	}
+	if gotPadding != "true" {
+		t.Errorf("Add-Padding = %q, want true", gotPadding)
+	}
+
+	breached, err = api.IsBreached("x7#Kq9!vLm2$Rz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if breached {
+		t.Error("IsBreached of an unlisted password = true, want false")
+	}
+}
+
+func TestRangeAPIErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	if _, err := (RangeAPI{BaseURL: server.URL, Client: server.Client()}).IsBreached(breachedPassword); err == nil {
+		t.Error("IsBreached on a failing service returned no error")
+	}
+}
+
+func TestPrefixDirectory(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, breachedPrefix+".txt"), []byte(breachedSuffix+":3\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	directory := PrefixDirectory{Dir: dir}
+	for password, want := range map[string]bool{breachedPassword: true, "x7#Kq9!vLm2$Rz": false} {
+		got, err := directory.IsBreached(password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("IsBreached(%q) = %v, want %v", password, got, want)
+		}
+	}
+}
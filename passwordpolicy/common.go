@@ -0,0 +1,25 @@
+package passwordpolicy
+
+// commonPasswords is ranked most common first. It backs the dictionary part of
+// the strength estimate; the breach corpus is the exhaustive check.
+var commonPasswords = []string{
+	"123456", "password", "12345678", "qwerty", "123456789", "12345", "1234", "111111",
+	"1234567", "dragon", "123123", "baseball", "abc123", "football", "monkey", "letmein",
+	"696969", "shadow", "master", "666666", "qwertyuiop", "123321", "mustang", "1234567890",
+	"michael", "654321", "superman", "1qaz2wsx", "7777777", "121212", "000000", "qazwsx",
+	"123qwe", "killer", "trustno1", "jordan", "jennifer", "zxcvbnm", "asdfgh", "hunter",
+	"buster", "soccer", "harley", "batman", "andrew", "tigger", "sunshine", "iloveyou",
+	"2000", "charlie", "robert", "thomas", "hockey", "ranger", "daniel", "starwars",
+	"klaster", "112233", "george", "computer", "michelle", "jessica", "pepper", "1111",
+	"zxcvbn", "555555", "11111111", "131313", "freedom", "777777", "pass", "maggie",
+	"159753", "aaaaaa", "ginger", "princess", "joshua", "cheese", "amanda", "summer",
+	"love", "ashley", "nicole", "chelsea", "biteme", "matthew", "access", "yankees",
+	"987654321", "dallas", "austin", "thunder", "taylor", "matrix", "mobilemail", "mom",
+	"monitor", "monitoring", "montana", "moon", "moscow", "welcome", "admin", "login",
+	"passw0rd", "password1", "qwerty123", "secret", "winter", "spring", "autumn", "flower",
+	"hello", "whatever", "dragon1", "baseball1", "football1", "princess1", "azerty", "solo",
+	"loveme", "starwars1", "qwe123", "zaq1zaq1", "changeme", "default", "guest", "root",
+	"administrator", "letmein1", "p@ssw0rd", "welcome1", "monkey1", "sunshine1", "master1",
+	"abcdef", "abcd1234", "asdfghjkl", "q1w2e3r4", "1q2w3e4r", "qwertyui", "iloveyou1",
+	"secure", "security", "file", "files", "share", "sharing", "sfss", "company",
+}
@@ -0,0 +1,83 @@
+// Package passwordpolicy decides whether a new password is acceptable: long
+// enough, hard enough to guess and not part of a known breach.
+package passwordpolicy
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"unicode/utf8"
+)
+
+const RuleMinLength = "min_length"
+const RuleMaxLength = "max_length"
+const RuleStrength = "strength"
+const RuleBreached = "breached"
+
+const defaultMinLength = 12
+const defaultMaxLength = 128
+const defaultMinScore = 3
+
+// Violation names a failed rule with a message that can be shown to the user.
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+type Policy struct {
+	MinLength int
+	MaxLength int
+	// MinScore is the lowest accepted Estimate score, from 0 to 4.
+	MinScore int
+	// Breached is consulted last and may be nil to skip the breach check.
+	Breached BreachChecker
+}
+
+var Default = &Policy{MinLength: defaultMinLength, MaxLength: defaultMaxLength, MinScore: defaultMinScore}
+
+// FromEnv reads PASSWORD_MIN_LENGTH, PASSWORD_MIN_SCORE,
+// BREACHED_PASSWORDS_DIR and BREACHED_PASSWORDS_URL. The local directory wins
+// when both are set; without either the breach check is off.
+func FromEnv() *Policy {
+	policy := &Policy{MinLength: defaultMinLength, MaxLength: defaultMaxLength, MinScore: defaultMinScore}
+	if minLength, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_LENGTH")); err == nil && minLength > 0 {
+		policy.MinLength = minLength
+	}
+	if minScore, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_SCORE")); err == nil && minScore >= 0 && minScore <= 4 {
+		policy.MinScore = minScore
+	}
+	if dir := os.Getenv("BREACHED_PASSWORDS_DIR"); dir != "" {
+		policy.Breached = PrefixDirectory{Dir: dir}
+	} else if baseURL := os.Getenv("BREACHED_PASSWORDS_URL"); baseURL != "" {
+		policy.Breached = RangeAPI{BaseURL: baseURL}
+	}
+	return policy
+}
+
+// Check returns every rule the password fails. userInputs are words tied to
+// the account, such as the email and names, that make a password easier to
+// guess. A non-nil error means the breach corpus could not be read.
+func (p *Policy) Check(password string, userInputs ...string) ([]Violation, error) {
+	violations := []Violation{}
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, Violation{Rule: RuleMinLength, Message: fmt.Sprintf("Password must be at least %d characters long", p.MinLength)})
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, Violation{Rule: RuleMaxLength, Message: fmt.Sprintf("Password must be at most %d characters long", p.MaxLength)})
+		return violations, nil
+	}
+	if estimate := Estimate(password, userInputs...); estimate.Score < p.MinScore {
+		violations = append(violations, Violation{Rule: RuleStrength, Message: fmt.Sprintf("Password is too easy to guess (strength %d of 4, at least %d required)", estimate.Score, p.MinScore)})
+	}
+	if p.Breached != nil {
+		breached, err := p.Breached.IsBreached(password)
+		if err != nil {
+			return violations, err
+		}
+		if breached {
+			violations = append(violations, Violation{Rule: RuleBreached, Message: "Password has appeared in a data breach and cannot be used"})
+		}
+	}
+	return violations, nil
+}
@@ -0,0 +1,59 @@
+package passwordpolicy
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type fakeBreachChecker struct {
+	breached map[string]bool
+	err      error
+}
+
+func (f fakeBreachChecker) IsBreached(password string) (bool, error) {
+	return f.breached[password], f.err
+}
+
+func violatedRules(violations []Violation) []string {
+	rules := []string{}
+	for _, violation := range violations {
+		rules = append(rules, violation.Rule)
+	}
+	return rules
+}
+
+func TestPolicyCheck(t *testing.T) {
+	policy := &Policy{MinLength: 12, MaxLength: 64, MinScore: 3, Breached: fakeBreachChecker{breached: map[string]bool{"gT5v-wq9z-Lm3c-8Pxa": true}}}
+	tests := []struct {
+		name       string
+		password   string
+		userInputs []string
+		want       []string
+	}{
+		{name: "strong", password: "x7#Kq9!vLm2$Rz", want: []string{}},
+		{name: "short and weak", password: "password", want: []string{RuleMinLength, RuleStrength}},
+		{name: "long but guessable", password: "qwertyuiopasdf", want: []string{RuleStrength}},
+		{name: "built from the account", password: "johnsmith1987", userInputs: []string{"john", "smith"}, want: []string{RuleStrength}},
+		{name: "breached", password: "gT5v-wq9z-Lm3c-8Pxa", want: []string{RuleBreached}},
+		{name: "too long", password: strings.Repeat("x7#Kq9!vLm2$Rz", 5), want: []string{RuleMaxLength}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations, err := policy.Check(tt.password, tt.userInputs...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := violatedRules(violations); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Check(%q) failed %v, want %v", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyCheckBreachError(t *testing.T) {
+	policy := &Policy{MinLength: 12, MinScore: 3, Breached: fakeBreachChecker{err: errors.New("corpus unreadable")}}
+	if _, err := policy.Check("x7#Kq9!vLm2$Rz"); err == nil {
+		t.Error("Check returned no error when the breach corpus failed")
+	}
+}
@@ -0,0 +1,401 @@
+package passwordpolicy
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// The estimate follows zxcvbn: find guessable patterns (dictionary words, l33t
+// and reversed variants, sequences, repeats, keyboard runs and dates), then
+// pick the cover of the password with the fewest guesses, treating whatever
+// is left as brute force. It is deliberately smaller than zxcvbn; the score
+// bands are the same.
+
+const bruteforceCardinality = 10
+const minSubmatchGuesses = 50
+const minSingleCharGuesses = 10
+const maxEstimatedLength = 256
+const minYearSpace = 20
+
+type Result struct {
+	Guesses float64
+	Score   int
+}
+
+type match struct {
+	start, end int
+	guesses    float64
+}
+
+var l33tTable = map[rune]rune{
+	'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '1': 'i', '!': 'i',
+	'|': 'l', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z',
+}
+
+var keyboardRows = []string{"`1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", "zxcvbnm,./"}
+
+var rankedCommonPasswords = rankedDictionary(commonPasswords)
+
+// Estimate scores password from 0 (trivial) to 4 (strong).
+func Estimate(password string, userInputs ...string) Result {
+	runes := []rune(password)
+	if len(runes) == 0 {
+		return Result{Guesses: 1, Score: 0}
+	}
+	if len(runes) > maxEstimatedLength {
+		return Result{Guesses: math.Inf(1), Score: 4}
+	}
+	estimator := estimator{dictionaries: []map[string]int{rankedCommonPasswords, userInputDictionary(userInputs)}, memo: map[string]float64{}}
+	guesses := estimator.guesses(runes)
+	return Result{Guesses: guesses, Score: scoreFor(guesses)}
+}
+
+func scoreFor(guesses float64) int {
+	switch {
+	case guesses < 1e3+5:
+		return 0
+	case guesses < 1e6+5:
+		return 1
+	case guesses < 1e8+5:
+		return 2
+	case guesses < 1e10+5:
+		return 3
+	default:
+		return 4
+	}
+}
+
+type estimator struct {
+	dictionaries []map[string]int
+	memo         map[string]float64
+}
+
+// guesses finds the cheapest cover. Each prefix keeps the product of its
+// segment guesses and the segment count; the total is multiplied by the
+// factorial of the count since an attacker also has to guess the order.
+func (e *estimator) guesses(runes []rune) float64 {
+	key := string(runes)
+	if guesses, ok := e.memo[key]; ok {
+		return guesses
+	}
+	n := len(runes)
+	matches := e.matches(runes)
+	byEnd := make([][]match, n)
+	for _, m := range matches {
+		byEnd[m.end] = append(byEnd[m.end], m)
+	}
+	product := make([]float64, n+1)
+	segments := make([]int, n+1)
+	product[0] = 1
+	for end := 1; end <= n; end++ {
+		product[end] = math.Inf(1)
+		consider := func(start int, guesses float64) {
+			candidate := product[start] * guesses
+			count := segments[start] + 1
+			if candidate*factorial(count) < product[end]*factorial(segments[end]) {
+				product[end], segments[end] = candidate, count
+			}
+		}
+		for start := 0; start < end; start++ {
+			consider(start, bruteforceGuesses(end-start))
+		}
+		for _, m := range byEnd[end-1] {
+			consider(m.start, m.guesses)
+		}
+	}
+	guesses := product[n] * factorial(segments[n])
+	e.memo[key] = guesses
+	return guesses
+}
+
+func (e *estimator) matches(runes []rune) []match {
+	var matches []match
+	matches = append(matches, e.dictionaryMatches(runes)...)
+	matches = append(matches, sequenceMatches(runes)...)
+	matches = append(matches, e.repeatMatches(runes)...)
+	matches = append(matches, keyboardMatches(runes)...)
+	matches = append(matches, dateMatches(runes)...)
+	return matches
+}
+
+func (e *estimator) dictionaryMatches(runes []rune) []match {
+	var matches []match
+	lower := []rune(strings.ToLower(string(runes)))
+	if len(lower) != len(runes) {
+		return nil
+	}
+	unl33t := make([]rune, len(lower))
+	for i, r := range lower {
+		if plain, ok := l33tTable[r]; ok {
+			unl33t[i] = plain
+		} else {
+			unl33t[i] = r
+		}
+	}
+	for start := 0; start < len(runes); start++ {
+		for end := start + 2; end < len(runes); end++ {
+			word := string(lower[start : end+1])
+			plain := string(unl33t[start : end+1])
+			reversed := reverse(word)
+			for _, dictionary := range e.dictionaries {
+				rank, found := dictionary[word]
+				variations := 1.0
+				if !found {
+					rank, found = dictionary[reversed]
+					variations = 2
+				}
+				if !found && plain != word {
+					rank, found = dictionary[plain]
+					variations = l33tVariations(lower[start:end+1], unl33t[start:end+1])
+				}
+				if !found {
+					continue
+				}
+				guesses := float64(rank) * variations * uppercaseVariations(runes[start:end+1])
+				matches = append(matches, match{start: start, end: end, guesses: math.Max(guesses, minSubmatchGuesses)})
+			}
+		}
+	}
+	return matches
+}
+
+// sequenceMatches finds runs like abc, 9753 or ZYX with a constant step.
+func sequenceMatches(runes []rune) []match {
+	var matches []match
+	start := 0
+	for start < len(runes)-2 {
+		delta := runes[start+1] - runes[start]
+		end := start + 1
+		if delta != 0 && abs(delta) <= 5 && sameClass(runes[start], runes[end]) {
+			for end+1 < len(runes) && runes[end+1]-runes[end] == delta && sameClass(runes[end], runes[end+1]) {
+				end++
+			}
+		}
+		if end-start >= 2 {
+			matches = append(matches, match{start: start, end: end, guesses: sequenceGuesses(runes[start], end-start+1, delta)})
+			start = end
+			continue
+		}
+		start++
+	}
+	return matches
+}
+
+func sequenceGuesses(first rune, length int, delta rune) float64 {
+	base := 26.0
+	switch {
+	case strings.ContainsRune("aAzZ019", first):
+		base = 4
+	case unicode.IsDigit(first):
+		base = 10
+	}
+	if delta < 0 {
+		base *= 2
+	}
+	return math.Max(base*float64(length), minSubmatchGuesses)
+}
+
+// repeatMatches finds a block repeated back to back, like aaa or abcabc.
+func (e *estimator) repeatMatches(runes []rune) []match {
+	var matches []match
+	for start := 0; start < len(runes); start++ {
+		for baseLength := 1; start+baseLength*2 <= len(runes); baseLength++ {
+			count := 1
+			for start+baseLength*(count+1) <= len(runes) && string(runes[start+baseLength*count:start+baseLength*(count+1)]) == string(runes[start:start+baseLength]) {
+				count++
+			}
+			if count < 2 || (baseLength == 1 && count < 3) {
+				continue
+			}
+			base := e.guesses(runes[start : start+baseLength])
+			matches = append(matches, match{start: start, end: start + baseLength*count - 1, guesses: math.Max(base*float64(count), minSubmatchGuesses)})
+		}
+	}
+	return matches
+}
+
+// keyboardMatches finds four or more neighbouring keys along one row.
+func keyboardMatches(runes []rune) []match {
+	var matches []match
+	lower := []rune(strings.ToLower(string(runes)))
+	if len(lower) != len(runes) {
+		return nil
+	}
+	for start := 0; start < len(lower)-3; start++ {
+		for _, row := range keyboardRows {
+			position := strings.IndexRune(row, lower[start])
+			if position < 0 {
+				continue
+			}
+			for _, step := range []int{1, -1} {
+				end := start
+				next := position
+				for end+1 < len(lower) {
+					next += step
+					if next < 0 || next >= len(row) || rune(row[next]) != lower[end+1] {
+						break
+					}
+					end++
+				}
+				if length := end - start + 1; length >= 4 {
+					guesses := float64(len(row)) * 2 * float64(length) * uppercaseVariations(runes[start:end+1])
+					matches = append(matches, match{start: start, end: end, guesses: math.Max(guesses, minSubmatchGuesses)})
+				}
+			}
+		}
+	}
+	return matches
+}
+
+// dateMatches finds years from 1900 to 2099 and eight digit dates in
+// ddmmyyyy, mmddyyyy or yyyymmdd order.
+func dateMatches(runes []rune) []match {
+	var matches []match
+	currentYear := time.Now().Year()
+	for start := 0; start+4 <= len(runes); start++ {
+		if year, ok := digitsValue(runes[start : start+4]); ok && year >= 1900 && year <= 2099 {
+			matches = append(matches, match{start: start, end: start + 3, guesses: math.Max(yearSpace(year, currentYear), minSubmatchGuesses)})
+		}
+		if start+8 > len(runes) {
+			continue
+		}
+		digits := string(runes[start : start+8])
+		if _, ok := digitsValue(runes[start : start+8]); !ok {
+			continue
+		}
+		for _, layout := range []string{"02012006", "01022006", "20060102"} {
+			if date, err := time.Parse(layout, digits); err == nil && date.Year() >= 1900 && date.Year() <= 2099 {
+				matches = append(matches, match{start: start, end: start + 7, guesses: 365 * yearSpace(date.Year(), currentYear)})
+				break
+			}
+		}
+	}
+	return matches
+}
+
+func yearSpace(year int, currentYear int) float64 {
+	return math.Max(math.Abs(float64(year-currentYear)), minYearSpace)
+}
+
+func digitsValue(runes []rune) (int, bool) {
+	for _, r := range runes {
+		if r < '0' || r > '9' {
+			return 0, false
+		}
+	}
+	value, err := strconv.Atoi(string(runes))
+	return value, err == nil
+}
+
+func bruteforceGuesses(length int) float64 {
+	guesses := math.Pow(bruteforceCardinality, float64(length))
+	if length == 1 {
+		return math.Max(guesses+1, minSingleCharGuesses+1)
+	}
+	return math.Max(guesses, minSubmatchGuesses+1)
+}
+
+// uppercaseVariations counts the ways the word's letters could have been
+// capitalised, with the common all-caps and capitalised forms counted as two.
+func uppercaseVariations(word []rune) float64 {
+	upper, lower := 0, 0
+	for _, r := range word {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		}
+	}
+	if upper == 0 {
+		return 1
+	}
+	if lower == 0 || (upper == 1 && (unicode.IsUpper(word[0]) || unicode.IsUpper(word[len(word)-1]))) {
+		return 2
+	}
+	variations := 0.0
+	for i := 1; i <= upper && i <= lower; i++ {
+		variations += binomial(upper+lower, i)
+	}
+	return variations
+}
+
+func l33tVariations(word []rune, plain []rune) float64 {
+	substituted := 0
+	for i := range word {
+		if word[i] != plain[i] {
+			substituted++
+		}
+	}
+	if substituted > 8 {
+		substituted = 8
+	}
+	return math.Pow(2, float64(substituted))
+}
+
+func rankedDictionary(words []string) map[string]int {
+	ranked := make(map[string]int, len(words))
+	for i, word := range words {
+		word = strings.ToLower(word)
+		if _, ok := ranked[word]; !ok {
+			ranked[word] = i + 1
+		}
+	}
+	return ranked
+}
+
+// userInputDictionary splits emails and names into words so that, for
+// example, the local part of the user's email is as cheap as a common word.
+func userInputDictionary(inputs []string) map[string]int {
+	var words []string
+	for _, input := range inputs {
+		input = strings.ToLower(input)
+		words = append(words, input)
+		words = append(words, strings.FieldsFunc(input, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })...)
+	}
+	filtered := words[:0]
+	for _, word := range words {
+		if len([]rune(word)) >= 3 {
+			filtered = append(filtered, word)
+		}
+	}
+	return rankedDictionary(filtered)
+}
+
+func sameClass(a rune, b rune) bool {
+	return (unicode.IsLower(a) && unicode.IsLower(b)) || (unicode.IsUpper(a) && unicode.IsUpper(b)) || (unicode.IsDigit(a) && unicode.IsDigit(b))
+}
+
+func reverse(value string) string {
+	runes := []rune(value)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+func abs(value rune) rune {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
+
+func factorial(n int) float64 {
+	result := 1.0
+	for i := 2; i <= n; i++ {
+		result *= float64(i)
+	}
+	return result
+}
+
+func binomial(n int, k int) float64 {
+	result := 1.0
+	for i := 1; i <= k; i++ {
+		result = result * float64(n-k+i) / float64(i)
+	}
+	return result
+}
@@ -0,0 +1,82 @@
+package passwordpolicy
+
+import "testing"
+
+func TestEstimateScoresKnownPasswords(t *testing.T) {
+	tests := []struct {
+		password string
+		maxScore int
+		minScore int
+	}{
+		{password: "", maxScore: 0},
+		{password: "password", maxScore: 0},
+		{password: "123456", maxScore: 0},
+		{password: "qwertyuiop", maxScore: 0},
+		{password: "abcdefghijkl", maxScore: 0},
+		{password: "aaaaaaaaaaaa", maxScore: 0},
+		{password: "P@ssw0rd", maxScore: 0},
+		{password: "Password1!", maxScore: 1},
+		{password: "01011990", maxScore: 1},
+		{password: "iloveyou2024", maxScore: 1},
+		{password: "correct horse battery staple", minScore: 4, maxScore: 4},
+		{password: "x7#Kq9!vLm2$Rz", minScore: 4, maxScore: 4},
+		{password: "gT5v-wq9z-Lm3c-8Pxa", minScore: 4, maxScore: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			result := Estimate(tt.password)
+			if result.Score < tt.minScore || result.Score > tt.maxScore {
+				t.Errorf("Estimate(%q).Score = %d (guesses %g), want %d..%d", tt.password, result.Score, result.Guesses, tt.minScore, tt.maxScore)
+			}
+		})
+	}
+}
+
+func TestEstimatePenalizesUserInputs(t *testing.T) {
+	tests := []struct {
+		password   string
+		userInputs []string
+	}{
+		{password: "johnsmith1987", userInputs: []string{"John", "Smith"}},
+		{password: "smithjohn", userInputs: []string{"john", "smith"}},
+		{password: "jsmith@example.com", userInputs: []string{"jsmith@example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			without := Estimate(tt.password)
+			with := Estimate(tt.password, tt.userInputs...)
+			if with.Score >= without.Score {
+				t.Errorf("score with user inputs %v = %d, want below %d", tt.userInputs, with.Score, without.Score)
+			}
+			if with.Score > 1 {
+				t.Errorf("score with user inputs %v = %d, want at most 1", tt.userInputs, with.Score)
+			}
+		})
+	}
+}
+
+func TestEstimateIgnoresUnrelatedUserInputs(t *testing.T) {
+	password := "x7#Kq9!vLm2$Rz"
+	if got, want := Estimate(password, "alice", "alice@example.com").Score, Estimate(password).Score; got != want {
+		t.Errorf("score with unrelated inputs = %d, want %d", got, want)
+	}
+}
+
+func TestScoreForBands(t *testing.T) {
+	tests := []struct {
+		guesses float64
+		want    int
+	}{
+		{guesses: 1, want: 0},
+		{guesses: 1e3 + 4, want: 0},
+		{guesses: 1e3 + 5, want: 1},
+		{guesses: 1e6 + 5, want: 2},
+		{guesses: 1e8 + 5, want: 3},
+		{guesses: 1e10 + 5, want: 4},
+	}
+	for _, tt := range tests {
+		if got := scoreFor(tt.guesses); got != tt.want {
+			t.Errorf("scoreFor(%g) = %d, want %d", tt.guesses, got, tt.want)
+		}
+	}
+}
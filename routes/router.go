@@ -1,46 +1,136 @@
 package router
 
 import (
+	"github.com/subashshakya/SFSS/constants"
 	"github.com/subashshakya/SFSS/controllers"
 	"github.com/subashshakya/SFSS/middlewares"
+	"github.com/subashshakya/SFSS/throttle"
 
 	"github.com/gin-gonic/gin"
 )
 
 func SetupRoutes(router *gin.Engine) {
+	router.GET("/.well-known/jwks.json", controllers.GetJWKS)
+
 	fileRoutes := router.Group("/files")
 	{
-		fileRoutes.GET("/fetch_all/:id", controllers.GetUserFiles)
-		fileRoutes.PATCH("/update", controllers.UpdateSecureFile)
-		fileRoutes.POST("/create", controllers.MakeSecureFile)
-		fileRoutes.DELETE("/delete", controllers.DeleteFile)
-		fileRoutes.GET("/:id", controllers.GetSecureFileByID)
+		fileRoutes.Use(middlewares.CheckAccessToken())
+		fileRoutes.GET("/fetch_all/:id", middlewares.RequireScope(constants.ScopeFilesRead), controllers.GetUserFiles)
+		fileRoutes.PATCH("/update", middlewares.RequireScope(constants.ScopeFilesWrite), controllers.UpdateSecureFile)
+		fileRoutes.POST("/create", middlewares.RequireScope(constants.ScopeFilesWrite), controllers.MakeSecureFile)
+		fileRoutes.POST("/upload", middlewares.RequireScope(constants.ScopeFilesWrite), controllers.UploadSecureFile)
+		fileRoutes.DELETE("/delete/:id", middlewares.RequireScope(constants.ScopeFilesWrite), controllers.DeleteFile)
+		// the id used to go in the query string
+		fileRoutes.DELETE("/delete", middlewares.RequireScope(constants.ScopeFilesWrite), controllers.DeleteFile)
+		fileRoutes.GET("/:id", middlewares.RequireScope(constants.ScopeFilesRead), controllers.GetSecureFileByID)
+		fileRoutes.GET("/:id/download", middlewares.RequireScope(constants.ScopeFilesRead), controllers.DownloadSecureFile)
+		fileRoutes.HEAD("/:id/download", middlewares.RequireScope(constants.ScopeFilesRead), controllers.DownloadSecureFile)
+		fileRoutes.GET("/:id/versions", middlewares.RequireScope(constants.ScopeFilesRead), controllers.GetFileVersions)
+		fileRoutes.GET("/:id/versions/:version/download", middlewares.RequireScope(constants.ScopeFilesRead), controllers.DownloadFileVersion)
+		fileRoutes.HEAD("/:id/versions/:version/download", middlewares.RequireScope(constants.ScopeFilesRead), controllers.DownloadFileVersion)
+		fileRoutes.POST("/:id/versions/:version/restore", middlewares.RequireScope(constants.ScopeFilesWrite), controllers.RestoreFileVersion)
+	}
+
+	router.OPTIONS("/files/uploads", middlewares.TusResumable(), controllers.GetUploadOptions)
+	uploadRoutes := router.Group("/files/uploads")
+	{
+		uploadRoutes.Use(middlewares.TusResumable(), middlewares.CheckAccessToken(), middlewares.RequireScope(constants.ScopeFilesWrite))
+		uploadRoutes.POST("", controllers.CreateUpload)
+		uploadRoutes.HEAD("/:uploadId", controllers.GetUploadOffset)
+		uploadRoutes.PATCH("/:uploadId", controllers.PatchUpload)
+		uploadRoutes.DELETE("/:uploadId", controllers.DeleteUpload)
 	}
 
 	secretRoutes := router.Group("/secret")
 	{
-		secretRoutes.POST("/create", controllers.CreateSuperSecret)
-		secretRoutes.GET("/:id", controllers.ReadSuperSecret)
-		secretRoutes.PATCH("/update", controllers.UpdatedSuperSecret)
-		secretRoutes.DELETE("/delete", controllers.DeleteSuperSecret)
-		secretRoutes.GET("/fetch_all/:id", controllers.GetSuperSecretsForUser)
+		secretRoutes.Use(middlewares.CheckAccessToken())
+		secretRoutes.POST("/create", middlewares.RequireScope(constants.ScopeSecretsWrite), controllers.CreateSuperSecret)
+		secretRoutes.GET("/:id", middlewares.RequireScope(constants.ScopeSecretsRead), controllers.ReadSuperSecret)
+		secretRoutes.PATCH("/update", middlewares.RequireScope(constants.ScopeSecretsWrite), controllers.UpdatedSuperSecret)
+		secretRoutes.DELETE("/delete/:id", middlewares.RequireScope(constants.ScopeSecretsWrite), controllers.DeleteSuperSecret)
+		secretRoutes.DELETE("/delete", middlewares.RequireScope(constants.ScopeSecretsWrite), controllers.DeleteSuperSecret)
+		secretRoutes.GET("/fetch_all/:id", middlewares.RequireScope(constants.ScopeSecretsRead), controllers.GetSuperSecretsForUser)
 	}
 
 	sharingRoutes := router.Group("/sharing")
 	{
-		sharingRoutes.Use(middlewares.CheckInvalidToken())
-		sharingRoutes.POST("/secure_file", controllers.ShareSecureFile)
-		sharingRoutes.POST("/super_secret", controllers.ShareSuperSecret)
-		sharingRoutes.GET("/files/:id", controllers.GetFileSharedOfAUser)
-		sharingRoutes.GET("/secrets/:id", controllers.GetSecretSharedOfAUser)
+		sharingRoutes.Use(middlewares.CheckAccessToken(), middlewares.RequireVerifiedEmail())
+		sharingRoutes.POST("/secure_file", middlewares.RequireScope(constants.ScopeSharingWrite), controllers.ShareSecureFile)
+		sharingRoutes.POST("/super_secret", middlewares.RequireScope(constants.ScopeSharingWrite), controllers.ShareSuperSecret)
+		sharingRoutes.GET("/files/:id", middlewares.RequireScope(constants.ScopeSharingRead), controllers.GetFileSharedOfAUser)
+		sharingRoutes.GET("/secrets/:id", middlewares.RequireScope(constants.ScopeSharingRead), controllers.GetSecretSharedOfAUser)
+		sharingRoutes.GET("/recipient_keys", middlewares.RequireScope(constants.ScopeSharingRead), middlewares.RateLimit("directory", throttle.DirectorySearchPolicy), controllers.LookupRecipientKeys)
+		sharingRoutes.GET("/directory", middlewares.RequireScope(constants.ScopeSharingRead), middlewares.RateLimit("directory", throttle.DirectorySearchPolicy), controllers.SearchDirectory)
+	}
+
+	organizationRoutes := router.Group("/orgs")
+	{
+		organizationRoutes.Use(middlewares.CheckInvalidToken())
+		organizationRoutes.POST("", controllers.CreateOrganization)
+		organizationRoutes.GET("", controllers.GetOrganizations)
+		organizationRoutes.GET("/:id/members", controllers.GetOrganizationMembers)
+		organizationRoutes.POST("/:id/members", controllers.SetOrganizationMember)
+		organizationRoutes.DELETE("/:id/members/:user_id", controllers.RemoveOrganizationMember)
+		organizationRoutes.POST("/:id/teams", controllers.CreateTeam)
+		organizationRoutes.GET("/:id/teams", controllers.GetOrganizationTeams)
+	}
+
+	teamRoutes := router.Group("/teams")
+	{
+		teamRoutes.Use(middlewares.CheckInvalidToken())
+		teamRoutes.GET("/:id/members", controllers.GetTeamMembers)
+		teamRoutes.POST("/:id/members", controllers.SetTeamMember)
+		teamRoutes.DELETE("/:id/members/:user_id", controllers.RemoveTeamMember)
+		teamRoutes.GET("/:id/files", controllers.GetTeamFiles)
+		teamRoutes.GET("/:id/secrets", controllers.GetTeamSecrets)
+	}
+
+	adminRoutes := router.Group("/admin")
+	{
+		adminRoutes.Use(middlewares.CheckInvalidToken())
+		adminRoutes.GET("/users", middlewares.RequirePermission(constants.PermissionUsersRead), controllers.AdminListUsers)
+		adminRoutes.GET("/users/:id", middlewares.RequirePermission(constants.PermissionUsersRead), controllers.AdminGetUser)
+		adminRoutes.PATCH("/users/:id/role", middlewares.RequirePermission(constants.PermissionRolesManage), controllers.AdminUpdateUserRole)
+		adminRoutes.POST("/users/:id/disable", middlewares.RequirePermission(constants.PermissionUsersManage), controllers.AdminDisableUser)
+		adminRoutes.POST("/users/:id/enable", middlewares.RequirePermission(constants.PermissionUsersManage), controllers.AdminEnableUser)
+		adminRoutes.POST("/users/:id/force_password_reset", middlewares.RequirePermission(constants.PermissionUsersManage), controllers.AdminForcePasswordReset)
+		adminRoutes.GET("/stats", middlewares.RequirePermission(constants.PermissionStatsRead), controllers.AdminGetStorageStats)
+		adminRoutes.GET("/audit_logs", middlewares.RequirePermission(constants.PermissionAuditRead), controllers.AdminGetAuditLogs)
 	}
 
 	userRoutes := router.Group("/user")
 	{
 		userRoutes.POST("/sign_up", controllers.UserSignUp)
 		userRoutes.POST("/sign_in", controllers.UserSignIn)
-		userRoutes.GET("/:id", controllers.GetUser)
-		userRoutes.PATCH("/update", controllers.UpdateUser)
-		userRoutes.DELETE("/delete/:id", controllers.DeleteUser)
+		userRoutes.POST("/sign_in/totp", controllers.UserSignInTotp)
+		userRoutes.POST("/sign_in/step_up", controllers.ConfirmSignInStepUp)
+		userRoutes.GET("/oidc/login", controllers.OIDCLogin)
+		userRoutes.GET("/oidc/callback", controllers.OIDCCallback)
+		userRoutes.POST("/oidc/link", middlewares.CheckInvalidToken(), controllers.LinkOIDCIdentity)
+		userRoutes.POST("/refresh", controllers.RefreshAccessToken)
+		userRoutes.POST("/sign_out", controllers.UserSignOut)
+		userRoutes.POST("/forgot_password", controllers.ForgotPassword)
+		userRoutes.POST("/reset_password", controllers.ResetPassword)
+		userRoutes.GET("/verify_email", controllers.VerifyEmail)
+		userRoutes.POST("/verify_email", controllers.VerifyEmail)
+		userRoutes.POST("/verify_email/resend", middlewares.CheckInvalidToken(), controllers.ResendVerificationEmail)
+		userRoutes.POST("/totp/enroll", middlewares.CheckInvalidToken(), controllers.EnrollTotp)
+		userRoutes.POST("/totp/confirm", middlewares.CheckInvalidToken(), controllers.ConfirmTotp)
+		userRoutes.GET("/sessions", middlewares.CheckInvalidToken(), controllers.GetUserSessions)
+		userRoutes.GET("/login_history", middlewares.CheckInvalidToken(), controllers.GetLoginHistory)
+		userRoutes.DELETE("/sessions", middlewares.CheckInvalidToken(), controllers.RevokeOtherUserSessions)
+		userRoutes.DELETE("/sessions/:id", middlewares.CheckInvalidToken(), controllers.RevokeUserSession)
+		userRoutes.POST("/access_tokens", middlewares.CheckInvalidToken(), controllers.CreateAccessToken)
+		userRoutes.GET("/access_tokens", middlewares.CheckInvalidToken(), controllers.GetAccessTokens)
+		userRoutes.DELETE("/access_tokens/:id", middlewares.CheckInvalidToken(), controllers.RevokeAccessToken)
+		userRoutes.POST("/keys", middlewares.CheckInvalidToken(), controllers.RegisterPublicKey)
+		userRoutes.GET("/keys", middlewares.CheckInvalidToken(), controllers.GetPublicKeys)
+		userRoutes.DELETE("/keys/:id", middlewares.CheckInvalidToken(), controllers.RetirePublicKey)
+		userRoutes.PATCH("/directory_settings", middlewares.CheckInvalidToken(), controllers.UpdateDirectorySettings)
+		userRoutes.GET("/:id", middlewares.CheckInvalidToken(), controllers.GetUser)
+		userRoutes.PATCH("/update", middlewares.CheckInvalidToken(), controllers.UpdateUser)
+		userRoutes.PATCH("/password", middlewares.CheckInvalidToken(), controllers.ChangePassword)
+		userRoutes.DELETE("/delete/:id", middlewares.CheckInvalidToken(), controllers.DeleteUser)
+		userRoutes.POST("/delete/cancel", middlewares.CheckInvalidToken(), controllers.CancelUserDeletion)
 	}
 }
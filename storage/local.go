@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const defaultStorageDir = "data/files"
+
+// LocalStore keeps every object in its own file under Dir. Objects are
+// written to a temporary file and renamed into place, so a reader never sees
+// a partial object.
+type LocalStore struct {
+	Dir string
+}
+
+// Put streams r to the object named key and returns the number of bytes
+// written. Nothing is left behind when r fails part way.
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	written, err := io.Copy(tmp, contextReader{ctx: ctx, r: r})
+	if err != nil {
+		tmp.Close()
+		return written, err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return written, err
+	}
+	if err := tmp.Close(); err != nil {
+		return written, err
+	}
+	return written, os.Rename(tmp.Name(), path)
+}
+
+// Get returns the *os.File, so callers can seek in it.
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return file, err
+}
+
+func (s *LocalStore) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	object, err := s.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	file := object.(*os.File)
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if length < 0 {
+		return file, nil
+	}
+	return limitedReadCloser{Reader: io.LimitReader(file, length), Closer: file}, nil
+}
+
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func (s *LocalStore) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ObjectInfo{}, ErrNotFound
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Key: key, Size: info.Size(), ModifiedAt: info.ModTime()}, nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// path spreads objects over subdirectories named after the first two
+// characters of the key so no single directory grows too large.
+func (s *LocalStore) path(key string) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.Dir, key[:2], key), nil
+}
+
+// contextReader stops a long copy once the request is cancelled.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
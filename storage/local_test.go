@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestLocalStoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store := &LocalStore{Dir: t.TempDir()}
+	written, err := store.Put(ctx, "abc123", strings.NewReader("hello, world"))
+	if err != nil || written != 12 {
+		t.Fatalf("Put = %d, %v", written, err)
+	}
+	if _, err := os.Stat(filepath.Join(store.Dir, "ab", "abc123")); err != nil {
+		t.Errorf("object not stored under its prefix directory: %v", err)
+	}
+
+	object, err := store.Get(ctx, "abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := io.ReadAll(object)
+	object.Close()
+	if string(content) != "hello, world" {
+		t.Errorf("Get = %q", content)
+	}
+	if info, err := store.Stat(ctx, "abc123"); err != nil || info.Size != 12 || info.Key != "abc123" {
+		t.Errorf("Stat = %+v, %v", info, err)
+	}
+
+	if _, err := store.Put(ctx, "abc123", strings.NewReader("replaced")); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := store.Stat(ctx, "abc123"); info.Size != 8 {
+		t.Errorf("Put did not replace the object, size %d", info.Size)
+	}
+
+	if err := store.Delete(ctx, "abc123"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(ctx, "abc123"); err != nil {
+		t.Errorf("deleting a missing object: %v", err)
+	}
+	if _, err := store.Get(ctx, "abc123"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete err = %v", err)
+	}
+	if _, err := store.Stat(ctx, "abc123"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat after Delete err = %v", err)
+	}
+}
+
+func TestLocalStoreFailedPutLeavesNothing(t *testing.T) {
+	ctx := context.Background()
+	store := &LocalStore{Dir: t.TempDir()}
+	failing := io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(errors.New("connection reset")))
+	if _, err := store.Put(ctx, "abc123", failing); err == nil {
+		t.Fatal("Put succeeded on a failing reader")
+	}
+	if _, err := store.Get(ctx, "abc123"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("partial object left behind: %v", err)
+	}
+	entries, _ := os.ReadDir(filepath.Join(store.Dir, "ab"))
+	if len(entries) != 0 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := store.Put(cancelled, "abc123", strings.NewReader("content")); !errors.Is(err, context.Canceled) {
+		t.Errorf("Put with a cancelled context err = %v", err)
+	}
+}
+
+func TestLocalStoreRejectsUnsafeKeys(t *testing.T) {
+	ctx := context.Background()
+	store := &LocalStore{Dir: t.TempDir()}
+	for _, key := range []string{"", "ab", "../etc", "ab/cd", `ab\cd`, ".hidden"} {
+		if _, err := store.Put(ctx, key, strings.NewReader("x")); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q) err = %v", key, err)
+		}
+		if _, err := store.Get(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Get(%q) err = %v", key, err)
+		}
+	}
+}
+
+func TestLocalStoreGetRange(t *testing.T) {
+	ctx := context.Background()
+	store := &LocalStore{Dir: t.TempDir()}
+	if _, err := store.Put(ctx, "abc123", strings.NewReader("hello, world")); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		offset, length int64
+		want           string
+	}{
+		{7, 5, "world"},
+		{7, -1, "world"},
+		{0, 5, "hello"},
+		{7, 100, "world"},
+	} {
+		object, err := store.GetRange(ctx, "abc123", test.offset, test.length)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(object)
+		object.Close()
+		if string(content) != test.want {
+			t.Errorf("GetRange(%d, %d) = %q, want %q", test.offset, test.length, content, test.want)
+		}
+	}
+	if _, err := store.GetRange(ctx, "missing", 0, 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetRange of a missing object err = %v", err)
+	}
+}
@@ -0,0 +1,316 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultS3Region   = "us-east-1"
+	defaultS3PartSize = 8 << 20
+	minS3PartSize     = 5 << 20
+	maxS3Parts        = 10000
+)
+
+// S3Store keeps objects in a bucket of an S3-compatible service such as
+// MinIO. Requests are signed with SigV4. Objects larger than PartSize are
+// sent as a multipart upload, so only one part is held in memory at a time.
+type S3Store struct {
+	Endpoint        *url.URL
+	Region          string
+	Bucket          string
+	AccessKeyId     string
+	SecretAccessKey string
+	// PathStyle addresses the bucket as endpoint/bucket/key instead of
+	// bucket.endpoint/key. MinIO needs it.
+	PathStyle bool
+	PartSize  int64
+	Client    *http.Client
+}
+
+// S3Error is an error response from the service.
+type S3Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *S3Error) Error() string {
+	return fmt.Sprintf("s3: %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+func NewS3Store(endpoint, region, bucket, accessKeyId, secretAccessKey string) (*S3Store, error) {
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if endpointURL.Scheme != "http" && endpointURL.Scheme != "https" || endpointURL.Host == "" {
+		return nil, fmt.Errorf("s3 endpoint %q is not an http(s) URL", endpoint)
+	}
+	if bucket == "" || accessKeyId == "" || secretAccessKey == "" {
+		return nil, errors.New("s3 bucket and credentials are required")
+	}
+	if region == "" {
+		region = defaultS3Region
+	}
+	return &S3Store{
+		Endpoint:        endpointURL,
+		Region:          region,
+		Bucket:          bucket,
+		AccessKeyId:     accessKeyId,
+		SecretAccessKey: secretAccessKey,
+		PathStyle:       true,
+		PartSize:        defaultS3PartSize,
+		Client:          http.DefaultClient,
+	}, nil
+}
+
+// S3StoreFromEnv reads S3_ENDPOINT, S3_REGION, S3_BUCKET, S3_ACCESS_KEY_ID,
+// S3_SECRET_ACCESS_KEY and S3_PATH_STYLE.
+func S3StoreFromEnv() (*S3Store, error) {
+	store, err := NewS3Store(os.Getenv("S3_ENDPOINT"), os.Getenv("S3_REGION"), os.Getenv("S3_BUCKET"),
+		os.Getenv("S3_ACCESS_KEY_ID"), os.Getenv("S3_SECRET_ACCESS_KEY"))
+	if err != nil {
+		return nil, err
+	}
+	if pathStyle, err := strconv.ParseBool(os.Getenv("S3_PATH_STYLE")); err == nil {
+		store.PathStyle = pathStyle
+	}
+	return store, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	if err := checkKey(key); err != nil {
+		return 0, err
+	}
+	partSize := s.PartSize
+	if partSize < minS3PartSize {
+		partSize = minS3PartSize
+	}
+	buf := make([]byte, partSize)
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return int64(n), s.putObject(ctx, key, buf[:n])
+	}
+	if err != nil {
+		return 0, err
+	}
+	return s.putMultipart(ctx, key, buf, r)
+}
+
+func (s *S3Store) putObject(ctx context.Context, key string, data []byte) error {
+	resp, err := s.do(ctx, http.MethodPut, key, nil, data, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// putMultipart uploads first and the rest of r as parts. The upload is
+// aborted on any failure so the service does not keep the parts.
+func (s *S3Store) putMultipart(ctx context.Context, key string, first []byte, r io.Reader) (int64, error) {
+	var initiated struct {
+		UploadId string `xml:"UploadId"`
+	}
+	if err := s.doXML(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil, &initiated); err != nil {
+		return 0, err
+	}
+	uploadQuery := url.Values{"uploadId": {initiated.UploadId}}
+	written, parts, err := s.uploadParts(ctx, key, initiated.UploadId, first, r)
+	if err == nil {
+		err = s.completeMultipart(ctx, key, uploadQuery, parts)
+	}
+	if err != nil {
+		abortCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if resp, abortErr := s.do(abortCtx, http.MethodDelete, key, uploadQuery, nil, nil); abortErr == nil {
+			resp.Body.Close()
+		}
+		return written, err
+	}
+	return written, nil
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+func (s *S3Store) uploadParts(ctx context.Context, key, uploadId string, buf []byte, r io.Reader) (int64, []completedPart, error) {
+	var written int64
+	var parts []completedPart
+	data := buf
+	for partNumber := 1; ; partNumber++ {
+		if partNumber > maxS3Parts {
+			return written, nil, errors.New("s3: object has too many parts")
+		}
+		query := url.Values{"partNumber": {strconv.Itoa(partNumber)}, "uploadId": {uploadId}}
+		resp, err := s.do(ctx, http.MethodPut, key, query, data, nil)
+		if err != nil {
+			return written, nil, err
+		}
+		resp.Body.Close()
+		parts = append(parts, completedPart{PartNumber: partNumber, ETag: resp.Header.Get("ETag")})
+		written += int64(len(data))
+
+		n, err := io.ReadFull(r, buf)
+		if err == io.EOF {
+			return written, parts, nil
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return written, nil, err
+		}
+		data = buf[:n]
+	}
+}
+
+func (s *S3Store) completeMultipart(ctx context.Context, key string, query url.Values, parts []completedPart) error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+	// The service can answer 200 and still report an error in the body.
+	var result struct {
+		XMLName xml.Name
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if err := s.doXML(ctx, http.MethodPost, key, query, body, &result); err != nil {
+		return err
+	}
+	if result.XMLName.Local == "Error" {
+		return &S3Error{StatusCode: http.StatusOK, Code: result.Code, Message: result.Message}
+	}
+	return nil
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *S3Store) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	byteRange := fmt.Sprintf("bytes=%d-", offset)
+	if length >= 0 {
+		if length == 0 {
+			return io.NopCloser(strings.NewReader("")), nil
+		}
+		byteRange += strconv.FormatInt(offset+length-1, 10)
+	}
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil, http.Header{"Range": {byteRange}})
+	var s3Err *S3Error
+	if errors.As(err, &s3Err) && s3Err.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil, nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3Store) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	if err := checkKey(key); err != nil {
+		return ObjectInfo{}, err
+	}
+	resp, err := s.do(ctx, http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	resp.Body.Close()
+	info := ObjectInfo{Key: key, Size: resp.ContentLength}
+	info.ModifiedAt, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	return info, nil
+}
+
+func (s *S3Store) doXML(ctx context.Context, method, key string, query url.Values, body []byte, result interface{}) error {
+	resp, err := s.do(ctx, method, key, query, body, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return xml.NewDecoder(resp.Body).Decode(result)
+}
+
+// do sends a signed request for key, with any extra header, and turns
+// error responses into ErrNotFound or *S3Error. The caller closes the body
+// of a successful response.
+func (s *S3Store) do(ctx context.Context, method, key string, query url.Values, body []byte, header http.Header) (*http.Response, error) {
+	endpoint := *s.Endpoint
+	path := strings.TrimSuffix(endpoint.Path, "/") + "/"
+	if s.PathStyle {
+		path += s.Bucket + "/"
+	} else {
+		endpoint.Host = s.Bucket + "." + endpoint.Host
+	}
+	path += key
+	endpoint.Path = path
+	endpoint.RawPath = uriEncode(path, false)
+	endpoint.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	payloadHash := emptyPayloadHash
+	if len(body) > 0 {
+		payloadHash = sha256Hex(body)
+	}
+	signV4(req, s.AccessKeyId, s.SecretAccessKey, s.Region, "s3", payloadHash, time.Now())
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	s3Err := &S3Error{StatusCode: resp.StatusCode}
+	xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(s3Err)
+	// HEAD responses have no body to tell a missing key from a missing bucket.
+	if resp.StatusCode == http.StatusNotFound && (s3Err.Code == "NoSuchKey" || s3Err.Code == "") {
+		return nil, ErrNotFound
+	}
+	return nil, s3Err
+}
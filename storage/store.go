@@ -0,0 +1,65 @@
+// Package storage keeps file contents outside the database.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+var ErrInvalidKey = errors.New("storage key is not valid")
+var ErrNotFound = errors.New("object not found")
+
+// BlobStore holds file contents by key. Contents are streamed in both
+// directions so a large file never has to fit in memory.
+type BlobStore interface {
+	// Put stores everything read from r under key, replacing any object
+	// already there, and returns the number of bytes stored. A failed Put
+	// leaves no partial object behind.
+	Put(ctx context.Context, key string, r io.Reader) (int64, error)
+	// Get opens the object for reading. The caller closes it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// GetRange reads length bytes from offset on, or everything from offset
+	// on when length is negative. The range may run past the end.
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	// Delete removes the object. Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+}
+
+type ObjectInfo struct {
+	Key        string
+	Size       int64
+	ModifiedAt time.Time
+}
+
+var Default BlobStore = &LocalStore{Dir: defaultStorageDir}
+
+// FromEnv picks the store named by FILE_STORAGE_BACKEND, "local" (the
+// default) or "s3".
+func FromEnv() (BlobStore, error) {
+	switch backend := os.Getenv("FILE_STORAGE_BACKEND"); backend {
+	case "", "local":
+		if dir := os.Getenv("FILE_STORAGE_DIR"); dir != "" {
+			return &LocalStore{Dir: dir}, nil
+		}
+		return &LocalStore{Dir: defaultStorageDir}, nil
+	case "s3":
+		return S3StoreFromEnv()
+	default:
+		return nil, fmt.Errorf("unknown FILE_STORAGE_BACKEND %q", backend)
+	}
+}
+
+// checkKey accepts keys that are safe as a file name and as an object name,
+// which every key this service generates is.
+func checkKey(key string) error {
+	if len(key) < 3 || strings.ContainsAny(key, `/\`) || strings.HasPrefix(key, ".") {
+		return ErrInvalidKey
+	}
+	return nil
+}
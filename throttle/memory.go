@@ -0,0 +1,55 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const memoryStorePruneSize = 10000
+const memoryStoreStaleAfter = time.Hour
+
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: map[string]Record{}}
+}
+
+func (s *MemoryStore) Update(ctx context.Context, key string, fn func(record *Record)) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.records) >= memoryStorePruneSize {
+		s.prune(time.Now())
+	}
+	record := s.records[key]
+	record.Key = key
+	fn(&record)
+	s.records[key] = record
+	return record, nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record := s.records[key]
+	record.Key = key
+	return record, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+func (s *MemoryStore) prune(now time.Time) {
+	for key, record := range s.records {
+		if !record.LockedUntil.After(now) && now.Sub(record.LastFailureAt) > memoryStoreStaleAfter {
+			delete(s.records, key)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package throttle
+
+import (
+	"context"
+	"time"
+
+	"github.com/subashshakya/SFSS/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PostgresStore shares counters between SFSS replicas through the
+// login_attempt_counters table.
+type PostgresStore struct {
+	db *gorm.DB
+}
+
+func NewPostgresStore(db *gorm.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Update(ctx context.Context, key string, fn func(record *Record)) (Record, error) {
+	var record Record
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		counter := models.LoginAttemptCounter{Key: key, LastFailureAt: time.Unix(0, 0), LockedUntil: time.Unix(0, 0)}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&counter).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", key).First(&counter).Error; err != nil {
+			return err
+		}
+		record = toRecord(counter)
+		fn(&record)
+		return tx.Model(&models.LoginAttemptCounter{}).Where("key = ?", key).Updates(map[string]interface{}{
+			"failures":        record.Failures,
+			"last_failure_at": record.LastFailureAt,
+			"locked_until":    record.LockedUntil,
+		}).Error
+	})
+	return record, err
+}
+
+func (s *PostgresStore) Get(ctx context.Context, key string) (Record, error) {
+	var counter models.LoginAttemptCounter
+	result := s.db.WithContext(ctx).Where("key = ?", key).Limit(1).Find(&counter)
+	if result.Error != nil {
+		return Record{Key: key}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return Record{Key: key}, nil
+	}
+	return toRecord(counter), nil
+}
+
+func (s *PostgresStore) Delete(ctx context.Context, key string) error {
+	return s.db.WithContext(ctx).Where("key = ?", key).Delete(&models.LoginAttemptCounter{}).Error
+}
+
+func toRecord(counter models.LoginAttemptCounter) Record {
+	return Record{
+		Key:           counter.Key,
+		Failures:      counter.Failures,
+		LastFailureAt: counter.LastFailureAt,
+		LockedUntil:   counter.LockedUntil,
+	}
+}
+
+// PostgresRateStore shares request counts between SFSS replicas through the
+// rate_limit_counters table.
+type PostgresRateStore struct {
+	db *gorm.DB
+}
+
+func NewPostgresRateStore(db *gorm.DB) *PostgresRateStore {
+	return &PostgresRateStore{db: db}
+}
+
+func (s *PostgresRateStore) Hit(ctx context.Context, key string, now time.Time, window time.Duration) (int, time.Time, error) {
+	var counter models.RateLimitCounter
+	result := s.db.WithContext(ctx).Raw(`INSERT INTO rate_limit_counters (key, count, window_ends_at) VALUES (?, 1, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			count = CASE WHEN rate_limit_counters.window_ends_at > ? THEN rate_limit_counters.count + 1 ELSE 1 END,
+			window_ends_at = CASE WHEN rate_limit_counters.window_ends_at > ? THEN rate_limit_counters.window_ends_at ELSE EXCLUDED.window_ends_at END
+		RETURNING key, count, window_ends_at`, key, now.Add(window), now, now).Scan(&counter)
+	return counter.Count, counter.WindowEndsAt, result.Error
+}
+
+// DeleteExpired removes counters whose window ended before now.
+func (s *PostgresRateStore) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	result := s.db.WithContext(ctx).Where("window_ends_at <= ?", now).Delete(&models.RateLimitCounter{})
+	return result.RowsAffected, result.Error
+}
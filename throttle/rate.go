@@ -0,0 +1,78 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RatePolicy allows Limit requests per fixed Window.
+type RatePolicy struct {
+	Limit  int
+	Window time.Duration
+}
+
+var DirectorySearchPolicy = RatePolicy{Limit: 30, Window: time.Minute}
+
+// PasswordResetEmailPolicy and PasswordResetIPPolicy limit reset emails per
+// address and per client so the endpoint cannot flood an inbox.
+var PasswordResetEmailPolicy = RatePolicy{Limit: 3, Window: time.Minute * 15}
+var PasswordResetIPPolicy = RatePolicy{Limit: 10, Window: time.Minute * 15}
+
+// RateStore counts requests per key in fixed windows. It is kept apart from
+// the failed sign-in Store so request limits and lockouts never share state.
+// Hit must count atomically so that replicas sharing a store never lose a
+// request.
+type RateStore interface {
+	// Hit counts one request against key. A window that ended before now is
+	// replaced by one ending at now+window. It returns the count in the
+	// current window and when that window ends.
+	Hit(ctx context.Context, key string, now time.Time, window time.Duration) (int, time.Time, error)
+}
+
+// Allow counts one request against key. It returns how long the caller has to
+// wait when the limit for the current window is used up, and zero otherwise.
+func (l *Limiter) Allow(ctx context.Context, key string, policy RatePolicy) (time.Duration, error) {
+	now := l.now()
+	count, windowEnd, err := l.Rates.Hit(ctx, key, now, policy.Window)
+	if err != nil {
+		return 0, err
+	}
+	if count > policy.Limit {
+		return windowEnd.Sub(now), nil
+	}
+	return 0, nil
+}
+
+type rateWindow struct {
+	count int
+	end   time.Time
+}
+
+type MemoryRateStore struct {
+	mu      sync.Mutex
+	windows map[string]rateWindow
+}
+
+func NewMemoryRateStore() *MemoryRateStore {
+	return &MemoryRateStore{windows: map[string]rateWindow{}}
+}
+
+func (s *MemoryRateStore) Hit(ctx context.Context, key string, now time.Time, window time.Duration) (int, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.windows) >= memoryStorePruneSize {
+		for staleKey, stale := range s.windows {
+			if !stale.end.After(now) {
+				delete(s.windows, staleKey)
+			}
+		}
+	}
+	current := s.windows[key]
+	if !current.end.After(now) {
+		current = rateWindow{end: now.Add(window)}
+	}
+	current.count++
+	s.windows[key] = current
+	return current.count, current.end, nil
+}
@@ -0,0 +1,118 @@
+package throttle
+
+import (
+	"context"
+	"math"
+	"strings"
+	"time"
+)
+
+type Record struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   time.Time
+}
+
+// Store keeps failed-attempt counters. Update must apply fn atomically so that
+// replicas sharing a store never lose an increment.
+type Store interface {
+	Update(ctx context.Context, key string, fn func(record *Record)) (Record, error)
+	Get(ctx context.Context, key string) (Record, error)
+	Delete(ctx context.Context, key string) error
+}
+
+type Policy struct {
+	Threshold   int
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+	Window      time.Duration
+}
+
+var AccountPolicy = Policy{Threshold: 5, BaseLockout: time.Second * 30, MaxLockout: time.Hour, Window: time.Minute * 15}
+var IPPolicy = Policy{Threshold: 20, BaseLockout: time.Minute, MaxLockout: time.Hour, Window: time.Minute * 15}
+
+// lockoutFor doubles the lockout for every failure past the threshold.
+func (p Policy) lockoutFor(failures int) time.Duration {
+	if failures < p.Threshold {
+		return 0
+	}
+	exponent := float64(failures - p.Threshold)
+	lockout := time.Duration(float64(p.BaseLockout) * math.Pow(2, exponent))
+	if lockout > p.MaxLockout || lockout <= 0 {
+		return p.MaxLockout
+	}
+	return lockout
+}
+
+type Limiter struct {
+	Store         Store
+	Rates         RateStore
+	AccountPolicy Policy
+	IPPolicy      Policy
+	now           func() time.Time
+}
+
+var Default = NewLimiter(NewMemoryStore(), NewMemoryRateStore())
+
+func NewLimiter(store Store, rates RateStore) *Limiter {
+	return &Limiter{Store: store, Rates: rates, AccountPolicy: AccountPolicy, IPPolicy: IPPolicy, now: time.Now}
+}
+
+type Lockout struct {
+	Scope      string
+	RetryAfter time.Duration
+	Until      time.Time
+}
+
+// Check returns a non-nil Lockout when either the account or the IP address
+// is currently locked.
+func (l *Limiter) Check(ctx context.Context, account string, ip string) (*Lockout, error) {
+	now := l.now()
+	for _, key := range []struct{ scope, key string }{{"account", accountKey(account)}, {"ip", ipKey(ip)}} {
+		record, err := l.Store.Get(ctx, key.key)
+		if err != nil {
+			return nil, err
+		}
+		if record.LockedUntil.After(now) {
+			return &Lockout{Scope: key.scope, RetryAfter: record.LockedUntil.Sub(now), Until: record.LockedUntil}, nil
+		}
+	}
+	return nil, nil
+}
+
+func (l *Limiter) Fail(ctx context.Context, account string, ip string) error {
+	if _, err := l.Store.Update(ctx, accountKey(account), l.failure(l.AccountPolicy)); err != nil {
+		return err
+	}
+	_, err := l.Store.Update(ctx, ipKey(ip), l.failure(l.IPPolicy))
+	return err
+}
+
+// Succeed clears the account counter. The IP counter is left to expire so that
+// one valid login cannot be used to reset a spraying attack from that address.
+func (l *Limiter) Succeed(ctx context.Context, account string) error {
+	return l.Store.Delete(ctx, accountKey(account))
+}
+
+func (l *Limiter) failure(policy Policy) func(record *Record) {
+	return func(record *Record) {
+		now := l.now()
+		if now.Sub(record.LastFailureAt) > policy.Window && !record.LockedUntil.After(now) {
+			record.Failures = 0
+		}
+		record.Failures++
+		record.LastFailureAt = now
+		if lockout := policy.lockoutFor(record.Failures); lockout > 0 {
+			record.LockedUntil = now.Add(lockout)
+		}
+	}
+}
+
+func accountKey(account string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(account))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
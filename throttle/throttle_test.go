@@ -0,0 +1,128 @@
+package throttle
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// testLimiter returns a limiter whose clock the test moves with the returned
+// function.
+func testLimiter() (*Limiter, func(time.Duration)) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewLimiter(NewMemoryStore(), NewMemoryRateStore())
+	limiter.AccountPolicy = Policy{Threshold: 3, BaseLockout: time.Second * 30, MaxLockout: time.Minute * 5, Window: time.Minute * 15}
+	limiter.IPPolicy = Policy{Threshold: 100, BaseLockout: time.Minute, MaxLockout: time.Hour, Window: time.Minute * 15}
+	limiter.now = func() time.Time { return now }
+	return limiter, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestLockoutFor(t *testing.T) {
+	policy := Policy{Threshold: 3, BaseLockout: time.Second * 30, MaxLockout: time.Minute * 5}
+	tests := []struct {
+		failures int
+		lockout  time.Duration
+	}{
+		{2, 0},
+		{3, time.Second * 30},
+		{4, time.Minute},
+		{5, time.Minute * 2},
+		{7, time.Minute * 5},
+		{200, time.Minute * 5},
+	}
+	for _, test := range tests {
+		if got := policy.lockoutFor(test.failures); got != test.lockout {
+			t.Errorf("lockoutFor(%d) = %s, want %s", test.failures, got, test.lockout)
+		}
+	}
+}
+
+func TestLimiterLocksOutWithBackoff(t *testing.T) {
+	ctx := context.Background()
+	limiter, advance := testLimiter()
+	for i := 0; i < 2; i++ {
+		if err := limiter.Fail(ctx, "Ada@Example.com", "10.0.0.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if lockout, _ := limiter.Check(ctx, "ada@example.com", "10.0.0.1"); lockout != nil {
+		t.Fatalf("locked out below the threshold: %+v", lockout)
+	}
+
+	limiter.Fail(ctx, "ada@example.com", "10.0.0.1")
+	lockout, err := limiter.Check(ctx, "ada@example.com", "10.0.0.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lockout == nil || lockout.Scope != "account" || lockout.RetryAfter != time.Second*30 {
+		t.Fatalf("lockout = %+v, want the account locked for 30s", lockout)
+	}
+
+	advance(time.Second * 10)
+	if lockout, _ := limiter.Check(ctx, "ada@example.com", "10.0.0.2"); lockout == nil || lockout.RetryAfter != time.Second*20 {
+		t.Fatalf("Retry-After does not count down: %+v", lockout)
+	}
+	advance(time.Second * 20)
+	if lockout, _ := limiter.Check(ctx, "ada@example.com", "10.0.0.2"); lockout != nil {
+		t.Fatalf("still locked after the lockout: %+v", lockout)
+	}
+
+	// the next failure within the window doubles the lockout
+	limiter.Fail(ctx, "ada@example.com", "10.0.0.1")
+	if lockout, _ := limiter.Check(ctx, "ada@example.com", "10.0.0.2"); lockout == nil || lockout.RetryAfter != time.Minute {
+		t.Fatalf("lockout = %+v, want 1m", lockout)
+	}
+}
+
+func TestLimiterForgetsOldFailures(t *testing.T) {
+	ctx := context.Background()
+	limiter, advance := testLimiter()
+	limiter.Fail(ctx, "ada@example.com", "10.0.0.1")
+	limiter.Fail(ctx, "ada@example.com", "10.0.0.1")
+	advance(time.Minute * 16)
+	limiter.Fail(ctx, "ada@example.com", "10.0.0.1")
+	if lockout, _ := limiter.Check(ctx, "ada@example.com", "10.0.0.1"); lockout != nil {
+		t.Fatalf("failures outside the window counted: %+v", lockout)
+	}
+}
+
+func TestLimiterSucceedKeepsTheIPCounter(t *testing.T) {
+	ctx := context.Background()
+	limiter, _ := testLimiter()
+	limiter.IPPolicy.Threshold = 3
+	for i := 0; i < 3; i++ {
+		limiter.Fail(ctx, "ada@example.com", "10.0.0.1")
+	}
+	if err := limiter.Succeed(ctx, "ada@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	lockout, _ := limiter.Check(ctx, "ada@example.com", "10.0.0.1")
+	if lockout == nil || lockout.Scope != "ip" {
+		t.Fatalf("lockout = %+v, want the IP still locked", lockout)
+	}
+	if lockout, _ := limiter.Check(ctx, "ada@example.com", "10.0.0.2"); lockout != nil {
+		t.Fatalf("account still locked after a success: %+v", lockout)
+	}
+}
+
+func TestLimiterAllow(t *testing.T) {
+	ctx := context.Background()
+	limiter, advance := testLimiter()
+	policy := RatePolicy{Limit: 2, Window: time.Minute}
+	for i := 0; i < 2; i++ {
+		if wait, err := limiter.Allow(ctx, "search:1", policy); err != nil || wait != 0 {
+			t.Fatalf("request %d: wait %s, err %v", i, wait, err)
+		}
+	}
+	advance(time.Second * 15)
+	if wait, _ := limiter.Allow(ctx, "search:1", policy); wait != time.Second*45 {
+		t.Fatalf("wait = %s, want the rest of the window", wait)
+	}
+	if wait, _ := limiter.Allow(ctx, "search:2", policy); wait != 0 {
+		t.Fatal("keys share a window")
+	}
+	advance(time.Second * 45)
+	if wait, _ := limiter.Allow(ctx, "search:1", policy); wait != 0 {
+		t.Fatalf("wait = %s in a new window", wait)
+	}
+}
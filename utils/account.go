@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+const defaultAccountDeletionGracePeriod = time.Hour * 24 * 7
+const defaultLoginHistoryRetention = time.Hour * 24 * 180
+
+// AccountDeletionGracePeriod is how long a user can cancel a deletion request
+// before the account is purged.
+func AccountDeletionGracePeriod() time.Duration {
+	hours, err := strconv.Atoi(os.Getenv("ACCOUNT_DELETION_GRACE_HOURS"))
+	if err != nil || hours < 0 {
+		return defaultAccountDeletionGracePeriod
+	}
+	return time.Hour * time.Duration(hours)
+}
+
+// SignInStepUpEnabled reports whether sign-ins from a new IP address and user
+// agent must be confirmed by email before tokens are issued.
+func SignInStepUpEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("SIGN_IN_STEP_UP"))
+	return enabled
+}
+
+// LoginHistoryRetention is how long sign-in attempts are kept, read from
+// LOGIN_HISTORY_RETENTION_DAYS. Sign-ins from a location not seen within it
+// count as new for the step-up check.
+func LoginHistoryRetention() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("LOGIN_HISTORY_RETENTION_DAYS"))
+	if err != nil || days <= 0 {
+		return defaultLoginHistoryRetention
+	}
+	return time.Hour * 24 * time.Duration(days)
+}
@@ -1,6 +1,11 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
@@ -8,34 +13,157 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
-	jwt "github.com/golang-jwt/jwt"
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/subashshakya/SFSS/constants"
+	"github.com/subashshakya/SFSS/db/orms"
 )
 
-func GenerateToken(user_id uint) (string, error) {
-	token_life_span, err := strconv.Atoi(os.Getenv("TOKEN_HOUR_LIFESPAN"))
+const defaultRefreshTokenLifespan = time.Hour * 24 * 7
+const defaultAccessTokenLifespan = time.Hour
+const defaultTokenClockSkew = time.Second * 30
+const defaultTokenIssuer = "sfss"
+const defaultTokenAudience = "sfss-api"
+const challengeTokenLifespan = time.Minute * 5
+const mfaChallengePurpose = "mfa_challenge"
+const emailVerificationTokenLifespan = time.Hour * 24
+const emailVerificationPurpose = "email_verification"
+const oidcStateTokenLifespan = time.Minute * 10
+const oidcStatePurpose = "oidc_state"
+const StepUpTokenLifespan = time.Minute * 15
+const stepUpPurpose = "sign_in_step_up"
+const personalAccessTokenPrefix = "sfss_pat_"
+
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// AccessClaims are the claims of a session access token. Subject is the user
+// id in decimal.
+type AccessClaims struct {
+	SessionId string   `json:"sid"`
+	Scopes    []string `json:"scopes"`
+	jwt.RegisteredClaims
+}
+
+// Validate runs after the standard checks and rejects tokens that leave out
+// claims the API relies on.
+func (c *AccessClaims) Validate() error {
+	if c.ID == "" {
+		return errors.New("token has no jti")
+	}
+	if c.SessionId == "" {
+		return errors.New("token has no session")
+	}
+	if c.IssuedAt == nil || c.NotBefore == nil {
+		return errors.New("token has no iat or nbf")
+	}
+	if _, err := c.UserId(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *AccessClaims) UserId() (uint, error) {
+	return subjectUserId(c.Subject)
+}
+
+func subjectUserId(subject string) (uint, error) {
+	userId, err := strconv.ParseUint(subject, 10, 0)
+	if err != nil || userId == 0 {
+		return 0, errors.New("token subject is not a user id")
+	}
+	return uint(userId), nil
+}
+
+func TokenIssuer() string {
+	if issuer := os.Getenv("JWT_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return defaultTokenIssuer
+}
+
+func TokenAudience() string {
+	if audience := os.Getenv("JWT_AUDIENCE"); audience != "" {
+		return audience
+	}
+	return defaultTokenAudience
+}
+
+// AccessTokenLifespan reads ACCESS_TOKEN_LIFESPAN_MINUTES. Deployments that
+// still set the older TOKEN_HOUR_LIFESPAN keep its meaning, which despite the
+// name has always been minutes.
+func AccessTokenLifespan() time.Duration {
+	minutes, err := strconv.Atoi(os.Getenv("ACCESS_TOKEN_LIFESPAN_MINUTES"))
 	if err != nil {
-		return "", err
+		minutes, err = strconv.Atoi(os.Getenv("TOKEN_HOUR_LIFESPAN"))
+	}
+	if err != nil || minutes <= 0 {
+		return defaultAccessTokenLifespan
+	}
+	return time.Minute * time.Duration(minutes)
+}
+
+// TokenClockSkew is how far the clocks of this instance and the one that
+// issued a token may drift apart, from JWT_CLOCK_SKEW_SECONDS.
+func TokenClockSkew() time.Duration {
+	seconds, err := strconv.Atoi(os.Getenv("JWT_CLOCK_SKEW_SECONDS"))
+	if err != nil || seconds < 0 {
+		return defaultTokenClockSkew
 	}
-	claims := jwt.MapClaims{}
-	claims["authorized"] = true
-	claims["user_id"] = user_id
-	claims["exp"] = time.Now().Add(time.Minute * time.Duration(token_life_span)).Unix()
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return time.Second * time.Duration(seconds)
+}
 
-	return token.SignedString([]byte(os.Getenv("API_SECRET")))
+func GenerateToken(user_id uint, session_id string) (string, error) {
+	now := time.Now()
+	claims := AccessClaims{
+		SessionId: session_id,
+		Scopes:    constants.SessionScopes,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    TokenIssuer(),
+			Subject:   strconv.FormatUint(uint64(user_id), 10),
+			Audience:  jwt.ClaimStrings{TokenAudience()},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenLifespan())),
+			ID:        uuid.New().String(),
+		},
+	}
+	return signToken(&claims)
+}
+
+// ParseAccessToken verifies the signature and every registered claim of an
+// access token.
+func ParseAccessToken(tokenString string) (*AccessClaims, error) {
+	current, err := CurrentKeyring()
+	if err != nil {
+		return nil, err
+	}
+	var claims AccessClaims
+	parser := jwt.NewParser(
+		jwt.WithValidMethods(current.Algorithms()),
+		jwt.WithIssuer(TokenIssuer()),
+		jwt.WithAudience(TokenAudience()),
+		jwt.WithLeeway(TokenClockSkew()),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if _, err := parser.ParseWithClaims(tokenString, &claims, current.Keyfunc); err != nil {
+		return nil, err
+	}
+	return &claims, nil
 }
 
 func TokenValid(c *gin.Context) error {
-	tokenString := ExtractToken(c)
-	_, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(os.Getenv("API_SECRET")), nil
-	})
+	claims, err := ExtractTokenClaims(c)
+	if err != nil {
+		return err
+	}
+	revoked, err := orms.IsAccessTokenRevoked(c.Request.Context(), claims.ID)
 	if err != nil {
 		return err
 	}
+	if revoked {
+		return ErrTokenRevoked
+	}
 	return nil
 }
 
@@ -51,24 +179,222 @@ func ExtractToken(c *gin.Context) string {
 	return ""
 }
 
-func ExtractTokenID(c *gin.Context) (uint, error) {
-	tokenString := ExtractToken(c)
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(os.Getenv("API_SECRET")), nil
-	})
+func ExtractTokenClaims(c *gin.Context) (*AccessClaims, error) {
+	return ParseAccessToken(ExtractToken(c))
+}
+
+func RefreshTokenLifespan() time.Duration {
+	hours, err := strconv.Atoi(os.Getenv("REFRESH_TOKEN_HOUR_LIFESPAN"))
+	if err != nil || hours <= 0 {
+		return defaultRefreshTokenLifespan
+	}
+	return time.Hour * time.Duration(hours)
+}
+
+// GenerateOpaqueToken returns a random token for the client and the hash that
+// is stored in the database.
+func GenerateOpaqueToken() (string, string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	return token, HashOpaqueToken(token), nil
+}
+
+// GeneratePersonalAccessToken returns a new access token and its hash. The
+// prefix lets the middleware tell it apart from a session JWT.
+func GeneratePersonalAccessToken() (string, string, error) {
+	token, _, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	token = personalAccessTokenPrefix + token
+	return token, HashOpaqueToken(token), nil
+}
+
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, personalAccessTokenPrefix)
+}
+
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// purposeClaims are the claims of the short-lived tokens that stand for one
+// step of a flow rather than for a session. Subject is the user id in
+// decimal. Each purpose has its own audience, so that a token is accepted
+// neither for another purpose nor as an access token.
+type purposeClaims struct {
+	Purpose      string `json:"purpose"`
+	Email        string `json:"email,omitempty"`
+	State        string `json:"state,omitempty"`
+	Nonce        string `json:"nonce,omitempty"`
+	CodeVerifier string `json:"code_verifier,omitempty"`
+	CodeHash     string `json:"code_hash,omitempty"`
+	Location     string `json:"location,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Validate runs after the standard checks, like AccessClaims.Validate.
+func (c *purposeClaims) Validate() error {
+	if c.ID == "" {
+		return errors.New("token has no jti")
+	}
+	if c.IssuedAt == nil {
+		return errors.New("token has no iat")
+	}
+	return nil
+}
+
+func (c *purposeClaims) UserId() (uint, error) {
+	return subjectUserId(c.Subject)
+}
+
+func purposeAudience(purpose string) string {
+	return TokenAudience() + "/" + purpose
+}
+
+// newPurposeClaims starts the claims of a purpose token. A zero userId
+// leaves the subject out.
+func newPurposeClaims(userId uint, purpose string, lifespan time.Duration) purposeClaims {
+	now := time.Now()
+	claims := purposeClaims{
+		Purpose: purpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    TokenIssuer(),
+			Audience:  jwt.ClaimStrings{purposeAudience(purpose)},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(lifespan)),
+			ID:        uuid.New().String(),
+		},
+	}
+	if userId != 0 {
+		claims.Subject = strconv.FormatUint(uint64(userId), 10)
+	}
+	return claims
+}
+
+// GenerateChallengeToken issues the short-lived token returned by the password
+// step of a two-factor sign-in. It carries a purpose claim so that it is never
+// accepted as an access token.
+func GenerateChallengeToken(user_id uint) (string, error) {
+	claims := newPurposeClaims(user_id, mfaChallengePurpose, challengeTokenLifespan)
+	return signToken(&claims)
+}
+
+func ParseChallengeToken(tokenString string) (uint, error) {
+	claims, err := parsePurposeToken(tokenString, mfaChallengePurpose)
 	if err != nil {
 		return 0, err
 	}
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if ok && token.Valid {
-		uid, err := strconv.ParseUint(fmt.Sprintf("%.0f", claims["user_id"]), 10, 32)
-		if err != nil {
-			return 0, err
+	return claims.UserId()
+}
+
+// GenerateEmailVerificationToken binds the token to the address being
+// verified so that it stops working if the email is changed in between.
+func GenerateEmailVerificationToken(user_id uint, email string) (string, error) {
+	claims := newPurposeClaims(user_id, emailVerificationPurpose, emailVerificationTokenLifespan)
+	claims.Email = email
+	return signToken(&claims)
+}
+
+func ParseEmailVerificationToken(tokenString string) (uint, string, error) {
+	claims, err := parsePurposeToken(tokenString, emailVerificationPurpose)
+	if err != nil {
+		return 0, "", err
+	}
+	userId, err := claims.UserId()
+	if err != nil {
+		return 0, "", err
+	}
+	return userId, claims.Email, nil
+}
+
+// OIDCState is what a pending OIDC login has to remember until the callback.
+// LinkUserId is set when a signed-in user links the identity to their
+// account instead of signing in with it.
+type OIDCState struct {
+	State        string
+	Nonce        string
+	CodeVerifier string
+	LinkUserId   uint
+}
+
+// GenerateOIDCStateToken packs a pending OIDC login into a signed value that
+// is kept in a cookie. The subject is only set when linking.
+func GenerateOIDCStateToken(oidcState OIDCState) (string, error) {
+	claims := newPurposeClaims(oidcState.LinkUserId, oidcStatePurpose, oidcStateTokenLifespan)
+	claims.State = oidcState.State
+	claims.Nonce = oidcState.Nonce
+	claims.CodeVerifier = oidcState.CodeVerifier
+	return signToken(&claims)
+}
+
+func ParseOIDCStateToken(tokenString string) (OIDCState, error) {
+	claims, err := parsePurposeToken(tokenString, oidcStatePurpose)
+	if err != nil {
+		return OIDCState{}, err
+	}
+	oidcState := OIDCState{State: claims.State, Nonce: claims.Nonce, CodeVerifier: claims.CodeVerifier}
+	if claims.Subject != "" {
+		if oidcState.LinkUserId, err = claims.UserId(); err != nil {
+			return OIDCState{}, err
 		}
-		return uint(uid), nil
 	}
-	return 0, nil
+	return oidcState, nil
+}
+
+// GenerateStepUpToken is returned when a sign-in from a new device has to be
+// confirmed. It holds the hash of the code emailed to the user and is bound to
+// the IP address and user agent that started the sign-in.
+func GenerateStepUpToken(user_id uint, codeHash string, location string) (string, error) {
+	claims := newPurposeClaims(user_id, stepUpPurpose, StepUpTokenLifespan)
+	claims.CodeHash = codeHash
+	claims.Location = HashOpaqueToken(location)
+	return signToken(&claims)
+}
+
+// ParseStepUpToken checks the token was issued to location and returns the
+// user id and code hash.
+func ParseStepUpToken(tokenString string, location string) (uint, string, error) {
+	claims, err := parsePurposeToken(tokenString, stepUpPurpose)
+	if err != nil {
+		return 0, "", err
+	}
+	if claims.Location != HashOpaqueToken(location) {
+		return 0, "", errors.New("step-up token was issued to another device")
+	}
+	userId, err := claims.UserId()
+	if err != nil {
+		return 0, "", err
+	}
+	return userId, claims.CodeHash, nil
+}
+
+// parsePurposeToken verifies a purpose token as strictly as ParseAccessToken,
+// against the audience of purpose.
+func parsePurposeToken(tokenString string, purpose string) (*purposeClaims, error) {
+	current, err := CurrentKeyring()
+	if err != nil {
+		return nil, err
+	}
+	var claims purposeClaims
+	parser := jwt.NewParser(
+		jwt.WithValidMethods(current.Algorithms()),
+		jwt.WithIssuer(TokenIssuer()),
+		jwt.WithAudience(purposeAudience(purpose)),
+		jwt.WithLeeway(TokenClockSkew()),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if _, err := parser.ParseWithClaims(tokenString, &claims, current.Keyfunc); err != nil {
+		return nil, err
+	}
+	if claims.Purpose != purpose {
+		return nil, fmt.Errorf("token is not a %s token", purpose)
+	}
+	return &claims, nil
 }
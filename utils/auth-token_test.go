@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestPurposeTokensRoundTrip(t *testing.T) {
+	challenge, err := GenerateChallengeToken(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userId, err := ParseChallengeToken(challenge); err != nil || userId != 42 {
+		t.Errorf("challenge = %d, %v", userId, err)
+	}
+
+	verification, err := GenerateEmailVerificationToken(42, "ada@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userId, email, err := ParseEmailVerificationToken(verification); err != nil || userId != 42 || email != "ada@example.com" {
+		t.Errorf("email verification = %d, %q, %v", userId, email, err)
+	}
+
+	for _, linkUserId := range []uint{0, 42} {
+		want := OIDCState{State: "s", Nonce: "n", CodeVerifier: "v", LinkUserId: linkUserId}
+		stateToken, err := GenerateOIDCStateToken(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := ParseOIDCStateToken(stateToken); err != nil || got != want {
+			t.Errorf("oidc state = %+v, %v, want %+v", got, err, want)
+		}
+	}
+
+	stepUp, err := GenerateStepUpToken(42, "code-hash", "10.0.0.1 curl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userId, codeHash, err := ParseStepUpToken(stepUp, "10.0.0.1 curl"); err != nil || userId != 42 || codeHash != "code-hash" {
+		t.Errorf("step-up = %d, %q, %v", userId, codeHash, err)
+	}
+	if _, _, err := ParseStepUpToken(stepUp, "10.0.0.2 curl"); err == nil {
+		t.Error("step-up token accepted from another device")
+	}
+}
+
+func TestPurposeTokensOnlyServeTheirPurpose(t *testing.T) {
+	challenge, err := GenerateChallengeToken(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ParseEmailVerificationToken(challenge); err == nil {
+		t.Error("challenge token accepted for email verification")
+	}
+	if _, err := ParseAccessToken(challenge); err == nil {
+		t.Error("challenge token accepted as an access token")
+	}
+	access, err := GenerateToken(42, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseChallengeToken(access); err == nil {
+		t.Error("access token accepted as a challenge token")
+	}
+}
+
+func TestParseAccessTokenChecksRegisteredClaims(t *testing.T) {
+	now := time.Now()
+	valid := func() AccessClaims {
+		return AccessClaims{
+			SessionId: "session",
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    TokenIssuer(),
+				Subject:   "42",
+				Audience:  jwt.ClaimStrings{TokenAudience()},
+				IssuedAt:  jwt.NewNumericDate(now),
+				NotBefore: jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+				ID:        "jti",
+			},
+		}
+	}
+	tests := []struct {
+		name   string
+		change func(*AccessClaims)
+		valid  bool
+	}{
+		{"valid", func(*AccessClaims) {}, true},
+		{"within the clock skew", func(c *AccessClaims) { c.NotBefore = jwt.NewNumericDate(now.Add(TokenClockSkew() / 2)) }, true},
+		{"wrong issuer", func(c *AccessClaims) { c.Issuer = "https://elsewhere.example.com" }, false},
+		{"wrong audience", func(c *AccessClaims) { c.Audience = jwt.ClaimStrings{"someone-else"} }, false},
+		{"purpose audience", func(c *AccessClaims) { c.Audience = jwt.ClaimStrings{purposeAudience("challenge")} }, false},
+		{"not yet valid", func(c *AccessClaims) { c.NotBefore = jwt.NewNumericDate(now.Add(time.Hour)) }, false},
+		{"no nbf", func(c *AccessClaims) { c.NotBefore = nil }, false},
+		{"issued in the future", func(c *AccessClaims) { c.IssuedAt = jwt.NewNumericDate(now.Add(time.Hour)) }, false},
+		{"expired", func(c *AccessClaims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Hour)) }, false},
+		{"no exp", func(c *AccessClaims) { c.ExpiresAt = nil }, false},
+		{"no jti", func(c *AccessClaims) { c.ID = "" }, false},
+		{"no session", func(c *AccessClaims) { c.SessionId = "" }, false},
+		{"subject is not a user id", func(c *AccessClaims) { c.Subject = "ada" }, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := valid()
+			test.change(&claims)
+			token, err := signToken(&claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ParseAccessToken(token); (err == nil) != test.valid {
+				t.Errorf("ParseAccessToken err = %v, want valid %v", err, test.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/subashshakya/SFSS/db/orms"
+)
+
+const defaultFileVersionsKeep = 10
+
+// FileVersionRetention reads FILE_VERSIONS_KEEP, how many versions of a file
+// are always kept, and FILE_VERSIONS_KEEP_DAYS, how long any version is
+// kept. A FILE_VERSIONS_KEEP of 0 leaves only the age limit, and with both
+// at 0 every version is kept.
+func FileVersionRetention() orms.VersionRetention {
+	retention := orms.VersionRetention{Keep: defaultFileVersionsKeep}
+	if keep, err := strconv.Atoi(os.Getenv("FILE_VERSIONS_KEEP")); err == nil && keep >= 0 {
+		retention.Keep = keep
+	}
+	if days, err := strconv.Atoi(os.Getenv("FILE_VERSIONS_KEEP_DAYS")); err == nil && days > 0 {
+		retention.MaxAge = time.Duration(days) * 24 * time.Hour
+	}
+	return retention
+}
@@ -0,0 +1,515 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+const AlgorithmEdDSA = "EdDSA"
+const AlgorithmRS256 = "RS256"
+const activeKidFile = "active.kid"
+const signingKeyExtension = ".pem"
+const signingKeyCreatedHeader = "Created"
+const unknownKidReloadInterval = time.Second * 30
+
+var ErrUnknownSigningKey = errors.New("token was signed with an unknown key")
+
+type SigningKey struct {
+	Kid        string
+	Algorithm  string
+	PrivateKey crypto.Signer
+	CreatedAt  time.Time
+}
+
+func (k *SigningKey) Method() jwt.SigningMethod {
+	if k.Algorithm == AlgorithmRS256 {
+		return jwt.SigningMethodRS256
+	}
+	return jwt.SigningMethodEdDSA
+}
+
+// Keyring holds the key new tokens are signed with and the retired keys that
+// are still accepted until every token they signed has expired.
+type Keyring struct {
+	mu         sync.RWMutex
+	active     *SigningKey
+	retired    []*SigningKey
+	lastReload time.Time
+}
+
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+var keyring *Keyring
+var keyringMu sync.Mutex
+
+// CurrentKeyring returns the process keyring, loading it from JWT_KEYS_DIR on
+// first use. A failed load is returned to the caller and tried again on the
+// next call.
+func CurrentKeyring() (*Keyring, error) {
+	keyringMu.Lock()
+	defer keyringMu.Unlock()
+	if keyring != nil {
+		return keyring, nil
+	}
+	loaded, err := LoadKeyring(os.Getenv("JWT_KEYS_DIR"), SigningAlgorithm())
+	if err != nil {
+		return nil, err
+	}
+	keyring = loaded
+	return keyring, nil
+}
+
+// signToken signs claims with the active key of the process keyring.
+func signToken(claims jwt.Claims) (string, error) {
+	current, err := CurrentKeyring()
+	if err != nil {
+		return "", err
+	}
+	return current.Sign(claims)
+}
+
+// ReloadKeyring rereads JWT_KEYS_DIR into the process keyring. A failed
+// reload still counts for the unknown kid interval so that a broken
+// directory is not read again on every request.
+func ReloadKeyring() error {
+	current, err := CurrentKeyring()
+	if err != nil {
+		return err
+	}
+	loaded, err := LoadKeyring(os.Getenv("JWT_KEYS_DIR"), SigningAlgorithm())
+	current.mu.Lock()
+	defer current.mu.Unlock()
+	current.lastReload = time.Now()
+	if err != nil {
+		return err
+	}
+	current.active = loaded.active
+	current.retired = loaded.retired
+	return nil
+}
+
+func SigningAlgorithm() string {
+	if strings.EqualFold(os.Getenv("JWT_SIGNING_ALG"), AlgorithmRS256) {
+		return AlgorithmRS256
+	}
+	return AlgorithmEdDSA
+}
+
+// LoadKeyring reads <kid>.pem files from dir and marks the kid named in
+// active.kid as the signing key. With no directory configured an ephemeral
+// key is generated, which is only suitable for a single instance.
+func LoadKeyring(dir string, algorithm string) (*Keyring, error) {
+	if dir == "" {
+		log.Println("JWT_KEYS_DIR not set, using an ephemeral signing key")
+		key, err := generateSigningKey(algorithm)
+		if err != nil {
+			return nil, err
+		}
+		return &Keyring{active: key}, nil
+	}
+	// active.kid is written after its key, so reading it first means the
+	// key is there when the directory is listed
+	activeKid, err := os.ReadFile(filepath.Join(dir, activeKidFile))
+	if os.IsNotExist(err) {
+		return createFirstSigningKey(dir, algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	keys, err := readSigningKeys(dir)
+	if err != nil {
+		return nil, err
+	}
+	ring := &Keyring{lastReload: time.Now()}
+	for _, key := range keys {
+		if key.Kid == strings.TrimSpace(string(activeKid)) {
+			ring.active = key
+		} else {
+			ring.retired = append(ring.retired, key)
+		}
+	}
+	if ring.active == nil {
+		return nil, fmt.Errorf("active signing key %q not found in %s", strings.TrimSpace(string(activeKid)), dir)
+	}
+	return ring, nil
+}
+
+// RotateSigningKeys writes a new key to dir and makes it active. Retired keys
+// are kept until they can no longer have signed a live token.
+func RotateSigningKeys(dir string, algorithm string) (*SigningKey, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	key, err := generateSigningKey(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeSigningKey(filepath.Join(dir, key.Kid+signingKeyExtension), key); err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(filepath.Join(dir, activeKidFile), []byte(key.Kid+"\n"), 0600); err != nil {
+		return nil, err
+	}
+	if err := pruneRetiredKeys(dir, key.Kid); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// createFirstSigningKey makes a new key active in a directory that has none.
+// Replicas starting together race for active.kid; the losers drop their key
+// and load the winner's.
+func createFirstSigningKey(dir string, algorithm string) (*Keyring, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	key, err := generateSigningKey(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	keyPath := filepath.Join(dir, key.Kid+signingKeyExtension)
+	if err := writeSigningKey(keyPath, key); err != nil {
+		return nil, err
+	}
+	err = writeFileExclusive(filepath.Join(dir, activeKidFile), []byte(key.Kid+"\n"), 0600)
+	if os.IsExist(err) {
+		if err := os.Remove(keyPath); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return LoadKeyring(dir, algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Keyring{active: key, lastReload: time.Now()}, nil
+}
+
+func (k *Keyring) Active() *SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active
+}
+
+func (k *Keyring) Lookup(kid string) (*SigningKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.active != nil && k.active.Kid == kid {
+		return k.active, true
+	}
+	for _, key := range k.retired {
+		if key.Kid == kid {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// Keyfunc resolves the verification key from the kid header and rejects any
+// algorithm other than the one the key was created for.
+func (k *Keyring) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := k.Lookup(kid)
+	if !ok && k.reloadAllowed() {
+		// another instance may have rotated the shared key directory
+		if err := ReloadKeyring(); err != nil {
+			log.Println("Could not reload signing keys:", err)
+		}
+		key, ok = k.Lookup(kid)
+	}
+	if !ok {
+		return nil, ErrUnknownSigningKey
+	}
+	if token.Method.Alg() != key.Method().Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.PrivateKey.Public(), nil
+}
+
+// Algorithms lists the signing algorithms of the active and retired keys,
+// which are the only ones a token may use.
+func (k *Keyring) Algorithms() []string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	var algorithms []string
+	for _, key := range append([]*SigningKey{k.active}, k.retired...) {
+		if key == nil {
+			continue
+		}
+		alg := key.Method().Alg()
+		found := false
+		for _, existing := range algorithms {
+			found = found || existing == alg
+		}
+		if !found {
+			algorithms = append(algorithms, alg)
+		}
+	}
+	return algorithms
+}
+
+func (k *Keyring) reloadAllowed() bool {
+	keyringMu.Lock()
+	current := keyring
+	keyringMu.Unlock()
+	if os.Getenv("JWT_KEYS_DIR") == "" || k != current {
+		return false
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return time.Since(k.lastReload) > unknownKidReloadInterval
+}
+
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	key := k.Active()
+	if key == nil {
+		return "", errors.New("no active signing key")
+	}
+	token := jwt.NewWithClaims(key.Method(), claims)
+	token.Header["kid"] = key.Kid
+	return token.SignedString(key.PrivateKey)
+}
+
+func (k *Keyring) JWKS() JSONWebKeySet {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	keys := append([]*SigningKey{k.active}, k.retired...)
+	for _, key := range keys {
+		if key == nil {
+			continue
+		}
+		jwk := JSONWebKey{Kid: key.Kid, Alg: key.Algorithm, Use: "sig"}
+		switch public := key.PrivateKey.Public().(type) {
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+func generateSigningKey(algorithm string) (*SigningKey, error) {
+	var signer crypto.Signer
+	switch algorithm {
+	case AlgorithmRS256:
+		rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		signer = rsaKey
+	case AlgorithmEdDSA:
+		_, edKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		signer = edKey
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+	kid, err := keyID(signer)
+	if err != nil {
+		return nil, err
+	}
+	return &SigningKey{Kid: kid, Algorithm: algorithm, PrivateKey: signer, CreatedAt: time.Now()}, nil
+}
+
+// writeSigningKey stores the key with its creation time in a PEM header, as
+// the file's modification time does not survive copies and restores.
+func writeSigningKey(path string, key *SigningKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key.PrivateKey)
+	if err != nil {
+		return err
+	}
+	encoded := pem.EncodeToMemory(&pem.Block{
+		Type:    "PRIVATE KEY",
+		Headers: map[string]string{signingKeyCreatedHeader: key.CreatedAt.UTC().Format(time.RFC3339Nano)},
+		Bytes:   der,
+	})
+	return writeFileAtomic(path, encoded, 0600)
+}
+
+func keyID(signer crypto.Signer) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:16]), nil
+}
+
+func readSigningKeys(dir string) ([]*SigningKey, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var keys []*SigningKey
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), signingKeyExtension) {
+			continue
+		}
+		key, err := readSigningKey(filepath.Join(dir, entry.Name()))
+		if os.IsNotExist(err) {
+			// dropped by a replica that lost the race for the first key
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+func readSigningKey(path string) (*SigningKey, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(contents)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM file", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	createdAt, err := signingKeyCreatedAt(path, block)
+	if err != nil {
+		return nil, err
+	}
+	key := &SigningKey{CreatedAt: createdAt}
+	switch private := parsed.(type) {
+	case ed25519.PrivateKey:
+		key.Algorithm = AlgorithmEdDSA
+		key.PrivateKey = private
+	case *rsa.PrivateKey:
+		key.Algorithm = AlgorithmRS256
+		key.PrivateKey = private
+	default:
+		return nil, fmt.Errorf("%s holds an unsupported key type", path)
+	}
+	key.Kid = strings.TrimSuffix(filepath.Base(path), signingKeyExtension)
+	return key, nil
+}
+
+// signingKeyCreatedAt reads the creation time written with the key. Keys
+// written before it was recorded fall back to the file's modification time.
+func signingKeyCreatedAt(path string, block *pem.Block) (time.Time, error) {
+	if created, ok := block.Headers[signingKeyCreatedHeader]; ok {
+		createdAt, err := time.Parse(time.RFC3339Nano, created)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%s has an invalid %s header: %w", path, signingKeyCreatedHeader, err)
+		}
+		return createdAt, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// pruneRetiredKeys removes keys that were replaced longer ago than the longest
+// token lifetime. A key is replaced when the next newer key is created.
+func pruneRetiredKeys(dir string, activeKid string) error {
+	keys, err := readSigningKeys(dir)
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-maxTokenLifetime())
+	for i := 0; i < len(keys)-1; i++ {
+		if keys[i].Kid == activeKid {
+			continue
+		}
+		if keys[i+1].CreatedAt.Before(cutoff) {
+			if err := os.Remove(filepath.Join(dir, keys[i].Kid+signingKeyExtension)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// maxTokenLifetime is how long the longest lived token a key signs stays
+// valid, including the clock skew accepted when it is verified.
+func maxTokenLifetime() time.Duration {
+	lifetime := emailVerificationTokenLifespan
+	if accessLifetime := AccessTokenLifespan(); accessLifetime > lifetime {
+		lifetime = accessLifetime
+	}
+	return lifetime + TokenClockSkew()
+}
+
+func writeFileAtomic(path string, contents []byte, perm os.FileMode) error {
+	return writeTempFile(path, contents, perm, os.Rename)
+}
+
+// writeFileExclusive is writeFileAtomic that fails with an os.IsExist error,
+// like O_EXCL, when path already exists. The file is linked into place so
+// that readers never see it partly written.
+func writeFileExclusive(path string, contents []byte, perm os.FileMode) error {
+	return writeTempFile(path, contents, perm, os.Link)
+}
+
+func writeTempFile(path string, contents []byte, perm os.FileMode, place func(tmp string, path string) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(contents); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return place(tmp.Name(), path)
+}
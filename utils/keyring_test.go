@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+// writeTestSigningKey writes a key created at createdAt to dir.
+func writeTestSigningKey(t *testing.T, dir string, createdAt time.Time) *SigningKey {
+	t.Helper()
+	key, err := generateSigningKey(AlgorithmEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key.CreatedAt = createdAt
+	if err := writeSigningKey(filepath.Join(dir, key.Kid+signingKeyExtension), key); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestRotateSigningKeysKeepsAcceptingTheRetiredKey(t *testing.T) {
+	dir := t.TempDir()
+	first, err := LoadKeyring(dir, AlgorithmEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := first.Sign(jwt.RegisteredClaims{Subject: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := RotateSigningKeys(dir, AlgorithmEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ring, err := LoadKeyring(dir, AlgorithmEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ring.Active().Kid != rotated.Kid {
+		t.Fatalf("active key = %s, want %s", ring.Active().Kid, rotated.Kid)
+	}
+	if _, ok := ring.Lookup(first.Active().Kid); !ok {
+		t.Fatal("the retired key is no longer accepted")
+	}
+	if _, err := jwt.Parse(token, ring.Keyfunc, jwt.WithValidMethods(ring.Algorithms())); err != nil {
+		t.Fatalf("token signed before the rotation: %v", err)
+	}
+}
+
+func TestRotateSigningKeysPrunesByRecordedCreationTime(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	oldest := writeTestSigningKey(t, dir, now.Add(-30*24*time.Hour))
+	replaced := writeTestSigningKey(t, dir, now.Add(-20*24*time.Hour))
+	// a copied or restored directory gives every file the same mtime
+	for _, key := range []*SigningKey{oldest, replaced} {
+		path := filepath.Join(dir, key.Kid+signingKeyExtension)
+		if err := os.Chtimes(path, now, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	active, err := RotateSigningKeys(dir, AlgorithmEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := readSigningKeys(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kids []string
+	for _, key := range keys {
+		kids = append(kids, key.Kid)
+	}
+	// oldest was replaced long ago; replaced was only replaced just now
+	if len(kids) != 2 || kids[0] != replaced.Kid || kids[1] != active.Kid {
+		t.Fatalf("kept keys %v, want [%s %s]", kids, replaced.Kid, active.Kid)
+	}
+	if !keys[0].CreatedAt.Equal(replaced.CreatedAt) {
+		t.Errorf("created at %v, want %v", keys[0].CreatedAt, replaced.CreatedAt)
+	}
+}
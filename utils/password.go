@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const argon2idPrefix = "$argon2id$"
+
+var ErrInvalidPasswordHash = errors.New("password hash is not in a supported format")
+
+type PasswordParams struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+var DefaultPasswordParams = PasswordParams{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// PasswordParamsFromEnv reads the ARGON2_* variables and falls back to the
+// defaults for anything that is missing or malformed.
+func PasswordParamsFromEnv() PasswordParams {
+	params := DefaultPasswordParams
+	if memory, err := strconv.ParseUint(os.Getenv("ARGON2_MEMORY_KIB"), 10, 32); err == nil && memory > 0 {
+		params.Memory = uint32(memory)
+	}
+	if iterations, err := strconv.ParseUint(os.Getenv("ARGON2_ITERATIONS"), 10, 32); err == nil && iterations > 0 {
+		params.Iterations = uint32(iterations)
+	}
+	if parallelism, err := strconv.ParseUint(os.Getenv("ARGON2_PARALLELISM"), 10, 8); err == nil && parallelism > 0 {
+		params.Parallelism = uint8(parallelism)
+	}
+	return params
+}
+
+// HashPassword hashes the password with argon2id and returns it encoded in
+// PHC string format: $argon2id$v=19$m=<kib>,t=<iter>,p=<par>$<salt>$<key>
+func HashPassword(password string) (string, error) {
+	return hashPasswordWithParams(password, PasswordParamsFromEnv())
+}
+
+func hashPasswordWithParams(password string, params PasswordParams) (string, error) {
+	salt := make([]byte, params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	encoded := fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix,
+		argon2.Version,
+		params.Memory,
+		params.Iterations,
+		params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+	return encoded, nil
+}
+
+// VerifyPassword checks the password against a stored value in constant time.
+// needsRehash is true when the stored value is a legacy plaintext password or
+// was hashed with parameters that differ from the current configuration. An
+// empty stored value or password never matches.
+func VerifyPassword(password string, stored string) (match bool, needsRehash bool, err error) {
+	if stored == "" || password == "" {
+		DummyPasswordVerify(password)
+		return false, false, nil
+	}
+	if !IsPasswordHash(stored) {
+		match = subtle.ConstantTimeCompare([]byte(password), []byte(stored)) == 1
+		return match, true, nil
+	}
+	params, salt, key, err := decodePasswordHash(stored)
+	if err != nil {
+		return false, false, err
+	}
+	otherKey := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(key, otherKey) != 1 {
+		return false, false, nil
+	}
+	current := PasswordParamsFromEnv()
+	needsRehash = params.Memory != current.Memory ||
+		params.Iterations != current.Iterations ||
+		params.Parallelism != current.Parallelism ||
+		params.SaltLength != current.SaltLength ||
+		params.KeyLength != current.KeyLength
+	return true, needsRehash, nil
+}
+
+// DummyPasswordVerify burns the same amount of work as a real verification so
+// that unknown accounts cannot be told apart from wrong passwords by timing.
+func DummyPasswordVerify(password string) {
+	params := PasswordParamsFromEnv()
+	salt := make([]byte, params.SaltLength)
+	argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+}
+
+func IsPasswordHash(stored string) bool {
+	return strings.HasPrefix(stored, argon2idPrefix)
+}
+
+func decodePasswordHash(encoded string) (PasswordParams, []byte, []byte, error) {
+	var params PasswordParams
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, ErrInvalidPasswordHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, nil, nil, ErrInvalidPasswordHash
+	}
+	if version != argon2.Version {
+		return params, nil, nil, ErrInvalidPasswordHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, ErrInvalidPasswordHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrInvalidPasswordHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, ErrInvalidPasswordHash
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
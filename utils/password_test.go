@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+// useCheapPasswordParams keeps argon2id fast enough for tests.
+func useCheapPasswordParams(t *testing.T) {
+	t.Setenv("ARGON2_MEMORY_KIB", "64")
+	t.Setenv("ARGON2_ITERATIONS", "1")
+	t.Setenv("ARGON2_PARALLELISM", "1")
+}
+
+func TestHashPasswordRoundTrip(t *testing.T) {
+	useCheapPasswordParams(t)
+	hash, err := HashPassword("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("hash = %s, not in PHC format with the configured params", hash)
+	}
+	if again, _ := HashPassword("correct horse battery staple"); again == hash {
+		t.Error("two hashes of the same password share a salt")
+	}
+	if match, needsRehash, err := VerifyPassword("correct horse battery staple", hash); err != nil || !match || needsRehash {
+		t.Errorf("VerifyPassword = %v, %v, %v", match, needsRehash, err)
+	}
+	if match, _, err := VerifyPassword("wrong", hash); err != nil || match {
+		t.Errorf("wrong password matched: %v, %v", match, err)
+	}
+}
+
+func TestVerifyPasswordAsksForRehash(t *testing.T) {
+	useCheapPasswordParams(t)
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ARGON2_ITERATIONS", "2")
+	if match, needsRehash, err := VerifyPassword("secret", hash); err != nil || !match || !needsRehash {
+		t.Errorf("after a param change VerifyPassword = %v, %v, %v", match, needsRehash, err)
+	}
+	if match, needsRehash, err := VerifyPassword("secret", "secret"); err != nil || !match || !needsRehash {
+		t.Errorf("legacy plaintext VerifyPassword = %v, %v, %v", match, needsRehash, err)
+	}
+}
+
+func TestVerifyPasswordRejects(t *testing.T) {
+	useCheapPasswordParams(t)
+	if match, _, _ := VerifyPassword("", ""); match {
+		t.Error("empty password matched an empty stored value")
+	}
+	if _, _, err := VerifyPassword("secret", "$argon2id$v=19$m=64,t=1,p=1$not-base64!$x"); err != ErrInvalidPasswordHash {
+		t.Errorf("malformed hash err = %v", err)
+	}
+	if _, _, err := VerifyPassword("secret", "$argon2id$v=16$m=64,t=1,p=1$c2FsdA$a2V5"); err != ErrInvalidPasswordHash {
+		t.Errorf("other argon2 version err = %v", err)
+	}
+}
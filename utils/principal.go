@@ -0,0 +1,23 @@
+package utils
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/subashshakya/SFSS/models"
+)
+
+const principalContextKey = "sfss.principal"
+
+func SetPrincipal(c *gin.Context, principal *models.Principal) {
+	c.Set(principalContextKey, principal)
+}
+
+// GetPrincipal returns the authenticated caller that CheckInvalidToken put on
+// the context. It is only present on routes behind that middleware.
+func GetPrincipal(c *gin.Context) (*models.Principal, bool) {
+	value, exists := c.Get(principalContextKey)
+	if !exists {
+		return nil, false
+	}
+	principal, ok := value.(*models.Principal)
+	return principal, ok && principal != nil
+}
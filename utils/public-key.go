@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/subashshakya/SFSS/constants"
+	"golang.org/x/crypto/curve25519"
+)
+
+const keyCertificationContext = "sfss-key-certification:v1"
+
+var ErrInvalidPublicKey = errors.New("public key is not valid for its algorithm")
+
+// DecodePublicKey decodes a base64 public key and checks it is a 32 byte key
+// of the given algorithm.
+func DecodePublicKey(algorithm string, encoded string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidPublicKey
+	}
+	switch algorithm {
+	case constants.KeyAlgorithmEd25519:
+		if len(raw) != ed25519.PublicKeySize {
+			return nil, ErrInvalidPublicKey
+		}
+	case constants.KeyAlgorithmX25519:
+		if len(raw) != curve25519.PointSize {
+			return nil, ErrInvalidPublicKey
+		}
+		// a low order point would make every shared secret all zeros
+		scalar := make([]byte, curve25519.ScalarSize)
+		scalar[0] = 1
+		if _, err := curve25519.X25519(scalar, raw); err != nil {
+			return nil, ErrInvalidPublicKey
+		}
+	default:
+		return nil, ErrInvalidPublicKey
+	}
+	return raw, nil
+}
+
+// KeyFingerprint is the hex SHA-256 of the raw public key.
+func KeyFingerprint(raw []byte) string {
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// KeyCertificationMessage is what the owner signs to bind a key to their
+// account, so a key cannot be replayed under another user id.
+func KeyCertificationMessage(userId uint, algorithm string, fingerprint string) []byte {
+	return []byte(fmt.Sprintf("%s:%d:%s:%s", keyCertificationContext, userId, algorithm, fingerprint))
+}
+
+func VerifyKeyCertification(signingKey []byte, message []byte, encodedSignature string) bool {
+	signature, err := base64.StdEncoding.DecodeString(encodedSignature)
+	if err != nil || len(signingKey) != ed25519.PublicKeySize {
+		return false
+	}
+	return ed25519.Verify(ed25519.PublicKey(signingKey), message, signature)
+}
@@ -0,0 +1,28 @@
+package utils
+
+import "github.com/subashshakya/SFSS/constants"
+
+var rolePermissions = map[string][]string{
+	constants.RoleUser: {},
+	constants.RoleAuditor: {
+		constants.PermissionUsersRead,
+		constants.PermissionStatsRead,
+		constants.PermissionAuditRead,
+	},
+	constants.RoleAdmin: {
+		constants.PermissionUsersRead,
+		constants.PermissionUsersManage,
+		constants.PermissionRolesManage,
+		constants.PermissionStatsRead,
+		constants.PermissionAuditRead,
+	},
+}
+
+func RoleHasPermission(role string, permission string) bool {
+	for _, granted := range rolePermissions[role] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
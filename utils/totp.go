@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/subashshakya/SFSS/envelope"
+)
+
+const totpPeriod = 30
+const totpDigits = 6
+const totpSkewSteps = 1
+const recoveryCodeCount = 10
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func GenerateTotpSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// SealTotpSecret encrypts the user's TOTP secret for storage with the file
+// encryption master keys.
+func SealTotpSecret(userId uint, secret string) (string, error) {
+	return envelope.Default.SealValue(secret, totpSecretPurpose(userId))
+}
+
+// OpenTotpSecret returns the TOTP secret stored for the user, which may still
+// be in plain if it was saved before secrets were encrypted.
+func OpenTotpSecret(userId uint, stored string) (string, error) {
+	return envelope.Default.OpenValue(stored, totpSecretPurpose(userId))
+}
+
+func totpSecretPurpose(userId uint) string {
+	return "users.totp_secret:" + strconv.FormatUint(uint64(userId), 10)
+}
+
+func TotpIssuer() string {
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		return "SFSS"
+	}
+	return issuer
+}
+
+func TotpURI(secret string, accountName string) string {
+	issuer := TotpIssuer()
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+	label := url.PathEscape(issuer + ":" + accountName)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// VerifyTotp checks an RFC 6238 code against the secret allowing one step of
+// clock drift either way. It returns the matched time step so callers can
+// reject a code that has already been used.
+func VerifyTotp(secret string, code string, now time.Time) (int64, bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil {
+		return 0, false
+	}
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	currentStep := now.Unix() / totpPeriod
+	for offset := int64(-totpSkewSteps); offset <= totpSkewSteps; offset++ {
+		step := currentStep + offset
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func totpCode(key []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// GenerateRecoveryCodes returns the plaintext codes shown to the user once
+// and the hashes that are stored.
+func GenerateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 10)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+		encoded := strings.ToLower(totpEncoding.EncodeToString(raw))
+		code := encoded[:8] + "-" + encoded[8:16]
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+func HashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
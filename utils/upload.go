@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+const defaultFileUploadMaxBytes = 5 << 30
+
+var ErrUploadTooLarge = errors.New("upload exceeds the maximum file size")
+
+const defaultFileUploadExpiry = time.Hour * 24
+
+// FileUploadExpiry reads FILE_UPLOAD_EXPIRY_HOURS, how long a resumable
+// upload is kept after the last chunk arrived.
+func FileUploadExpiry() time.Duration {
+	hours, err := strconv.Atoi(os.Getenv("FILE_UPLOAD_EXPIRY_HOURS"))
+	if err != nil || hours <= 0 {
+		return defaultFileUploadExpiry
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// FileUploadMaxBytes reads FILE_UPLOAD_MAX_BYTES.
+func FileUploadMaxBytes() int64 {
+	maxBytes, err := strconv.ParseInt(os.Getenv("FILE_UPLOAD_MAX_BYTES"), 10, 64)
+	if err != nil || maxBytes <= 0 {
+		return defaultFileUploadMaxBytes
+	}
+	return maxBytes
+}
+
+const defaultFileUploadMinChunkBytes = 5 << 20
+
+// FileUploadMinChunkBytes reads FILE_UPLOAD_MIN_CHUNK_BYTES, the smallest
+// resumable upload chunk accepted other than the last one. Every chunk is
+// stored separately until the upload is assembled, so this bounds the
+// number of parts of an upload.
+func FileUploadMinChunkBytes() int64 {
+	minBytes, err := strconv.ParseInt(os.Getenv("FILE_UPLOAD_MIN_CHUNK_BYTES"), 10, 64)
+	if err != nil || minBytes <= 0 {
+		return defaultFileUploadMinChunkBytes
+	}
+	return minBytes
+}
+
+// HashingReader counts and SHA-256 hashes everything read through it, and
+// fails with ErrUploadTooLarge once more than maxBytes have been read.
+type HashingReader struct {
+	r        io.Reader
+	hash     hash.Hash
+	size     int64
+	maxBytes int64
+}
+
+func NewHashingReader(r io.Reader, maxBytes int64) *HashingReader {
+	return &HashingReader{r: r, hash: sha256.New(), maxBytes: maxBytes}
+}
+
+// ResumeHashingReader continues a hash saved with State, so content that
+// arrives over several requests is hashed as one. Size only counts what is
+// read through the new reader.
+func ResumeHashingReader(r io.Reader, maxBytes int64, state []byte) (*HashingReader, error) {
+	h := NewHashingReader(r, maxBytes)
+	if len(state) == 0 {
+		return h, nil
+	}
+	if err := h.hash.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *HashingReader) Read(p []byte) (int, error) {
+	if remaining := h.maxBytes + 1 - h.size; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := h.r.Read(p)
+	h.hash.Write(p[:n])
+	h.size += int64(n)
+	if h.size > h.maxBytes {
+		return n, ErrUploadTooLarge
+	}
+	return n, err
+}
+
+func (h *HashingReader) Size() int64 {
+	return h.size
+}
+
+func (h *HashingReader) Sum() string {
+	return hex.EncodeToString(h.hash.Sum(nil))
+}
+
+func (h *HashingReader) State() ([]byte, error) {
+	return h.hash.(encoding.BinaryMarshaler).MarshalBinary()
+}
+
+// ContentSha256 is the hex SHA-256 of content that is already in memory.
+func ContentSha256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
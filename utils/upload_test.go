@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestHashingReaderHashesAndCounts(t *testing.T) {
+	content := "the quick brown fox jumps over the lazy dog"
+	reader := NewHashingReader(iotest.OneByteReader(strings.NewReader(content)), int64(len(content)))
+	read, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(read) != content {
+		t.Errorf("read %q", read)
+	}
+	if reader.Size() != int64(len(content)) {
+		t.Errorf("Size = %d, want %d", reader.Size(), len(content))
+	}
+	if want := "05c6e08f1d9fdafa03147fcb8f82f124c76d2f70e3d989dc8aadb5e7d7450bec"; reader.Sum() != want {
+		t.Errorf("Sum = %s, want %s", reader.Sum(), want)
+	}
+	if reader.Sum() != ContentSha256([]byte(content)) {
+		t.Error("Sum and ContentSha256 disagree")
+	}
+}
+
+func TestHashingReaderStopsPastMaxBytes(t *testing.T) {
+	reader := NewHashingReader(strings.NewReader(strings.Repeat("a", 100)), 10)
+	_, err := io.ReadAll(reader)
+	if !errors.Is(err, ErrUploadTooLarge) {
+		t.Fatalf("err = %v, want ErrUploadTooLarge", err)
+	}
+	if reader.Size() != 11 {
+		t.Errorf("read %d bytes, want to stop one past the limit", reader.Size())
+	}
+
+	exact := NewHashingReader(strings.NewReader(strings.Repeat("a", 10)), 10)
+	if _, err := io.ReadAll(exact); err != nil {
+		t.Errorf("content of exactly max bytes failed: %v", err)
+	}
+}